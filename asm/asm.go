@@ -0,0 +1,450 @@
+// Package asm assembles CHIP-8, SUPER-CHIP and XO-CHIP programs. Sources are
+// written either with Cowgod's mnemonics (the notation of the comments in
+// opcodes.go and of the disassembler listing) or in Octo syntax.
+package asm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Address programs are loaded at
+const Origin = 0x200
+
+type Dialect int
+
+const (
+	DialectNative Dialect = iota // Cowgod's mnemonics
+	DialectOcto                  // Octo
+)
+
+// DialectFor returns the dialect of a source file by its extension, .8o is
+// Octo and everything else uses Cowgod's mnemonics.
+func DialectFor(name string) Dialect {
+	if strings.EqualFold(filepath.Ext(name), ".8o") {
+		return DialectOcto
+	}
+	return DialectNative
+}
+
+type Options struct {
+	Dialect Dialect
+	Origin  uint16 // Origin if 0
+	// ReadFile reads included files, os.ReadFile if nil
+	ReadFile func(name string) ([]byte, error)
+}
+
+// Position in a source file
+type Pos struct {
+	File string
+	Line int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+type Error struct {
+	Pos Pos
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// ErrorList is every error found while assembling.
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, e := range l {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Line maps the bytes of an instruction or data item to its source line.
+type Line struct {
+	Addr uint16 `json:"addr"`
+	Size uint16 `json:"size"`
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// Program is an assembled program.
+type Program struct {
+	Origin    uint16
+	Code      []byte
+	Labels    map[string]uint16
+	Constants map[string]int
+	Lines     []Line // ordered by address
+
+	sources map[string][]string
+}
+
+type symbol struct {
+	label bool
+	value int
+	expr  expr
+	state int // 0 unresolved, 1 resolving, 2 resolved
+	pos   Pos
+}
+
+// item is an instruction or data, encoded once all symbols are known.
+type item struct {
+	addr   int
+	size   int
+	pos    Pos
+	encode func() ([]byte, error)
+}
+
+type assembler struct {
+	opts     Options
+	addr     int
+	items    []*item
+	symbols  map[string]*symbol
+	errs     ErrorList
+	sources  map[string][]string
+	includes []string // stack of files being assembled
+
+	// macros and aliases are visible in the files included after them
+	macros     map[string]*macro
+	aliases    map[string]uint16
+	expansions int
+}
+
+// Maximum nesting of includes and macros
+const maxDepth = 32
+
+// Assemble the source of the file name.
+func Assemble(name string, src []byte, opts Options) (*Program, error) {
+	if opts.Origin == 0 {
+		opts.Origin = Origin
+	}
+	if opts.ReadFile == nil {
+		opts.ReadFile = os.ReadFile
+	}
+	a := &assembler{
+		opts:    opts,
+		addr:    int(opts.Origin),
+		symbols: map[string]*symbol{},
+		sources: map[string][]string{},
+		macros:  map[string]*macro{},
+		aliases: map[string]uint16{},
+	}
+
+	a.parse(name, string(src), Pos{})
+	if len(a.errs) > 0 {
+		return nil, a.errs
+	}
+	return a.link()
+}
+
+// AssembleFile reads and assembles a source file, the dialect follows from
+// its extension.
+func AssembleFile(name string) (*Program, error) {
+	src, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return Assemble(name, src, Options{Dialect: DialectFor(name)})
+}
+
+func (a *assembler) parse(name, src string, from Pos) {
+	if len(a.includes) >= maxDepth {
+		a.errorf(from, "includes nested too deeply")
+		return
+	}
+	for _, f := range a.includes {
+		if f == name {
+			a.errorf(from, "recursive include of %s", name)
+			return
+		}
+	}
+	a.includes = append(a.includes, name)
+	defer func() { a.includes = a.includes[:len(a.includes)-1] }()
+
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	a.sources[name] = strings.Split(src, "\n")
+	if a.opts.Dialect == DialectOcto {
+		a.parseOcto(name, src)
+	} else {
+		a.parseNative(name, src)
+	}
+}
+
+// include assembles the file name, relative to the including file.
+func (a *assembler) include(pos Pos, name string) {
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(filepath.Dir(pos.File), name)
+	}
+	src, err := a.opts.ReadFile(name)
+	if err != nil {
+		a.errorf(pos, "%v", err)
+		return
+	}
+	a.parse(name, string(src), pos)
+}
+
+func (a *assembler) errorf(pos Pos, format string, args ...any) {
+	a.errs = append(a.errs, &Error{pos, fmt.Sprintf(format, args...)})
+}
+
+// label defines name at the current address.
+func (a *assembler) label(pos Pos, name string) {
+	a.define(pos, name, &symbol{label: true, value: a.addr, state: 2, pos: pos})
+}
+
+// constant defines name as the value of e, evaluated when it is used.
+func (a *assembler) constant(pos Pos, name string, e expr) {
+	a.define(pos, name, &symbol{expr: e, pos: pos})
+}
+
+func (a *assembler) define(pos Pos, name string, s *symbol) {
+	if !isName(name) {
+		a.errorf(pos, "invalid name %q", name)
+		return
+	}
+	if old, ok := a.symbols[name]; ok {
+		a.errorf(pos, "%s redefined, previously defined at %s", name, old.pos)
+		return
+	}
+	a.symbols[name] = s
+}
+
+func (a *assembler) lookup(name string) (int, error) {
+	s, ok := a.symbols[name]
+	if !ok {
+		return 0, fmt.Errorf("undefined: %s", name)
+	}
+	switch s.state {
+	case 1:
+		return 0, fmt.Errorf("%s is defined by itself", name)
+	case 0:
+		s.state = 1
+		v, err := s.expr.eval(a)
+		if err != nil {
+			s.state = 0
+			return 0, err
+		}
+		s.value, s.state = v, 2
+	}
+	return s.value, nil
+}
+
+// value evaluates e and checks that it is in [min, max].
+func (a *assembler) value(e expr, min, max int, what string) (int, error) {
+	v, err := e.eval(a)
+	if err != nil {
+		return 0, err
+	}
+	if v < min || v > max {
+		return 0, fmt.Errorf("%s %d (%#x) out of range", what, v, v)
+	}
+	return v, nil
+}
+
+// emit adds an item of size bytes at the current address.
+func (a *assembler) emit(pos Pos, size int, encode func() ([]byte, error)) {
+	a.items = append(a.items, &item{addr: a.addr, size: size, pos: pos, encode: encode})
+	a.addr += size
+}
+
+// emitOp adds a 2 byte instruction.
+func (a *assembler) emitOp(pos Pos, encode func() (uint16, error)) {
+	a.emit(pos, 2, func() ([]byte, error) {
+		op, err := encode()
+		return []byte{byte(op >> 8), byte(op)}, err
+	})
+}
+
+// Operands of instructions
+func (a *assembler) addr12(e expr) (uint16, error) {
+	v, err := a.value(e, 0, 0xfff, "address")
+	return uint16(v), err
+}
+
+func (a *assembler) addr16(e expr) (uint16, error) {
+	v, err := a.value(e, 0, 0xffff, "address")
+	return uint16(v), err
+}
+
+func (a *assembler) byte8(e expr) (uint16, error) {
+	v, err := a.value(e, -128, 255, "byte")
+	return uint16(v) & 0xff, err
+}
+
+func (a *assembler) nibble(e expr) (uint16, error) {
+	v, err := a.value(e, 0, 15, "nibble")
+	return uint16(v), err
+}
+
+// link encodes all items into the program.
+func (a *assembler) link() (*Program, error) {
+	p := &Program{
+		Origin:    a.opts.Origin,
+		Labels:    map[string]uint16{},
+		Constants: map[string]int{},
+		sources:   a.sources,
+	}
+
+	end := int(p.Origin)
+	for _, it := range a.items {
+		if it.addr < int(p.Origin) {
+			a.errorf(it.pos, "address %#x before the origin %#x", it.addr, p.Origin)
+		}
+		end = max(end, it.addr+it.size)
+	}
+	if end > 0x10000 {
+		a.errorf(a.items[len(a.items)-1].pos, "program does not fit into 64 KiB")
+	}
+	if len(a.errs) > 0 {
+		return nil, a.errs
+	}
+
+	p.Code = make([]byte, end-int(p.Origin))
+	used := make([]bool, len(p.Code))
+	for _, it := range a.items {
+		data, err := it.encode()
+		if err != nil {
+			a.errorf(it.pos, "%v", err)
+			continue
+		}
+		for i := range data {
+			o := it.addr + i - int(p.Origin)
+			if used[o] {
+				a.errorf(it.pos, "overlaps previous code at %#x", it.addr+i)
+				break
+			}
+			used[o] = true
+			p.Code[o] = data[i]
+		}
+		if it.size > 0 {
+			p.Lines = append(p.Lines, Line{uint16(it.addr), uint16(it.size), it.pos.File, it.pos.Line})
+		}
+	}
+
+	for name, s := range a.symbols {
+		v, err := a.lookup(name)
+		if err != nil {
+			a.errorf(s.pos, "%v", err)
+			continue
+		}
+		if s.label {
+			p.Labels[name] = uint16(v)
+		} else {
+			p.Constants[name] = v
+		}
+	}
+	if len(a.errs) > 0 {
+		return nil, a.errs
+	}
+
+	sort.SliceStable(p.Lines, func(i, j int) bool { return p.Lines[i].Addr < p.Lines[j].Addr })
+	return p, nil
+}
+
+// WriteListing writes every line of code with its address and bytes.
+func (p *Program) WriteListing(w io.Writer) error {
+	var b strings.Builder
+	for _, l := range p.Lines {
+		data := p.Code[int(l.Addr)-int(p.Origin) : int(l.Addr)-int(p.Origin)+int(l.Size)]
+		src := ""
+		if lines := p.sources[l.File]; l.Line > 0 && l.Line <= len(lines) {
+			src = strings.TrimRight(lines[l.Line-1], " \t")
+		}
+		for i := 0; i < len(data); i += 4 {
+			hex := fmt.Sprintf("% X", data[i:min(i+4, len(data))])
+			if i == 0 {
+				fmt.Fprintf(&b, "%04X  %-11s  %s:%d\t%s\n", int(l.Addr)+i, hex, filepath.Base(l.File), l.Line, src)
+			} else {
+				fmt.Fprintf(&b, "%04X  %s\n", int(l.Addr)+i, hex)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(p.Labels))
+	for name := range p.Labels {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return p.Labels[names[i]] < p.Labels[names[j]] || p.Labels[names[i]] == p.Labels[names[j]] && names[i] < names[j]
+	})
+	fmt.Fprintf(&b, "\nLabels:\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "%04X  %s\n", p.Labels[name], name)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// SymbolFile maps addresses to labels and source lines, for debuggers and
+// other tools. It is stored as JSON.
+type SymbolFile struct {
+	Origin    uint16            `json:"origin"`
+	Labels    map[string]uint16 `json:"labels"`
+	Constants map[string]int    `json:"constants"`
+	Lines     []Line            `json:"lines"`
+}
+
+func (p *Program) Symbols() *SymbolFile {
+	return &SymbolFile{
+		Origin:    p.Origin,
+		Labels:    p.Labels,
+		Constants: p.Constants,
+		Lines:     p.Lines,
+	}
+}
+
+func (p *Program) WriteSymbols(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p.Symbols())
+}
+
+func ReadSymbols(r io.Reader) (*SymbolFile, error) {
+	s := &SymbolFile{}
+	if err := json.NewDecoder(r).Decode(s); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(s.Lines, func(i, j int) bool { return s.Lines[i].Addr < s.Lines[j].Addr })
+	return s, nil
+}
+
+// LineAt returns the source line of the instruction or data at addr.
+func (s *SymbolFile) LineAt(addr uint16) (Line, bool) {
+	i := sort.Search(len(s.Lines), func(i int) bool { return s.Lines[i].Addr+s.Lines[i].Size > addr })
+	if i < len(s.Lines) && s.Lines[i].Addr <= addr {
+		return s.Lines[i], true
+	}
+	return Line{}, false
+}
+
+// AddrsOf returns the addresses of the code generated by a source line.
+func (s *SymbolFile) AddrsOf(file string, line int) []uint16 {
+	var addrs []uint16
+	for _, l := range s.Lines {
+		if l.Line == line && (l.File == file || filepath.Base(l.File) == filepath.Base(file)) {
+			addrs = append(addrs, l.Addr)
+		}
+	}
+	return addrs
+}
+
+// LabelAt returns the name of a label at addr.
+func (s *SymbolFile) LabelAt(addr uint16) (string, bool) {
+	found := ""
+	for name, a := range s.Labels {
+		if a == addr && (found == "" || name < found) {
+			found = name
+		}
+	}
+	return found, found != ""
+}
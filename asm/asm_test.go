@@ -0,0 +1,232 @@
+package asm
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/debuggerpls/go-chip8/disasm"
+)
+
+var testROM = []byte{
+	0x00, 0xe0, // 0200 CLS
+	0xa2, 0x0e, // 0202 LD I, D020E
+	0x22, 0x08, // 0204 CALL S0208
+	0x12, 0x06, // 0206 JP L0206
+	0x30, 0x00, // 0208 SE V0, #00
+	0xd0, 0x15, // 020A DRW V0, V1, 5
+	0x00, 0xee, // 020C RET
+	0xf0, 0x90, 0x90, 0x90, 0xf0, // 020E sprite
+}
+
+func TestAssemble(t *testing.T) {
+	src := `
+; test program
+SPEED   EQU 2 * 3
+start:  CLS
+        LD I, digit
+        CALL draw
+loop:   JP loop
+draw:   SE V0, 0
+        DRW V0, V1, SIZE
+        RET
+SIZE    = digit.end - digit
+digit:  SPRITE ####.... #..#.... #..#....
+        DB %10010000, #F0
+digit.end:
+        LD V1, SPEED
+        LD I, LONG #1234
+        LD [I], V1-V3
+        SHR V2
+        SCD 4
+`
+	p, err := Assemble("test.asm", []byte(src), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := append(append([]byte{}, testROM...),
+		0x61, 0x06,
+		0xf0, 0x00, 0x12, 0x34,
+		0x51, 0x32,
+		0x82, 0x26,
+		0x00, 0xc4)
+	if !bytes.Equal(p.Code, expected) {
+		t.Errorf("Wrong code\nexpected=% x\nactual  =% x", expected, p.Code)
+	}
+	if p.Labels["draw"] != 0x208 || p.Constants["SIZE"] != 5 {
+		t.Errorf("Wrong symbols, labels=%v constants=%v", p.Labels, p.Constants)
+	}
+
+	var b strings.Builder
+	if err := p.WriteListing(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "0204  22 08        test.asm:6\t        CALL draw\n") {
+		t.Errorf("Wrong listing:\n%s", b.String())
+	}
+
+	syms := p.Symbols()
+	if l, ok := syms.LineAt(0x20b); !ok || l.Line != 9 {
+		t.Errorf("Wrong line of 020b: %+v", l)
+	}
+	if addrs := syms.AddrsOf("test.asm", 6); len(addrs) != 1 || addrs[0] != 0x204 {
+		t.Errorf("Wrong address of line 6: %x", addrs)
+	}
+}
+
+func TestMacroInclude(t *testing.T) {
+	files := map[string]string{
+		"lib/macros.asm": `
+        MACRO wait reg, n
+        LD reg, n
+w\@:    ADD reg, -1
+        SE reg, 0
+        JP w\@
+        ENDM
+`,
+	}
+	src := `
+        INCLUDE "lib/macros.asm"
+        wait V3, 10
+        wait V4, 20
+`
+	opts := Options{ReadFile: func(name string) ([]byte, error) {
+		if src, ok := files[name]; ok {
+			return []byte(src), nil
+		}
+		return nil, errors.New("not found")
+	}}
+	p, err := Assemble("main.asm", []byte(src), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{
+		0x63, 0x0a, 0x73, 0xff, 0x33, 0x00, 0x12, 0x02,
+		0x64, 0x14, 0x74, 0xff, 0x34, 0x00, 0x12, 0x0a,
+	}
+	if !bytes.Equal(p.Code, expected) {
+		t.Errorf("Wrong code\nexpected=% x\nactual  =% x", expected, p.Code)
+	}
+	if l, _ := p.Symbols().LineAt(0x20a); l.File != "main.asm" || l.Line != 4 {
+		t.Errorf("Expansion should belong to the invocation, actual=%+v", l)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	testData := []struct {
+		src string
+		msg string
+	}{
+		{"JP nowhere", "test.asm:1: undefined: nowhere"},
+		{"LD V0, 256", "test.asm:1: byte 256 (0x100) out of range"},
+		{"a:\na:", "test.asm:2: a redefined, previously defined at test.asm:1"},
+		{"FOO V1", "test.asm:1: unknown instruction FOO V1"},
+		{"X EQU Y\nY EQU X\nLD V0, X", "X is defined by itself"},
+		{"ORG #100\nCLS", "before the origin"},
+	}
+
+	for _, data := range testData {
+		_, err := Assemble("test.asm", []byte(data.src), Options{})
+		if err == nil || !strings.Contains(err.Error(), data.msg) {
+			t.Errorf("%q: expected error %q, actual=%v", data.src, data.msg, err)
+		}
+	}
+}
+
+func TestOcto(t *testing.T) {
+	src := `
+:const SIZE 5
+: main
+	clear
+	i := digit
+	draw
+: loop
+	jump loop
+: draw
+	if v0 != 0 then
+	sprite v0 v1 SIZE
+	loop
+		v2 += 1
+		while v2 != 4
+		if v3 key begin
+			v4 := random 0xFF
+		else
+			save v1 - v3
+		end
+	again
+	return
+: digit
+	0xF0 0x90 0x90 0x90 0xF0
+`
+	p, err := Assemble("test.8o", []byte(src), Options{Dialect: DialectOcto})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{
+		0x00, 0xe0, 0xa2, 0x20, 0x22, 0x08, 0x12, 0x06,
+		0x30, 0x00, 0xd0, 0x15,
+		0x72, 0x01, 0x42, 0x04, 0x12, 0x1e, // loop, while
+		0xe3, 0x9e, 0x12, 0x1a, 0xc4, 0xff, 0x12, 0x1c, 0x51, 0x32, // if begin else end
+		0x12, 0x0c, // again
+		0x00, 0xee,
+	}
+	expected = append(expected, 0xf0, 0x90, 0x90, 0x90, 0xf0)
+	if !bytes.Equal(p.Code, expected) {
+		t.Errorf("Wrong code\nexpected=% x\nactual  =% x", expected, p.Code)
+	}
+}
+
+func TestOctoMain(t *testing.T) {
+	src := `
+:macro twice op { op op }
+: sub
+	twice return
+: main
+	sub
+`
+	p, err := Assemble("test.8o", []byte(src), Options{Dialect: DialectOcto})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0x12, 0x06, 0x00, 0xee, 0x00, 0xee, 0x22, 0x02}
+	if !bytes.Equal(p.Code, expected) {
+		t.Errorf("Wrong code\nexpected=% x\nactual  =% x", expected, p.Code)
+	}
+}
+
+// The output of the disassembler assembles back to the same program.
+func TestRoundtrip(t *testing.T) {
+	d := disasm.Disassemble(testROM, disasm.Origin)
+
+	var listing, octo bytes.Buffer
+	if err := d.WriteListing(&listing); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteOcto(&octo); err != nil {
+		t.Fatal(err)
+	}
+
+	// the listing starts with the address and the opcode of every line
+	var src strings.Builder
+	for _, line := range strings.Split(listing.String(), "\n") {
+		if len(line) > 16 && line[4] == ' ' {
+			line = line[16:]
+		}
+		src.WriteString(line + "\n")
+	}
+
+	for _, data := range []struct {
+		name string
+		src  string
+	}{{"listing.asm", src.String()}, {"listing.8o", octo.String()}} {
+		p, err := Assemble(data.name, []byte(data.src), Options{Dialect: DialectFor(data.name)})
+		if err != nil {
+			t.Errorf("%s: %v\n%s", data.name, err, data.src)
+			continue
+		}
+		if !bytes.Equal(p.Code, testROM) {
+			t.Errorf("%s: Wrong code\nexpected=% x\nactual  =% x", data.name, testROM, p.Code)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// expr is a constant expression, evaluated once all labels are known.
+type expr interface {
+	eval(a *assembler) (int, error)
+}
+
+type numExpr int
+
+func (e numExpr) eval(a *assembler) (int, error) {
+	return int(e), nil
+}
+
+type symExpr string
+
+func (e symExpr) eval(a *assembler) (int, error) {
+	return a.lookup(string(e))
+}
+
+type unaryExpr struct {
+	op string
+	x  expr
+}
+
+func (e unaryExpr) eval(a *assembler) (int, error) {
+	x, err := e.x.eval(a)
+	if err != nil {
+		return 0, err
+	}
+	switch e.op {
+	case "-":
+		return -x, nil
+	case "~":
+		return ^x, nil
+	}
+	return x, nil
+}
+
+type binaryExpr struct {
+	op   string
+	l, r expr
+}
+
+func (e binaryExpr) eval(a *assembler) (int, error) {
+	l, err := e.l.eval(a)
+	if err != nil {
+		return 0, err
+	}
+	r, err := e.r.eval(a)
+	if err != nil {
+		return 0, err
+	}
+	switch e.op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/", "%":
+		if r == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		if e.op == "/" {
+			return l / r, nil
+		}
+		return l % r, nil
+	case "&":
+		return l & r, nil
+	case "|":
+		return l | r, nil
+	case "^":
+		return l ^ r, nil
+	case "<<":
+		return l << uint(r), nil
+	case ">>":
+		return l >> uint(r), nil
+	}
+	return 0, fmt.Errorf("unknown operator %q", e.op)
+}
+
+// Binary operators by precedence, lowest first
+var precedence = [][]string{
+	{"|"},
+	{"^"},
+	{"&"},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+// lexExpr splits an expression into numbers, names, operators and parentheses.
+func lexExpr(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case strings.HasPrefix(s[i:], "<<") || strings.HasPrefix(s[i:], ">>"):
+			tokens = append(tokens, s[i:i+2])
+			i += 2
+		case strings.ContainsRune("+-*/&|^~()", c):
+			tokens = append(tokens, string(c))
+			i++
+		case c == '%' && (i+1 >= len(s) || (s[i+1] != '0' && s[i+1] != '1') || lastIsValue(tokens)):
+			// modulo, unless it starts a binary number
+			tokens = append(tokens, "%")
+			i++
+		case c == '\'':
+			if i+2 >= len(s) || s[i+2] != '\'' {
+				return nil, fmt.Errorf("invalid character literal in %q", s)
+			}
+			tokens = append(tokens, s[i:i+3])
+			i += 3
+		default:
+			j := i + 1
+			for j < len(s) && !unicode.IsSpace(rune(s[j])) && !strings.ContainsRune("+-*/&|^~()<>%'", rune(s[j])) {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+var operators = map[string]bool{
+	"+": true, "-": true, "*": true, "/": true, "%": true, "&": true,
+	"|": true, "^": true, "~": true, "<<": true, ">>": true, "(": true,
+}
+
+// lastIsValue reports whether the last token ends a value, so a following
+// % is the modulo operator.
+func lastIsValue(tokens []string) bool {
+	return len(tokens) > 0 && !operators[tokens[len(tokens)-1]]
+}
+
+type exprParser struct {
+	tokens []string
+	pos    int
+}
+
+// parseExpr parses a complete expression from tokens.
+func parseExpr(tokens []string) (expr, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("missing expression")
+	}
+	p := &exprParser{tokens: tokens}
+	e, err := p.binary(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in expression", p.tokens[p.pos])
+	}
+	return e, nil
+}
+
+// parseExprString lexes and parses an expression.
+func parseExprString(s string) (expr, error) {
+	tokens, err := lexExpr(s)
+	if err != nil {
+		return nil, err
+	}
+	return parseExpr(tokens)
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) binary(level int) (expr, error) {
+	if level == len(precedence) {
+		return p.unary()
+	}
+	l, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		found := false
+		for _, o := range precedence[level] {
+			found = found || o == op
+		}
+		if !found {
+			return l, nil
+		}
+		p.pos++
+		r, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		l = binaryExpr{op, l, r}
+	}
+}
+
+func (p *exprParser) unary() (expr, error) {
+	switch tok := p.peek(); tok {
+	case "-", "~", "+":
+		p.pos++
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryExpr{tok, x}, nil
+	case "(":
+		p.pos++
+		e, err := p.binary(0)
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return e, nil
+	case "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	default:
+		p.pos++
+		if n, ok := parseNumber(tok); ok {
+			return numExpr(n), nil
+		}
+		if !isName(tok) {
+			return nil, fmt.Errorf("unexpected %q in expression", tok)
+		}
+		return symExpr(tok), nil
+	}
+}
+
+// parseNumber parses decimal, hexadecimal (0x, # or $), binary (0b or %)
+// and character ('A') literals.
+func parseNumber(s string) (int, bool) {
+	base := 10
+	digits := s
+	switch {
+	case len(s) == 3 && s[0] == '\'' && s[2] == '\'':
+		return int(s[1]), true
+	case strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X"):
+		base, digits = 16, s[2:]
+	case strings.HasPrefix(s, "0b") || strings.HasPrefix(s, "0B"):
+		base, digits = 2, s[2:]
+	case strings.HasPrefix(s, "#") || strings.HasPrefix(s, "$"):
+		base, digits = 16, s[1:]
+	case strings.HasPrefix(s, "%"):
+		base, digits = 2, s[1:]
+	}
+	if digits == "" {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(digits, base, 32)
+	if err != nil {
+		return 0, false
+	}
+	return int(n), true
+}
+
+func isName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		if !(c == '_' || c == '.' || c == '-' && i > 0 || unicode.IsLetter(c) || i > 0 && unicode.IsDigit(c)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,558 @@
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Native syntax, one statement per line:
+//
+//	; comment
+//	label:  LD V0, #05      ; Cowgod's mnemonics, see opcodes.go
+//	SPEED   EQU 3           ; constant, also SPEED = 3
+//	        DB #F0, %10010000, 'A', "text"
+//	        DW #1234
+//	        SPRITE ####....  ; bitmap literal, 8 or 16 pixels wide
+//	        ORG #300
+//	        INCLUDE "other.asm"
+//	        MACRO name a, b  ; invoked as: name V1, 2
+//	        ENDM
+//
+// Labels in macros may contain \@, which is replaced by a number unique to
+// every expansion.
+
+type macro struct {
+	params []string
+	body   []string // lines of native macros
+	tokens []token  // tokens of Octo macros
+	pos    Pos
+}
+
+type nativeParser struct {
+	a        *assembler
+	defining *macro // macro whose body is being collected
+	depth    int
+}
+
+func (a *assembler) parseNative(name, src string) {
+	p := &nativeParser{a: a}
+	for i, line := range strings.Split(src, "\n") {
+		p.line(Pos{name, i + 1}, line)
+	}
+	if p.defining != nil {
+		a.errorf(p.defining.pos, "MACRO without ENDM")
+	}
+}
+
+// stripComment removes a ; comment outside of quotes.
+func stripComment(line string) string {
+	quote := rune(0)
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ';':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// splitOperands splits at commas outside of quotes and parentheses.
+func splitOperands(s string) []string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	var ops []string
+	quote, depth, start := rune(0), 0, 0
+	for i, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			ops = append(ops, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(ops, strings.TrimSpace(s[start:]))
+}
+
+func (p *nativeParser) line(pos Pos, line string) {
+	a := p.a
+	text := strings.TrimSpace(stripComment(line))
+
+	if p.defining != nil {
+		if strings.EqualFold(text, "ENDM") {
+			p.defining = nil
+		} else {
+			p.defining.body = append(p.defining.body, line)
+		}
+		return
+	}
+	if text == "" {
+		return
+	}
+
+	// label:
+	if i := strings.IndexByte(text, ':'); i > 0 && isName(text[:i]) && !strings.ContainsAny(text[:i], " \t") {
+		a.label(pos, text[:i])
+		text = strings.TrimSpace(text[i+1:])
+		if text == "" {
+			return
+		}
+	}
+
+	fields := strings.Fields(text)
+	// name EQU expr, name = expr
+	if len(fields) >= 3 && (strings.EqualFold(fields[1], "EQU") || fields[1] == "=") {
+		rest := strings.TrimSpace(text[len(fields[0]):])
+		rest = strings.TrimSpace(rest[len(fields[1]):])
+		e, err := parseExprString(rest)
+		if err != nil {
+			a.errorf(pos, "%v", err)
+			return
+		}
+		a.constant(pos, fields[0], e)
+		return
+	}
+
+	mnemonic := strings.ToUpper(fields[0])
+	operands := strings.TrimSpace(text[len(fields[0]):])
+	if m, ok := p.a.macros[fields[0]]; ok {
+		p.expand(pos, m, splitOperands(operands))
+		return
+	}
+
+	switch mnemonic {
+	case "MACRO":
+		p.macro(pos, operands)
+	case "ENDM":
+		a.errorf(pos, "ENDM without MACRO")
+	case "INCLUDE":
+		name, err := strconv.Unquote(operands)
+		if err != nil {
+			a.errorf(pos, "INCLUDE expects a quoted file name")
+			return
+		}
+		a.include(pos, name)
+	case "ORG":
+		p.org(pos, operands)
+	case "DB", "BYTE":
+		p.data(pos, splitOperands(operands), 1)
+	case "DW", "WORD":
+		p.data(pos, splitOperands(operands), 2)
+	case "SPRITE":
+		p.sprite(pos, operands)
+	default:
+		p.instruction(pos, mnemonic, splitOperands(operands))
+	}
+}
+
+func (p *nativeParser) macro(pos Pos, operands string) {
+	fields := strings.Fields(operands)
+	if len(fields) == 0 {
+		p.a.errorf(pos, "MACRO expects a name")
+		return
+	}
+	name := fields[0]
+	if _, ok := p.a.macros[name]; ok {
+		p.a.errorf(pos, "macro %s redefined", name)
+	}
+	m := &macro{params: splitOperands(strings.TrimSpace(operands[len(name):])), pos: pos}
+	p.a.macros[name] = m
+	p.defining = m
+}
+
+func (p *nativeParser) expand(pos Pos, m *macro, args []string) {
+	if len(args) != len(m.params) {
+		p.a.errorf(pos, "macro expects %d arguments, got %d", len(m.params), len(args))
+		return
+	}
+	if p.depth >= maxDepth {
+		p.a.errorf(pos, "macros nested too deeply")
+		return
+	}
+	p.a.expansions++
+	p.depth++
+	defer func() { p.depth-- }()
+
+	unique := strconv.Itoa(p.a.expansions)
+	for _, line := range m.body {
+		line = replaceWords(line, m.params, args)
+		line = strings.ReplaceAll(line, `\@`, unique)
+		// the code of the expansion belongs to the invocation
+		p.line(pos, line)
+	}
+}
+
+// replaceWords replaces whole words of names by values.
+func replaceWords(s string, names, values []string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		if !isWordChar(s[i]) {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(s) && isWordChar(s[j]) {
+			j++
+		}
+		word := s[i:j]
+		for k, name := range names {
+			if word == name {
+				word = values[k]
+				break
+			}
+		}
+		b.WriteString(word)
+		i = j
+	}
+	return b.String()
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func (p *nativeParser) org(pos Pos, operands string) {
+	e, err := parseExprString(operands)
+	if err == nil {
+		var v int
+		if v, err = p.a.value(e, 0, 0xffff, "address"); err == nil {
+			p.a.addr = v
+			return
+		}
+	}
+	p.a.errorf(pos, "ORG: %v", err)
+}
+
+func (p *nativeParser) data(pos Pos, operands []string, size int) {
+	a := p.a
+	if len(operands) == 0 {
+		a.errorf(pos, "missing data")
+		return
+	}
+
+	var values []expr
+	for _, op := range operands {
+		if s, err := strconv.Unquote(op); err == nil && strings.HasPrefix(op, `"`) {
+			for _, c := range []byte(s) {
+				values = append(values, numExpr(c))
+			}
+			continue
+		}
+		e, err := parseExprString(op)
+		if err != nil {
+			a.errorf(pos, "%v", err)
+			return
+		}
+		values = append(values, e)
+	}
+
+	a.emit(pos, size*len(values), func() ([]byte, error) {
+		var data []byte
+		for _, e := range values {
+			if size == 1 {
+				v, err := a.byte8(e)
+				if err != nil {
+					return nil, err
+				}
+				data = append(data, byte(v))
+			} else {
+				v, err := a.value(e, -0x8000, 0xffff, "word")
+				if err != nil {
+					return nil, err
+				}
+				data = append(data, byte(v>>8), byte(v))
+			}
+		}
+		return data, nil
+	})
+}
+
+// parseBitmap parses a bitmap literal of 8 or 16 pixels, # X x * 1 are set.
+func parseBitmap(s string) ([]byte, error) {
+	if len(s) != 8 && len(s) != 16 {
+		return nil, fmt.Errorf("bitmap %q is not 8 or 16 pixels wide", s)
+	}
+	data := make([]byte, len(s)/8)
+	for i, c := range s {
+		switch c {
+		case '#', 'X', 'x', '*', '1':
+			data[i/8] |= 0x80 >> (i % 8)
+		case '.', '_', '0', '-':
+		default:
+			return nil, fmt.Errorf("invalid pixel %q in bitmap %q", c, s)
+		}
+	}
+	return data, nil
+}
+
+func (p *nativeParser) sprite(pos Pos, operands string) {
+	var data []byte
+	for _, row := range strings.Fields(operands) {
+		b, err := parseBitmap(row)
+		if err != nil {
+			p.a.errorf(pos, "%v", err)
+			return
+		}
+		data = append(data, b...)
+	}
+	if len(data) == 0 {
+		p.a.errorf(pos, "SPRITE expects a bitmap")
+		return
+	}
+	p.a.emit(pos, len(data), func() ([]byte, error) { return data, nil })
+}
+
+// Kinds of operands
+const (
+	opExpr  = iota // number or label
+	opReg          // Vx
+	opRange        // Vx-Vy
+	opLong         // LONG addr
+	opI            // I
+	opIndI         // [I]
+	opDT
+	opST
+	opK
+	opF
+	opHF
+	opB
+	opR
+)
+
+type operand struct {
+	kind int
+	x, y uint16
+	e    expr
+}
+
+var namedOperands = map[string]int{
+	"I": opI, "[I]": opIndI, "DT": opDT, "ST": opST, "K": opK,
+	"F": opF, "HF": opHF, "B": opB, "R": opR,
+}
+
+func parseRegister(s string) (uint16, bool) {
+	if len(s) != 2 || (s[0] != 'V' && s[0] != 'v') {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(s[1:], 16, 4)
+	return uint16(n), err == nil
+}
+
+func parseOperand(s string) (operand, error) {
+	upper := strings.ToUpper(s)
+	if kind, ok := namedOperands[upper]; ok {
+		return operand{kind: kind}, nil
+	}
+	if x, ok := parseRegister(s); ok {
+		return operand{kind: opReg, x: x}, nil
+	}
+	if from, to, ok := strings.Cut(s, "-"); ok {
+		x, okx := parseRegister(strings.TrimSpace(from))
+		y, oky := parseRegister(strings.TrimSpace(to))
+		if okx && oky {
+			return operand{kind: opRange, x: x, y: y}, nil
+		}
+	}
+	if strings.HasPrefix(upper, "LONG ") {
+		e, err := parseExprString(s[5:])
+		return operand{kind: opLong, e: e}, err
+	}
+	e, err := parseExprString(s)
+	return operand{kind: opExpr, e: e}, err
+}
+
+// Operand patterns of the instructions
+var operandNames = map[int]string{
+	opExpr: "n", opReg: "V", opRange: "V-V", opLong: "LONG", opI: "I", opIndI: "[I]",
+	opDT: "DT", opST: "ST", opK: "K", opF: "F", opHF: "HF", opB: "B", opR: "R",
+}
+
+func (p *nativeParser) instruction(pos Pos, mnemonic string, args []string) {
+	a := p.a
+	ops := make([]operand, len(args))
+	pattern := make([]string, len(args))
+	for i, arg := range args {
+		op, err := parseOperand(arg)
+		if err != nil {
+			a.errorf(pos, "%s: %v", mnemonic, err)
+			return
+		}
+		ops[i] = op
+		pattern[i] = operandNames[op.kind]
+	}
+	form := strings.TrimSpace(mnemonic + " " + strings.Join(pattern, ","))
+
+	// register operands
+	var x, y uint16
+	if len(ops) > 0 {
+		x = ops[0].x
+	}
+	if len(ops) > 1 {
+		y = ops[1].x
+	}
+	fixed := func(op uint16) {
+		a.emitOp(pos, func() (uint16, error) { return op, nil })
+	}
+	withAddr := func(op uint16, e expr) {
+		a.emitOp(pos, func() (uint16, error) {
+			nnn, err := a.addr12(e)
+			return op | nnn, err
+		})
+	}
+	withByte := func(op uint16, e expr) {
+		a.emitOp(pos, func() (uint16, error) {
+			kk, err := a.byte8(e)
+			return op | kk, err
+		})
+	}
+	withNibble := func(op uint16, e expr) {
+		a.emitOp(pos, func() (uint16, error) {
+			n, err := a.nibble(e)
+			return op | n, err
+		})
+	}
+
+	switch form {
+	case "CLS":
+		fixed(0x00e0)
+	case "RET":
+		fixed(0x00ee)
+	case "SCR":
+		fixed(0x00fb)
+	case "SCL":
+		fixed(0x00fc)
+	case "EXIT":
+		fixed(0x00fd)
+	case "LOW":
+		fixed(0x00fe)
+	case "HIGH":
+		fixed(0x00ff)
+	case "AUDIO":
+		fixed(0xf002)
+	case "SCD n":
+		withNibble(0x00c0, ops[0].e)
+	case "SCU n":
+		withNibble(0x00d0, ops[0].e)
+	case "SYS n":
+		withAddr(0x0000, ops[0].e)
+	case "JP n":
+		withAddr(0x1000, ops[0].e)
+	case "CALL n":
+		withAddr(0x2000, ops[0].e)
+	case "SE V,n":
+		withByte(0x3000|x<<8, ops[1].e)
+	case "SNE V,n":
+		withByte(0x4000|x<<8, ops[1].e)
+	case "SE V,V":
+		fixed(0x5000 | x<<8 | y<<4)
+	case "LD [I],V-V":
+		fixed(0x5002 | ops[1].x<<8 | ops[1].y<<4)
+	case "LD V-V,[I]":
+		fixed(0x5003 | ops[0].x<<8 | ops[0].y<<4)
+	case "LD V,n":
+		withByte(0x6000|x<<8, ops[1].e)
+	case "ADD V,n":
+		withByte(0x7000|x<<8, ops[1].e)
+	case "LD V,V":
+		fixed(0x8000 | x<<8 | y<<4)
+	case "OR V,V":
+		fixed(0x8001 | x<<8 | y<<4)
+	case "AND V,V":
+		fixed(0x8002 | x<<8 | y<<4)
+	case "XOR V,V":
+		fixed(0x8003 | x<<8 | y<<4)
+	case "ADD V,V":
+		fixed(0x8004 | x<<8 | y<<4)
+	case "SUB V,V":
+		fixed(0x8005 | x<<8 | y<<4)
+	case "SHR V":
+		fixed(0x8006 | x<<8 | x<<4)
+	case "SHR V,V":
+		fixed(0x8006 | x<<8 | y<<4)
+	case "SUBN V,V":
+		fixed(0x8007 | x<<8 | y<<4)
+	case "SHL V":
+		fixed(0x800e | x<<8 | x<<4)
+	case "SHL V,V":
+		fixed(0x800e | x<<8 | y<<4)
+	case "SNE V,V":
+		fixed(0x9000 | x<<8 | y<<4)
+	case "LD I,n":
+		withAddr(0xa000, ops[1].e)
+	case "LD I,LONG":
+		e := ops[1].e
+		a.emit(pos, 4, func() ([]byte, error) {
+			v, err := a.addr16(e)
+			return []byte{0xf0, 0x00, byte(v >> 8), byte(v)}, err
+		})
+	case "JP V,n":
+		if x != 0 {
+			a.errorf(pos, "JP expects V0 as register")
+			return
+		}
+		withAddr(0xb000, ops[1].e)
+	case "RND V,n":
+		withByte(0xc000|x<<8, ops[1].e)
+	case "DRW V,V,n":
+		withNibble(0xd000|x<<8|y<<4, ops[2].e)
+	case "SKP V":
+		fixed(0xe09e | x<<8)
+	case "SKNP V":
+		fixed(0xe0a1 | x<<8)
+	case "PLANE n":
+		a.emitOp(pos, func() (uint16, error) {
+			n, err := a.value(ops[0].e, 0, 3, "plane")
+			return 0xf001 | uint16(n)<<8, err
+		})
+	case "LD V,DT":
+		fixed(0xf007 | x<<8)
+	case "LD V,K":
+		fixed(0xf00a | x<<8)
+	case "LD DT,V":
+		fixed(0xf015 | y<<8)
+	case "LD ST,V":
+		fixed(0xf018 | y<<8)
+	case "ADD I,V":
+		fixed(0xf01e | y<<8)
+	case "LD F,V":
+		fixed(0xf029 | y<<8)
+	case "LD HF,V":
+		fixed(0xf030 | y<<8)
+	case "LD B,V":
+		fixed(0xf033 | y<<8)
+	case "PITCH V":
+		fixed(0xf03a | x<<8)
+	case "LD [I],V":
+		fixed(0xf055 | y<<8)
+	case "LD V,[I]":
+		fixed(0xf065 | x<<8)
+	case "LD R,V":
+		fixed(0xf075 | y<<8)
+	case "LD V,R":
+		fixed(0xf085 | x<<8)
+	default:
+		if len(args) == 0 {
+			a.errorf(pos, "unknown instruction %s", mnemonic)
+		} else {
+			a.errorf(pos, "unknown instruction %s %s", mnemonic, strings.Join(args, ", "))
+		}
+	}
+}
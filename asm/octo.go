@@ -0,0 +1,655 @@
+package asm
+
+import "strings"
+
+// Octo syntax, as written by the disassembler and https://johnearnest.github.io/Octo/.
+// Supported are all statements, control flow (if then, if begin else end,
+// loop while again), :const, :alias, :calc, :byte, :org, :macro, :unpack and
+// :call. As an extension, :include "file" assembles another Octo file.
+// :breakpoint and :monitor are accepted and ignored.
+
+type token struct {
+	text string
+	pos  Pos
+}
+
+type octoParser struct {
+	a      *assembler
+	tokens []token
+	next   int
+	flow   []*block
+	depth  int
+	main   bool // jump to main at the start of the program
+}
+
+// block is an open if begin or loop
+type block struct {
+	pos    Pos
+	loop   bool
+	start  int    // address of the loop
+	jump   *int   // target of the jump over the then or else branch
+	exits  []*int // targets of while
+	isElse bool
+}
+
+func tokenize(file, src string) []token {
+	var tokens []token
+	for i, line := range strings.Split(src, "\n") {
+		if c := strings.IndexByte(line, '#'); c >= 0 {
+			line = line[:c]
+		}
+		for _, f := range strings.Fields(line) {
+			tokens = append(tokens, token{f, Pos{file, i + 1}})
+		}
+	}
+	return tokens
+}
+
+func (a *assembler) parseOcto(name, src string) {
+	p := &octoParser{
+		a:      a,
+		tokens: tokenize(name, src),
+	}
+	// Octo starts executing at main
+	p.main = len(a.includes) == 1 && p.definesMain()
+
+	for !p.done() {
+		p.statement()
+	}
+	for _, b := range p.flow {
+		if b.loop {
+			a.errorf(b.pos, "loop without again")
+		} else {
+			a.errorf(b.pos, "begin without end")
+		}
+	}
+}
+
+func (p *octoParser) definesMain() bool {
+	for i := 0; i+1 < len(p.tokens); i++ {
+		if p.tokens[i].text == ":" && p.tokens[i+1].text == "main" {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *octoParser) done() bool {
+	return p.next >= len(p.tokens)
+}
+
+func (p *octoParser) peek() string {
+	if p.done() {
+		return ""
+	}
+	return p.tokens[p.next].text
+}
+
+func (p *octoParser) pos() Pos {
+	if p.done() {
+		if len(p.tokens) == 0 {
+			return Pos{}
+		}
+		return p.tokens[len(p.tokens)-1].pos
+	}
+	return p.tokens[p.next].pos
+}
+
+// errSkip is raised by the parser to abandon the current statement.
+type errSkip struct{}
+
+func (p *octoParser) fail(pos Pos, format string, args ...any) {
+	p.a.errorf(pos, format, args...)
+	panic(errSkip{})
+}
+
+func (p *octoParser) take() token {
+	if p.done() {
+		p.fail(p.pos(), "unexpected end of file")
+	}
+	t := p.tokens[p.next]
+	p.next++
+	return t
+}
+
+func (p *octoParser) expect(text string) {
+	if t := p.take(); t.text != text {
+		p.fail(t.pos, "expected %s, found %s", text, t.text)
+	}
+}
+
+func (p *octoParser) register() uint16 {
+	t := p.take()
+	if x, ok := p.isRegister(t.text); ok {
+		return x
+	}
+	p.fail(t.pos, "expected a register, found %s", t.text)
+	return 0
+}
+
+func (p *octoParser) isRegister(s string) (uint16, bool) {
+	if x, ok := p.a.aliases[s]; ok {
+		return x, true
+	}
+	return parseRegister(s)
+}
+
+// value parses a number, a name or a { calculation }.
+func (p *octoParser) value() expr {
+	t := p.take()
+	if t.text == "{" {
+		return p.calc(t.pos)
+	}
+	e, err := parseExprString(t.text)
+	if err != nil {
+		p.fail(t.pos, "%v", err)
+	}
+	return e
+}
+
+// calc parses the expression up to the closing brace.
+func (p *octoParser) calc(pos Pos) expr {
+	var parts []string
+	for {
+		t := p.take()
+		if t.text == "}" {
+			break
+		}
+		parts = append(parts, t.text)
+	}
+	e, err := parseExprString(strings.Join(parts, " "))
+	if err != nil {
+		p.fail(pos, "%v", err)
+	}
+	return e
+}
+
+func (p *octoParser) name() token {
+	t := p.take()
+	if !isName(t.text) {
+		p.fail(t.pos, "invalid name %q", t.text)
+	}
+	return t
+}
+
+func (p *octoParser) op(pos Pos, op uint16) {
+	p.a.emitOp(pos, func() (uint16, error) { return op, nil })
+}
+
+func (p *octoParser) jump(pos Pos, op uint16, target expr) {
+	a := p.a
+	a.emitOp(pos, func() (uint16, error) {
+		nnn, err := a.addr12(target)
+		return op | nnn, err
+	})
+}
+
+// patchJump emits a jump to an address that is set later.
+func (p *octoParser) patchJump(pos Pos) *int {
+	target := new(int)
+	a := p.a
+	a.emitOp(pos, func() (uint16, error) {
+		nnn, err := a.addr12(numExpr(*target))
+		return 0x1000 | nnn, err
+	})
+	return target
+}
+
+func (p *octoParser) statement() {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(errSkip); !ok {
+				panic(r)
+			}
+		}
+	}()
+
+	a := p.a
+	t := p.take()
+	pos := t.pos
+
+	// jump to main before the first code, unless main is the first label
+	if p.main {
+		switch t.text {
+		case ":const", ":calc", ":alias", ":macro":
+		default:
+			p.main = false
+			if t.text != ":" || p.peek() != "main" {
+				p.jump(pos, 0x1000, symExpr("main"))
+			}
+		}
+	}
+
+	if x, ok := p.isRegister(t.text); ok {
+		p.assignRegister(pos, x)
+		return
+	}
+	if m, ok := p.a.macros[t.text]; ok {
+		p.expand(pos, m)
+		return
+	}
+
+	switch t.text {
+	case ":":
+		a.label(pos, p.name().text)
+	case ":const":
+		name := p.name()
+		a.constant(pos, name.text, p.value())
+	case ":calc":
+		name := p.name()
+		p.expect("{")
+		a.constant(pos, name.text, p.calc(pos))
+	case ":alias":
+		name := p.name()
+		if t := p.peek(); t == "{" {
+			p.fail(pos, ":alias only supports registers")
+		}
+		p.a.aliases[name.text] = p.register()
+	case ":org":
+		v, err := a.value(p.value(), 0, 0xffff, "address")
+		if err != nil {
+			p.fail(pos, ":org: %v", err)
+		}
+		a.addr = v
+	case ":byte":
+		p.byteValue(pos, p.value())
+	case ":call":
+		p.jump(pos, 0x2000, p.value())
+	case ":unpack":
+		hi, target := p.value(), p.value()
+		a.emitOp(pos, func() (uint16, error) {
+			n, err := a.nibble(hi)
+			if err != nil {
+				return 0, err
+			}
+			addr, err := a.addr12(target)
+			return 0x6000 | n<<4 | addr>>8, err
+		})
+		a.emitOp(pos, func() (uint16, error) {
+			addr, err := a.addr12(target)
+			return 0x6100 | addr&0xff, err
+		})
+	case ":macro":
+		p.macro(pos)
+	case ":include":
+		name := p.take()
+		if len(name.text) < 2 || name.text[0] != '"' || name.text[len(name.text)-1] != '"' {
+			p.fail(pos, ":include expects a quoted file name")
+		}
+		a.include(pos, name.text[1:len(name.text)-1])
+	case ":breakpoint":
+		p.take()
+	case ":monitor":
+		p.value()
+		p.value()
+	case "clear":
+		p.op(pos, 0x00e0)
+	case "return", ";":
+		p.op(pos, 0x00ee)
+	case "scroll-right":
+		p.op(pos, 0x00fb)
+	case "scroll-left":
+		p.op(pos, 0x00fc)
+	case "exit":
+		p.op(pos, 0x00fd)
+	case "lores":
+		p.op(pos, 0x00fe)
+	case "hires":
+		p.op(pos, 0x00ff)
+	case "audio":
+		p.op(pos, 0xf002)
+	case "scroll-down", "scroll-up":
+		op := uint16(0x00c0)
+		if t.text == "scroll-up" {
+			op = 0x00d0
+		}
+		n := p.value()
+		a.emitOp(pos, func() (uint16, error) {
+			v, err := a.nibble(n)
+			return op | v, err
+		})
+	case "jump":
+		p.jump(pos, 0x1000, p.value())
+	case "jump0":
+		p.jump(pos, 0xb000, p.value())
+	case "i":
+		p.assignI(pos)
+	case "delay", "buzzer", "pitch":
+		p.expect(":=")
+		x := p.register()
+		p.op(pos, map[string]uint16{"delay": 0xf015, "buzzer": 0xf018, "pitch": 0xf03a}[t.text]|x<<8)
+	case "sprite":
+		x, y := p.register(), p.register()
+		n := p.value()
+		a.emitOp(pos, func() (uint16, error) {
+			v, err := a.nibble(n)
+			return 0xd000 | x<<8 | y<<4 | v, err
+		})
+	case "bcd":
+		p.op(pos, 0xf033|p.register()<<8)
+	case "save", "load":
+		x := p.register()
+		if p.peek() == "-" {
+			p.take()
+			y := p.register()
+			op := uint16(0x5002)
+			if t.text == "load" {
+				op = 0x5003
+			}
+			p.op(pos, op|x<<8|y<<4)
+			return
+		}
+		op := uint16(0xf055)
+		if t.text == "load" {
+			op = 0xf065
+		}
+		p.op(pos, op|x<<8)
+	case "saveflags":
+		p.op(pos, 0xf075|p.register()<<8)
+	case "loadflags":
+		p.op(pos, 0xf085|p.register()<<8)
+	case "plane":
+		n := p.value()
+		a.emitOp(pos, func() (uint16, error) {
+			v, err := a.value(n, 0, 3, "plane")
+			return 0xf001 | uint16(v)<<8, err
+		})
+	case "if":
+		p.conditional(pos)
+	case "else":
+		p.elseBranch(pos)
+	case "end":
+		p.end(pos)
+	case "loop":
+		p.flow = append(p.flow, &block{pos: pos, loop: true, start: a.addr})
+	case "while":
+		b := p.innerLoop(pos, "while")
+		// skip the jump out of the loop while the condition holds
+		p.a.emitOp(pos, p.condition(true))
+		b.exits = append(b.exits, p.patchJump(pos))
+	case "again":
+		b := p.innerLoop(pos, "again")
+		p.flow = p.flow[:len(p.flow)-1]
+		p.jump(pos, 0x1000, numExpr(b.start))
+		for _, exit := range b.exits {
+			*exit = a.addr
+		}
+	case "{":
+		p.byteValue(pos, p.calc(pos))
+	default:
+		if _, ok := parseNumber(t.text); ok || strings.HasPrefix(t.text, "-") {
+			e, err := parseExprString(t.text)
+			if err != nil {
+				p.fail(pos, "%v", err)
+			}
+			p.byteValue(pos, e)
+			return
+		}
+		if !isName(t.text) {
+			p.fail(pos, "unexpected %s", t.text)
+		}
+		// a constant emits its value, anything else is a call
+		if s, ok := a.symbols[t.text]; ok && !s.label {
+			p.byteValue(pos, symExpr(t.text))
+			return
+		}
+		p.jump(pos, 0x2000, symExpr(t.text))
+	}
+}
+
+func (p *octoParser) byteValue(pos Pos, e expr) {
+	a := p.a
+	a.emit(pos, 1, func() ([]byte, error) {
+		v, err := a.byte8(e)
+		return []byte{byte(v)}, err
+	})
+}
+
+func (p *octoParser) assignRegister(pos Pos, x uint16) {
+	a := p.a
+	t := p.take()
+	switch t.text {
+	case ":=":
+		switch src := p.peek(); src {
+		case "delay":
+			p.take()
+			p.op(pos, 0xf007|x<<8)
+			return
+		case "key":
+			p.take()
+			p.op(pos, 0xf00a|x<<8)
+			return
+		case "random":
+			p.take()
+			mask := p.value()
+			a.emitOp(pos, func() (uint16, error) {
+				kk, err := a.byte8(mask)
+				return 0xc000 | x<<8 | kk, err
+			})
+			return
+		}
+	case ">>=", "<<=", "|=", "&=", "^=", "=-":
+	case "+=", "-=":
+	default:
+		p.fail(t.pos, "unknown operator %s", t.text)
+	}
+
+	if y, ok := p.isRegister(p.peek()); ok {
+		p.take()
+		n := map[string]uint16{
+			":=": 0, "|=": 1, "&=": 2, "^=": 3, "+=": 4,
+			"-=": 5, ">>=": 6, "=-": 7, "<<=": 0xe,
+		}[t.text]
+		p.op(pos, 0x8000|x<<8|y<<4|n)
+		return
+	}
+
+	var op uint16
+	switch t.text {
+	case ":=":
+		op = 0x6000
+	case "+=", "-=":
+		op = 0x7000
+	default:
+		p.fail(t.pos, "%s expects a register", t.text)
+	}
+	e := p.value()
+	if t.text == "-=" {
+		e = unaryExpr{"-", e}
+	}
+	a.emitOp(pos, func() (uint16, error) {
+		kk, err := a.byte8(e)
+		return op | x<<8 | kk, err
+	})
+}
+
+func (p *octoParser) assignI(pos Pos) {
+	a := p.a
+	switch t := p.take(); t.text {
+	case ":=":
+	case "+=":
+		p.op(pos, 0xf01e|p.register()<<8)
+		return
+	default:
+		p.fail(t.pos, "unknown operator %s", t.text)
+	}
+
+	switch p.peek() {
+	case "hex":
+		p.take()
+		p.op(pos, 0xf029|p.register()<<8)
+	case "bighex":
+		p.take()
+		p.op(pos, 0xf030|p.register()<<8)
+	case "long":
+		p.take()
+		e := p.value()
+		a.emit(pos, 4, func() ([]byte, error) {
+			v, err := a.addr16(e)
+			return []byte{0xf0, 0x00, byte(v >> 8), byte(v)}, err
+		})
+	default:
+		p.jump(pos, 0xa000, p.value())
+	}
+}
+
+// condition parses a condition and returns the encoder of the instruction that
+// skips if it holds, or if it does not hold when skipIfTrue is false.
+func (p *octoParser) condition(skipIfTrue bool) func() (uint16, error) {
+	a := p.a
+	x := p.register()
+	fixed := func(op uint16) func() (uint16, error) {
+		return func() (uint16, error) { return op, nil }
+	}
+	t := p.take()
+
+	var eq bool // condition holds if the operands are equal
+	switch t.text {
+	case "key", "-key":
+		// EX9E skips if the key is pressed
+		if (t.text == "key") == skipIfTrue {
+			return fixed(0xe09e | x<<8)
+		}
+		return fixed(0xe0a1 | x<<8)
+	case "==":
+		eq = true
+	case "!=":
+	default:
+		p.fail(t.pos, "unsupported condition %s", t.text)
+	}
+
+	skipIfEqual := eq == skipIfTrue
+	if y, ok := p.isRegister(p.peek()); ok {
+		p.take()
+		if skipIfEqual {
+			return fixed(0x5000 | x<<8 | y<<4)
+		}
+		return fixed(0x9000 | x<<8 | y<<4)
+	}
+
+	op := uint16(0x4000)
+	if skipIfEqual {
+		op = 0x3000
+	}
+	e := p.value()
+	return func() (uint16, error) {
+		kk, err := a.byte8(e)
+		return op | x<<8 | kk, err
+	}
+}
+
+func (p *octoParser) conditional(pos Pos) {
+	// the condition is parsed before the keyword that follows it
+	start := p.next
+	for !p.done() && p.peek() != "then" && p.peek() != "begin" {
+		p.take()
+	}
+	keyword := p.take().text
+	end := p.next
+	p.next = start
+	defer func() { p.next = end }()
+
+	if keyword == "then" {
+		// skip the next statement if the condition does not hold
+		p.a.emitOp(pos, p.condition(false))
+	} else {
+		p.a.emitOp(pos, p.condition(true))
+		p.flow = append(p.flow, &block{pos: pos, jump: p.patchJump(pos)})
+	}
+	if p.next != end-1 {
+		p.fail(pos, "invalid condition")
+	}
+}
+
+func (p *octoParser) innerBlock(pos Pos, keyword string) *block {
+	if len(p.flow) == 0 || p.flow[len(p.flow)-1].loop {
+		p.fail(pos, "%s without begin", keyword)
+	}
+	return p.flow[len(p.flow)-1]
+}
+
+func (p *octoParser) innerLoop(pos Pos, keyword string) *block {
+	for i := len(p.flow) - 1; i >= 0; i-- {
+		if p.flow[i].loop {
+			if keyword == "again" && i != len(p.flow)-1 {
+				p.fail(pos, "again inside of begin")
+			}
+			return p.flow[i]
+		}
+	}
+	p.fail(pos, "%s without loop", keyword)
+	return nil
+}
+
+func (p *octoParser) elseBranch(pos Pos) {
+	b := p.innerBlock(pos, "else")
+	if b.isElse {
+		p.fail(pos, "else after else")
+	}
+	jump := p.patchJump(pos)
+	*b.jump = p.a.addr
+	b.jump, b.isElse = jump, true
+}
+
+func (p *octoParser) end(pos Pos) {
+	b := p.innerBlock(pos, "end")
+	*b.jump = p.a.addr
+	p.flow = p.flow[:len(p.flow)-1]
+}
+
+func (p *octoParser) macro(pos Pos) {
+	name := p.name()
+	m := &macro{pos: pos}
+	for p.peek() != "{" {
+		m.params = append(m.params, p.name().text)
+	}
+	p.take()
+	for depth := 1; ; {
+		t := p.take()
+		switch t.text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+		if depth == 0 {
+			break
+		}
+		m.tokens = append(m.tokens, t)
+	}
+	if _, ok := p.a.macros[name.text]; ok {
+		p.fail(pos, "macro %s redefined", name.text)
+	}
+	p.a.macros[name.text] = m
+}
+
+// expand inserts the body of the macro into the token stream, the code of the
+// expansion belongs to the invocation.
+func (p *octoParser) expand(pos Pos, m *macro) {
+	if p.depth >= maxDepth {
+		p.fail(pos, "macros nested too deeply")
+	}
+	args := map[string]string{}
+	for _, param := range m.params {
+		args[param] = p.take().text
+	}
+
+	body := make([]token, len(m.tokens))
+	for i, t := range m.tokens {
+		if arg, ok := args[t.text]; ok {
+			t.text = arg
+		}
+		body[i] = token{t.text, pos}
+	}
+
+	rest := p.tokens[p.next:]
+	p.tokens = append(append(p.tokens[:p.next:p.next], body...), rest...)
+	p.depth++
+	end := p.next + len(body)
+	for p.next < end && !p.done() {
+		before := len(p.tokens)
+		p.statement()
+		end += len(p.tokens) - before
+	}
+	p.depth--
+}
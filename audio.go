@@ -0,0 +1,57 @@
+package chip8
+
+import (
+	"io"
+	"os"
+)
+
+// Pitch that plays the XO-CHIP audio pattern at 4000 bits per second
+const DefaultPitch = 64
+
+type Audio interface {
+	Init() error
+	Close()
+	// Start turns the beeper on, called when the sound timer becomes non-zero.
+	Start()
+	// Stop turns the beeper off, called when the sound timer reaches zero.
+	Stop()
+	// Tick advances the audio output by one timer period (1/60s).
+	Tick()
+	// SetPattern replaces the tone by an XO-CHIP audio pattern of 128 bits,
+	// played at 4000*2^((pitch-64)/48) bits per second.
+	SetPattern(pattern [16]byte, pitch byte)
+}
+
+// AudioNull discards all sound.
+type AudioNull struct{}
+
+func (a *AudioNull) Init() error { return nil }
+func (a *AudioNull) Close()      {}
+func (a *AudioNull) Start()      {}
+func (a *AudioNull) Stop()       {}
+func (a *AudioNull) Tick()       {}
+
+func (a *AudioNull) SetPattern(pattern [16]byte, pitch byte) {}
+
+// AudioBell rings the terminal bell every time the beeper starts.
+type AudioBell struct {
+	W io.Writer // os.Stdout if nil
+}
+
+func (a *AudioBell) Init() error {
+	if a.W == nil {
+		a.W = os.Stdout
+	}
+	return nil
+}
+
+func (a *AudioBell) Close() {}
+
+func (a *AudioBell) Start() {
+	a.W.Write([]byte{'\a'})
+}
+
+func (a *AudioBell) Stop() {}
+func (a *AudioBell) Tick() {}
+
+func (a *AudioBell) SetPattern(pattern [16]byte, pitch byte) {}
@@ -0,0 +1,113 @@
+package chip8
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+type MockAudio struct {
+	events []string
+	ticks  int
+}
+
+func (a *MockAudio) Init() error { return nil }
+func (a *MockAudio) Close()      {}
+func (a *MockAudio) Start()      { a.events = append(a.events, "start") }
+func (a *MockAudio) Stop()       { a.events = append(a.events, "stop") }
+func (a *MockAudio) Tick()       { a.ticks++ }
+
+func (a *MockAudio) SetPattern(pattern [16]byte, pitch byte) {
+	a.events = append(a.events, "pattern")
+}
+
+func TestBeeper(t *testing.T) {
+	a := &MockAudio{}
+	e, err := CreateEmulator(&MockDisplay{}, &MockInput{}, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// LD V0, 2; LD ST, V0; JP 0x204
+	e.LoadProgram([]byte{0x60, 0x02, 0xf0, 0x18, 0x12, 0x04})
+
+	for i := 0; i < 2; i++ {
+		if err := e.Step(false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(a.events) != 1 || a.events[0] != "start" {
+		t.Errorf("Wrong audio events after LD ST, Vx: %v", a.events)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := e.Step(true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(a.events) != 2 || a.events[1] != "stop" {
+		t.Errorf("Wrong audio events after ST reached 0: %v", a.events)
+	}
+	if a.ticks != 2 {
+		t.Errorf("Wrong audio ticks, expected=%d actual=%d", 2, a.ticks)
+	}
+}
+
+func TestAudioWAV(t *testing.T) {
+	var buf bytes.Buffer
+	a := &AudioWAV{W: &buf, Wave: SquareWave{SampleRate: 8000, Frequency: 1000, Volume: 100}}
+	if err := a.Init(); err != nil {
+		t.Fatal(err)
+	}
+	a.Tick()
+	a.Start()
+	a.Tick()
+	a.Stop()
+	a.Tick()
+	a.Close()
+	if err := a.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+	// 8000/60 = 133.33 samples per tick
+	samples := 133 + 133 + 134
+	if len(data) != wavHeaderSize+2*samples {
+		t.Fatalf("Wrong WAV size, expected=%d actual=%d", wavHeaderSize+2*samples, len(data))
+	}
+	if string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" || string(data[36:40]) != "data" {
+		t.Errorf("Wrong WAV header: % x", data[:wavHeaderSize])
+	}
+
+	pcm := make([]int16, samples)
+	binary.Read(bytes.NewReader(data[wavHeaderSize:]), binary.LittleEndian, pcm)
+	for i, s := range pcm {
+		silent := i < 133 || i >= 266
+		if silent && s != 0 {
+			t.Fatalf("Sample %d should be silent, actual=%d", i, s)
+		}
+		if !silent && s != 100 && s != -100 {
+			t.Fatalf("Sample %d should be a tone, actual=%d", i, s)
+		}
+	}
+	// 8 samples per period at 1000Hz
+	if pcm[133] != 100 || pcm[137] != -100 {
+		t.Errorf("Wrong square wave: %v", pcm[133:141])
+	}
+}
+
+func TestPatternWave(t *testing.T) {
+	w := PatternWave{SampleRate: 8000, Volume: 1, Pitch: DefaultPitch}
+	w.Pattern[0] = 0xa0 // 1010 0000
+	if w.Rate() != 4000 {
+		t.Errorf("Wrong rate, expected=%d actual=%f", 4000, w.Rate())
+	}
+
+	buf := make([]int16, 8)
+	w.Generate(buf, true)
+	expected := []int16{1, 1, -1, -1, 1, 1, -1, -1}
+	for i := range buf {
+		if buf[i] != expected[i] {
+			t.Fatalf("Wrong samples, expected=%v actual=%v", expected, buf)
+		}
+	}
+}
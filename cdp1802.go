@@ -0,0 +1,343 @@
+package chip8
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CDP1802Bus connects a CDP1802 to memory and I/O.
+type CDP1802Bus interface {
+	Read(addr uint16) byte
+	Write(addr uint16, value byte)
+	// Out is OUT 1-7, which puts a byte of memory on the data bus
+	Out(port byte, value byte)
+	// In is INP 1-7, which reads the data bus into memory and D
+	In(port byte) byte
+	// EF returns the state of the flag inputs EF1-EF4
+	EF(n byte) bool
+}
+
+// CDP1802 is the RCA COSMAC CPU of the VIP. Any of its 16 registers can be
+// the program counter (P) or the data pointer (X).
+type CDP1802 struct {
+	R  [16]uint16
+	P  byte // index of the program counter
+	X  byte // index of the data pointer
+	D  byte // accumulator
+	DF bool // carry, not borrow
+	T  byte // X and P saved by an interrupt
+	IE bool // interrupt enable
+	Q  bool // output flip-flop, the tone of the VIP
+
+	Idle bool // waiting for DMA or an interrupt after IDL
+}
+
+// Reset clears I, N, Q, X, P and R0, enables interrupts and leaves the
+// other registers unchanged.
+func (c *CDP1802) Reset() {
+	c.R[0] = 0
+	c.P, c.X = 0, 0
+	c.Q = false
+	c.IE = true
+	c.Idle = false
+}
+
+// Interrupt saves X and P in T, then continues with R1 as the program
+// counter and R2 as the data pointer. Returns the machine cycles taken, 0 if
+// interrupts are disabled.
+func (c *CDP1802) Interrupt() int {
+	if !c.IE {
+		return 0
+	}
+	c.T = c.X<<4 | c.P
+	c.X, c.P = 2, 1
+	c.IE = false
+	c.Idle = false
+	return 1
+}
+
+// fetch reads the byte at the program counter and advances it.
+func (c *CDP1802) fetch(b CDP1802Bus) byte {
+	v := b.Read(c.R[c.P])
+	c.R[c.P]++
+	return v
+}
+
+// add sets D = a + b + carry and DF to the carry out.
+func (c *CDP1802) add(a, b byte, carry bool) {
+	sum := uint16(a) + uint16(b)
+	if carry {
+		sum++
+	}
+	c.D, c.DF = byte(sum), sum > 0xff
+}
+
+// sub sets D = a - b - borrow and DF to not borrow.
+func (c *CDP1802) sub(a, b byte, borrow bool) {
+	c.add(a, ^b, !borrow)
+}
+
+// Step executes one instruction. Returns the machine cycles taken, 2 or 3
+// for the long branches and skips.
+func (c *CDP1802) Step(b CDP1802Bus) int {
+	if c.Idle {
+		return 1
+	}
+	op := c.fetch(b)
+	i, n := op>>4, op&0xf
+	switch i {
+	// 0N - IDL, LDN: load via N
+	case 0x0:
+		if n == 0 {
+			c.Idle = true
+		} else {
+			c.D = b.Read(c.R[n])
+		}
+	// 1N - INC: increment reg N
+	case 0x1:
+		c.R[n]++
+	// 2N - DEC: decrement reg N
+	case 0x2:
+		c.R[n]--
+	// 3N - short branch, 38 SKP skips the byte
+	case 0x3:
+		if c.condition(n, b) {
+			c.R[c.P] = c.R[c.P]&0xff00 | uint16(b.Read(c.R[c.P]))
+		} else {
+			c.R[c.P]++
+		}
+	// 4N - LDA: load advance
+	case 0x4:
+		c.D = b.Read(c.R[n])
+		c.R[n]++
+	// 5N - STR: store via N
+	case 0x5:
+		b.Write(c.R[n], c.D)
+	case 0x6:
+		switch {
+		// 60 - IRX: increment reg X
+		case n == 0:
+			c.R[c.X]++
+		// 61-67 - OUT: output
+		case n < 8:
+			b.Out(n, b.Read(c.R[c.X]))
+			c.R[c.X]++
+		// 68 - no operation on the CDP1802
+		case n == 8:
+		// 69-6F - INP: input
+		default:
+			c.D = b.In(n - 8)
+			b.Write(c.R[c.X], c.D)
+		}
+	case 0x7:
+		c.step7(n, b)
+	// 8N - GLO: get low reg N
+	case 0x8:
+		c.D = byte(c.R[n])
+	// 9N - GHI: get high reg N
+	case 0x9:
+		c.D = byte(c.R[n] >> 8)
+	// AN - PLO: put low reg N
+	case 0xa:
+		c.R[n] = c.R[n]&0xff00 | uint16(c.D)
+	// BN - PHI: put high reg N
+	case 0xb:
+		c.R[n] = c.R[n]&0x00ff | uint16(c.D)<<8
+	// CN - long branch, long skip, C4 NOP
+	case 0xc:
+		c.long(n, b)
+		return 3
+	// DN - SEP: set P
+	case 0xd:
+		c.P = n
+	// EN - SEX: set X
+	case 0xe:
+		c.X = n
+	case 0xf:
+		c.stepF(n, b)
+	}
+	return 2
+}
+
+// condition returns the condition of the short branch 3N.
+func (c *CDP1802) condition(n byte, b CDP1802Bus) bool {
+	var cond bool
+	switch n & 7 {
+	case 0:
+		cond = true
+	case 1:
+		cond = c.Q
+	case 2:
+		cond = c.D == 0
+	case 3:
+		cond = c.DF
+	default:
+		cond = b.EF(n&7 - 3)
+	}
+	// 38-3F branch on the inverse
+	return cond != (n >= 8)
+}
+
+// step7 executes the control and memory-reference arithmetic of 7N.
+func (c *CDP1802) step7(n byte, b CDP1802Bus) {
+	switch n {
+	// 70 - RET, 71 - DIS: return and enable or disable interrupts
+	case 0x0, 0x1:
+		t := b.Read(c.R[c.X])
+		c.R[c.X]++
+		c.X, c.P = t>>4, t&0xf
+		c.IE = n == 0
+	// 72 - LDXA: load via X and advance
+	case 0x2:
+		c.D = b.Read(c.R[c.X])
+		c.R[c.X]++
+	// 73 - STXD: store via X and decrement
+	case 0x3:
+		b.Write(c.R[c.X], c.D)
+		c.R[c.X]--
+	// 74 - ADC: add with carry
+	case 0x4:
+		c.add(b.Read(c.R[c.X]), c.D, c.DF)
+	// 75 - SDB: subtract D with borrow
+	case 0x5:
+		c.sub(b.Read(c.R[c.X]), c.D, !c.DF)
+	// 76 - SHRC: shift right with carry
+	case 0x6:
+		d := c.D
+		c.D = d >> 1
+		if c.DF {
+			c.D |= 0x80
+		}
+		c.DF = d&1 != 0
+	// 77 - SMB: subtract memory with borrow
+	case 0x7:
+		c.sub(c.D, b.Read(c.R[c.X]), !c.DF)
+	// 78 - SAV: save T
+	case 0x8:
+		b.Write(c.R[c.X], c.T)
+	// 79 - MARK: push X, P to the stack
+	case 0x9:
+		c.T = c.X<<4 | c.P
+		b.Write(c.R[2], c.T)
+		c.X = c.P
+		c.R[2]--
+	// 7A - REQ: reset Q
+	case 0xa:
+		c.Q = false
+	// 7B - SEQ: set Q
+	case 0xb:
+		c.Q = true
+	// 7C - ADCI: add with carry, immediate
+	case 0xc:
+		c.add(c.fetch(b), c.D, c.DF)
+	// 7D - SDBI: subtract D with borrow, immediate
+	case 0xd:
+		c.sub(c.fetch(b), c.D, !c.DF)
+	// 7E - SHLC: shift left with carry
+	case 0xe:
+		d := c.D
+		c.D = d << 1
+		if c.DF {
+			c.D |= 1
+		}
+		c.DF = d&0x80 != 0
+	// 7F - SMBI: subtract memory with borrow, immediate
+	case 0xf:
+		c.sub(c.D, c.fetch(b), !c.DF)
+	}
+}
+
+// long executes the long branches and skips of CN.
+func (c *CDP1802) long(n byte, b CDP1802Bus) {
+	var cond bool
+	switch n & 3 {
+	case 0:
+		cond = true
+	case 1:
+		cond = c.Q
+	case 2:
+		cond = c.D == 0
+	case 3:
+		cond = c.DF
+	}
+	skip := n&4 != 0
+	switch {
+	// C4 - NOP
+	case n == 0x4:
+		return
+	// CC - LSIE: long skip if IE = 1
+	case n == 0xc:
+		cond = c.IE
+	// C8-CB branch on the inverse, C5-C7 skip on the inverse
+	case n >= 8 && !skip, n < 8 && skip:
+		cond = !cond
+	}
+	pc := c.R[c.P]
+	switch {
+	case !cond:
+		if !skip {
+			c.R[c.P] += 2
+		}
+	case skip:
+		c.R[c.P] += 2
+	default:
+		c.R[c.P] = uint16(b.Read(pc))<<8 | uint16(b.Read(pc+1))
+	}
+}
+
+// stepF executes the logic and arithmetic of FN, via X or immediate from F8.
+func (c *CDP1802) stepF(n byte, b CDP1802Bus) {
+	var m byte
+	switch {
+	case n == 0x6 || n == 0xe:
+		// shifts take no operand
+	case n < 8:
+		m = b.Read(c.R[c.X])
+	default:
+		m = c.fetch(b)
+	}
+	switch n & 7 {
+	// F0 - LDX: load via X, F8 - LDI: load immediate
+	case 0:
+		c.D = m
+	// F1 - OR, F9 - ORI
+	case 1:
+		c.D |= m
+	// F2 - AND, FA - ANI
+	case 2:
+		c.D &= m
+	// F3 - XOR, FB - XRI
+	case 3:
+		c.D ^= m
+	// F4 - ADD, FC - ADI
+	case 4:
+		c.add(m, c.D, false)
+	// F5 - SD, FD - SDI: subtract D
+	case 5:
+		c.sub(m, c.D, false)
+	// F6 - SHR, FE - SHL: shift right, left
+	case 6:
+		if n == 0x6 {
+			c.DF = c.D&1 != 0
+			c.D >>= 1
+		} else {
+			c.DF = c.D&0x80 != 0
+			c.D <<= 1
+		}
+	// F7 - SM, FF - SMI: subtract memory
+	case 7:
+		c.sub(c.D, m, false)
+	}
+}
+
+func (c *CDP1802) String() string {
+	var b strings.Builder
+	for i, r := range c.R {
+		fmt.Fprintf(&b, "R%X=%04x; ", i, r)
+		if (i+1)%4 == 0 {
+			fmt.Fprintf(&b, "\n")
+		}
+	}
+	fmt.Fprintf(&b, "P=%X; X=%X; D=%02x; DF=%t; T=%02x; IE=%t; Q=%t\n", c.P, c.X, c.D, c.DF, c.T, c.IE, c.Q)
+	return b.String()
+}
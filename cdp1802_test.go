@@ -0,0 +1,86 @@
+package chip8
+
+import "testing"
+
+// MockBus is 64 KiB of memory for the CDP1802 with recorded output.
+type MockBus struct {
+	Memory
+	out []byte
+	ef  [5]bool
+}
+
+func (b *MockBus) Out(port byte, value byte) { b.out = append(b.out, port, value) }
+func (b *MockBus) In(port byte) byte         { return 0x40 | port }
+func (b *MockBus) EF(n byte) bool            { return b.ef[n] }
+
+func TestCDP1802(t *testing.T) {
+	tests := []struct {
+		name  string
+		code  []byte
+		steps int
+		check func(c *CDP1802, b *MockBus) bool
+	}{
+		{"LDI, PHI, PLO", []byte{0xf8, 0x12, 0xb5, 0xf8, 0x34, 0xa5}, 4,
+			func(c *CDP1802, b *MockBus) bool { return c.R[5] == 0x1234 }},
+		{"ADI carry", []byte{0xf8, 0xf0, 0xfc, 0x20}, 2,
+			func(c *CDP1802, b *MockBus) bool { return c.D == 0x10 && c.DF }},
+		{"SMI borrow", []byte{0xf8, 0x10, 0xff, 0x20}, 2,
+			func(c *CDP1802, b *MockBus) bool { return c.D == 0xf0 && !c.DF }},
+		{"SDI no borrow", []byte{0xf8, 0x10, 0xfd, 0x20}, 2,
+			func(c *CDP1802, b *MockBus) bool { return c.D == 0x10 && c.DF }},
+		{"SHL, SHRC", []byte{0xf8, 0x81, 0xfe, 0x76}, 3,
+			func(c *CDP1802, b *MockBus) bool { return c.D == 0x81 && !c.DF }},
+		{"STXD, LDXA", []byte{0xe5, 0xf8, 0x77, 0x73, 0xf8, 0x00, 0x60, 0x72}, 6,
+			func(c *CDP1802, b *MockBus) bool { return c.D == 0x77 && c.R[5] == 1 && b.Memory[0] == 0x77 }},
+		{"BZ taken", []byte{0xf8, 0x00, 0x32, 0x10}, 2,
+			func(c *CDP1802, b *MockBus) bool { return c.R[0] == 0x10 }},
+		{"BNZ not taken", []byte{0xf8, 0x00, 0x3a, 0x10}, 2,
+			func(c *CDP1802, b *MockBus) bool { return c.R[0] == 4 }},
+		{"LBR", []byte{0xc0, 0x12, 0x34}, 1,
+			func(c *CDP1802, b *MockBus) bool { return c.R[0] == 0x1234 }},
+		{"LSNZ skips", []byte{0xf8, 0x01, 0xc6, 0x00, 0x00}, 2,
+			func(c *CDP1802, b *MockBus) bool { return c.R[0] == 5 }},
+		{"SEP", []byte{0xf8, 0x20, 0xa3, 0xd3}, 3,
+			func(c *CDP1802, b *MockBus) bool { return c.P == 3 && c.R[3] == 0x20 }},
+		{"OUT, INP", []byte{0xe0, 0x63, 0x42, 0x6c}, 3,
+			func(c *CDP1802, b *MockBus) bool {
+				return len(b.out) == 2 && b.out[0] == 3 && b.out[1] == 0x42 && c.D == 0x44 && b.Memory[4] == 0x44
+			}},
+		{"MARK, RET", []byte{0xe5, 0xf8, 0x10, 0xa2, 0x79, 0xe2, 0x12, 0x70}, 7,
+			func(c *CDP1802, b *MockBus) bool {
+				return b.Memory[0x10] == 0x50 && c.X == 5 && c.P == 0 && c.R[2] == 0x11 && c.IE
+			}},
+	}
+	for _, test := range tests {
+		b := &MockBus{}
+		b.Load(0, test.code)
+		c := &CDP1802{}
+		c.Reset()
+		for i := 0; i < test.steps; i++ {
+			c.Step(b)
+		}
+		if !test.check(c, b) {
+			t.Errorf("%s:\n%s", test.name, c.String())
+		}
+	}
+}
+
+func TestCDP1802Interrupt(t *testing.T) {
+	b := &MockBus{}
+	// SEX 3; IDL
+	b.Load(0, []byte{0xe3, 0x00})
+	c := &CDP1802{}
+	c.Reset()
+	c.R[1] = 0x100
+	c.Step(b)
+	c.Step(b)
+	if !c.Idle || c.Step(b) != 1 || c.R[0] != 2 {
+		t.Errorf("IDL does not wait:\n%s", c.String())
+	}
+	if c.Interrupt() != 1 || c.Idle || c.T != 0x30 || c.P != 1 || c.X != 2 || c.IE {
+		t.Errorf("Interrupt not taken:\n%s", c.String())
+	}
+	if c.Interrupt() != 0 {
+		t.Errorf("Interrupt taken while disabled")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/debuggerpls/go-chip8/asm"
+)
+
+func assemble(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("asm", flag.ExitOnError)
+	dialect := flags.String("dialect", "", "source dialect: native or octo, by file extension if empty")
+	output := flags.String("o", "", "output file, SOURCE with extension .ch8 if empty")
+	listing := flags.String("l", "", "write a listing to this file")
+	symbols := flags.String("s", "", "write a symbol file to this file")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		return fmt.Errorf("Missing argument: SOURCE")
+	}
+	name := flags.Arg(0)
+
+	opts := asm.Options{Dialect: asm.DialectFor(name)}
+	switch *dialect {
+	case "":
+	case "native":
+		opts.Dialect = asm.DialectNative
+	case "octo":
+		opts.Dialect = asm.DialectOcto
+	default:
+		return fmt.Errorf("unknown dialect %q, expected native or octo", *dialect)
+	}
+
+	src, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	p, err := asm.Assemble(name, src, opts)
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		*output = strings.TrimSuffix(name, filepath.Ext(name)) + ".ch8"
+	}
+	if err := os.WriteFile(*output, p.Code, 0644); err != nil {
+		return err
+	}
+	if *listing != "" {
+		if err := writeFile(*listing, p.WriteListing); err != nil {
+			return err
+		}
+	}
+	if *symbols != "" {
+		if err := writeFile(*symbols, p.WriteSymbols); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile creates the file name and writes it with write.
+func writeFile(name string, write func(w io.Writer) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/debuggerpls/go-chip8/conformance"
+)
+
+func conformanceTests(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("conformance", flag.ExitOnError)
+	frames := flags.Int("frames", 0, fmt.Sprintf("frames of the tests without frames in the manifest (default %d)", conformance.DefaultFrames))
+	update := flags.Bool("update", false, "set the golden hashes and images to the current results")
+	matrix := flags.Bool("matrix", true, "print the pass/fail matrix of the opcodes")
+	flags.Parse(args)
+
+	dir := "."
+	if flags.NArg() > 0 {
+		dir = flags.Arg(0)
+	}
+	suite, err := conformance.Load(dir)
+	if err != nil {
+		return err
+	}
+	if *frames > 0 {
+		suite.Frames = *frames
+	}
+
+	var results []conformance.Result
+	failed := 0
+	for _, t := range suite.Tests {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		r := suite.RunTest(t)
+		if r.Passed() {
+			fmt.Printf("PASS %s\n", t.Name())
+		} else {
+			fmt.Printf("FAIL %s: %v\n", t.Name(), r.Err)
+			failed++
+		}
+		results = append(results, r)
+	}
+	if *matrix {
+		fmt.Println()
+		if err := conformance.WriteMatrix(os.Stdout, results); err != nil {
+			return err
+		}
+	}
+	if *update {
+		if err := suite.Update(results); err != nil {
+			return err
+		}
+		fmt.Printf("Updated the golden results of %d tests\n", len(results))
+		return nil
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tests failed", failed, len(results))
+	}
+	return nil
+}
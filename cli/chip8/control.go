@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/debuggerpls/go-chip8"
+	"github.com/nsf/termbox-go"
+)
+
+// runControls pauses, steps and changes the speed of a running emulator.
+type runControls struct {
+	emulator *chip8.Emulator
+	status   func(msg string)
+}
+
+func (c *runControls) pause() {
+	if c.emulator.Paused() {
+		c.emulator.Resume()
+		c.status("Resumed")
+	} else {
+		c.emulator.Pause()
+		c.status("Paused, F2 runs a frame")
+	}
+}
+
+// speed multiplies the speed by factor.
+func (c *runControls) speed(factor float64) {
+	c.emulator.SetSpeed(c.emulator.Speed() * factor)
+	c.status(fmt.Sprintf("Speed %gx", c.emulator.Speed()))
+}
+
+// hotkeys: F1 pauses and resumes, F2 runs one frame while paused, F3 halves
+// and F4 doubles the speed.
+func (c *runControls) hotkeys() map[termbox.Key]func() {
+	return map[termbox.Key]func(){
+		termbox.KeyF1: c.pause,
+		termbox.KeyF2: func() { c.emulator.StepFrame() },
+		termbox.KeyF3: func() { c.speed(0.5) },
+		termbox.KeyF4: func() { c.speed(2) },
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"github.com/debuggerpls/go-chip8"
+	"github.com/debuggerpls/go-chip8/dap"
+	"github.com/debuggerpls/go-chip8/debug"
+)
+
+func dapServer(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("dap", flag.ExitOnError)
+	quirksName := flags.String("quirks", "modern", "quirks preset: cosmac, chip48, schip, xochip or modern")
+	addr := flags.String("listen", "", "serve on this TCP address instead of stdin and stdout")
+	flags.Parse(args)
+
+	// the protocol may use stdout, the display is shown by the screen command
+	// in the debug console
+	create := func(program, quirksName string) (*debug.Debugger, error) {
+		quirks, err := chip8.QuirksByName(quirksName)
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(program)
+		if err != nil {
+			return nil, err
+		}
+		emulator, err := chip8.CreateEmulator(&chip8.GraphicsHeadless{}, &debug.Keys{}, &chip8.AudioNull{})
+		if err != nil {
+			return nil, err
+		}
+		emulator.Quirks = quirks
+		if err := emulator.LoadProgram(data); err != nil {
+			emulator.Close()
+			return nil, err
+		}
+		return debug.CreateDebugger(emulator), nil
+	}
+
+	server := &dap.Server{Launch: func(args dap.LaunchArguments) (*debug.Debugger, error) {
+		if args.Quirks == "" {
+			args.Quirks = *quirksName
+		}
+		return create(args.Program, args.Quirks)
+	}}
+	// a program on the command line is debugged by attach requests
+	if flags.NArg() > 0 {
+		d, err := create(flags.Arg(0), *quirksName)
+		if err != nil {
+			return err
+		}
+		defer d.Emulator.Close()
+		server.Debugger = d
+	}
+
+	if *addr != "" {
+		return serve(ctx, func() error { return server.ListenAndServe(*addr) })
+	}
+	return serve(ctx, func() error { return server.Serve(os.Stdin, os.Stdout) })
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/debuggerpls/go-chip8"
+	"github.com/debuggerpls/go-chip8/asm"
+	"github.com/debuggerpls/go-chip8/debug"
+)
+
+func debugger(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("debug", flag.ExitOnError)
+	quirksName := flags.String("quirks", "modern", "quirks preset: cosmac, chip48, schip, xochip or modern")
+	symbols := flags.String("symbols", "", "symbol file written by chip8 asm -s")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		return fmt.Errorf("Missing argument: CHIP8_PROGRAM")
+	}
+
+	quirks, err := chip8.QuirksByName(*quirksName)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	// the terminal belongs to the REPL, the display is shown by its screen command
+	emulator, err := chip8.CreateEmulator(&chip8.GraphicsHeadless{}, &debug.Keys{}, &chip8.AudioNull{})
+	if err != nil {
+		return err
+	}
+	defer emulator.Close()
+	emulator.Quirks = quirks
+	if err := emulator.LoadProgram(data); err != nil {
+		return err
+	}
+
+	d := debug.CreateDebugger(emulator)
+	if *symbols != "" {
+		f, err := os.Open(*symbols)
+		if err != nil {
+			return err
+		}
+		d.Symbols, err = asm.ReadSymbols(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Ctrl-C interrupts continue instead of quitting
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		for range interrupt {
+			d.Interrupt()
+		}
+	}()
+
+	return d.REPL(os.Stdin, os.Stdout)
+}
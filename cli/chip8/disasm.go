@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/debuggerpls/go-chip8/disasm"
+)
+
+func disassemble(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	format := flags.String("format", "listing", "output format: listing or octo")
+	entries := flags.String("entry", "", "additional entry points, comma separated addresses")
+	output := flags.String("o", "", "output file, stdout if empty")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		return fmt.Errorf("Missing argument: CHIP8_PROGRAM")
+	}
+
+	var addrs []uint16
+	if *entries != "" {
+		for _, s := range strings.Split(*entries, ",") {
+			addr, err := strconv.ParseUint(strings.TrimSpace(s), 0, 16)
+			if err != nil {
+				return fmt.Errorf("invalid entry point %q: %w", s, err)
+			}
+			addrs = append(addrs, uint16(addr))
+		}
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	p := disasm.Disassemble(data, disasm.Origin, addrs...)
+
+	w := os.Stdout
+	if *output != "" {
+		if w, err = os.Create(*output); err != nil {
+			return err
+		}
+		defer w.Close()
+	}
+
+	switch *format {
+	case "listing":
+		return p.WriteListing(w)
+	case "octo":
+		return p.WriteOcto(w)
+	}
+	return fmt.Errorf("unknown format %q, expected listing or octo", *format)
+}
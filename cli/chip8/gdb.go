@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/debuggerpls/go-chip8"
+	"github.com/debuggerpls/go-chip8/debug"
+	"github.com/debuggerpls/go-chip8/gdb"
+)
+
+func gdbServer(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("gdb", flag.ExitOnError)
+	quirksName := flags.String("quirks", "modern", "quirks preset: cosmac, chip48, schip, xochip or modern")
+	addr := flags.String("listen", gdb.DefaultAddr, "address of the GDB remote serial protocol stub")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		return fmt.Errorf("Missing argument: CHIP8_PROGRAM")
+	}
+
+	quirks, err := chip8.QuirksByName(*quirksName)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	emulator, err := chip8.CreateDefaultEmulator()
+	if err != nil {
+		return err
+	}
+	emulator.Quirks = quirks
+	if err := emulator.LoadProgram(data); err != nil {
+		emulator.Close()
+		return err
+	}
+
+	server := gdb.CreateServer(debug.CreateDebugger(emulator))
+	err = serve(ctx, func() error { return server.ListenAndServe(*addr) })
+	emulator.Close()
+	return err
+}
@@ -1,32 +1,61 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
-
-	"github.com/debuggerpls/go-chip8"
+	"os/signal"
+	"syscall"
 )
 
+// Subcommands of chip8, the first argument selects one. Without a known
+// subcommand the arguments are passed to run. The context is done on SIGINT
+// or SIGTERM, commands return its error after cleaning up.
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"run":         run,
+	"disasm":      disassemble,
+	"asm":         assemble,
+	"debug":       debugger,
+	"gdb":         gdbServer,
+	"dap":         dapServer,
+	"conformance": conformanceTests,
+}
+
+// Exit code after a signal, as with the default handler of the shell
+const exitInterrupted = 130
+
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Printf("Missing argument: CHIP8_PROGRAM\n")
-		os.Exit(1)
+	args := os.Args[1:]
+	cmd := run
+	if len(args) > 0 {
+		if c, ok := commands[args[0]]; ok {
+			cmd = c
+			args = args[1:]
+		}
 	}
 
-	data, err := os.ReadFile(os.Args[1])
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := cmd(ctx, args)
+	stop()
 	if err != nil {
+		if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+			fmt.Fprintln(os.Stderr, "interrupted")
+			os.Exit(exitInterrupted)
+		}
 		fmt.Println(err)
 		os.Exit(1)
 	}
+}
 
-	emulator, err := chip8.CreateDefaultEmulator()
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+// serve runs a server until it fails or ctx is done.
+func serve(ctx context.Context, server func() error) error {
+	done := make(chan error, 1)
+	go func() { done <- server() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-
-	emulator.LoadProgram(data)
-	err = emulator.Run()
-	emulator.Close()
-	fmt.Println("ERROR:", err.Error())
 }
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"os"
+
+	"github.com/debuggerpls/go-chip8"
+	"github.com/debuggerpls/go-chip8/trace"
+	"github.com/nsf/termbox-go"
+)
+
+func run(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	quirksName := flags.String("quirks", "modern", "quirks preset: cosmac, chip48, schip, xochip or modern")
+	slot := flags.Int("slot", 0, "save state slot (0-9) of the F5 save and F9 load hotkeys, F6 selects the next")
+	load := flags.Bool("load", false, "start from the save state in -slot")
+	rewind := flags.Int("rewind", 16, "memory in MiB for rewinding with Backspace, 0 disables it")
+	scale := flags.Int("scale", 4, "screenshot and recording pixel size")
+	paletteColors := flags.String("palette", "", "screenshot and recording colors of the planes, e.g. 000000,ffffff,ff0000,ffff00")
+	grid := flags.Bool("grid", false, "draw a grid between the screenshot and recording pixels")
+	screenshotAfter := flags.Int("screenshot-after", 0, "run headless for N frames, save a screenshot and exit")
+	screenshot := flags.String("screenshot", "", "screenshot file of -screenshot-after (default CHIP8_PROGRAM.png)")
+	movieRecord := flags.String("movie-record", "", "record the keys of every frame to a movie file, from power-on")
+	moviePlay := flags.String("movie-play", "", "replay a movie file, fails if the program or the states differ")
+	rngName := flags.String("rng", "pcg", "random numbers of Cxkk: pcg or vip (the COSMAC VIP interpreter's routine, needs -rng-interpreter)")
+	rngInterpreter := flags.String("rng-interpreter", "", "CHIP-8 interpreter image of the COSMAC VIP (512 bytes from 0x0000) whose code -rng vip reads")
+	seed := flags.Uint64("seed", 0, "seed of the random numbers, 0 picks one")
+	ipf := flags.Int("ipf", chip8.DefaultInstructionsPerFrame, "instructions per 60 Hz frame (1-65535)")
+	vipName := flags.String("vip", "", "run on an emulated COSMAC VIP with this CHIP-8 interpreter image (512 bytes from 0x0000), for programs with 1802 machine code")
+	timingName := flags.String("timing", "fixed", "instruction timing: fixed (-ipf per frame) or vip (cycles of the COSMAC VIP)")
+	traceName := flags.String("trace", "", "write a line per instruction to a file, see the trace package for the format")
+	traceRing := flags.Int("trace-ring", 0, "trace only the last N instructions before the program fails")
+	traceAddrs := flags.String("trace-addr", "", "trace the instructions in the address range FROM-TO (hex), e.g. 200-2FF")
+	traceOps := flags.String("trace-ops", "", "trace the opcodes of these patterns or prefixes, e.g. 8xy4,Dxyn,Fx")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		return fmt.Errorf("Missing argument: CHIP8_PROGRAM")
+	}
+	if *slot < 0 || *slot >= slotCount {
+		return fmt.Errorf("invalid slot %d, expected 0-%d", *slot, slotCount-1)
+	}
+	if (*movieRecord != "" || *moviePlay != "") && *load {
+		return fmt.Errorf("movies start from power-on, -load is not possible")
+	}
+	if (*movieRecord != "" || *moviePlay != "") && (*rngName != "pcg" || *seed != 0) {
+		return fmt.Errorf("movies use the PCG random numbers with the seed of the recording, -rng and -seed are not possible")
+	}
+
+	quirks, err := chip8.QuirksByName(*quirksName)
+	if err != nil {
+		return err
+	}
+	timing, err := chip8.TimingByName(*timingName)
+	if err != nil {
+		return err
+	}
+	if timing != nil && *movieRecord != "" {
+		return fmt.Errorf("movies use a fixed number of instructions per frame, -timing %s is not possible", *timingName)
+	}
+	var vip *chip8.VIP
+	if *vipName != "" {
+		if *movieRecord != "" || *moviePlay != "" {
+			return fmt.Errorf("movies run on the CHIP-8 CPU, -vip is not possible")
+		}
+		interpreter, err := os.ReadFile(*vipName)
+		if err != nil {
+			return err
+		}
+		if vip, err = chip8.NewVIP(interpreter); err != nil {
+			return err
+		}
+	}
+	if *ipf < 1 || *ipf > 65535 {
+		return fmt.Errorf("invalid instructions per frame %d, expected 1-65535", *ipf)
+	}
+	if *rngName != "pcg" && *rngName != "vip" {
+		return fmt.Errorf("unknown random number generator %q, expected pcg or vip", *rngName)
+	}
+	var rngVIP *chip8.RNGVIP
+	if *rngName == "vip" {
+		if *rngInterpreter == "" {
+			return fmt.Errorf("-rng vip reads the code of the interpreter, -rng-interpreter is missing")
+		}
+		interpreter, err := os.ReadFile(*rngInterpreter)
+		if err != nil {
+			return err
+		}
+		if len(interpreter) == 0 || len(interpreter) > 0x200 {
+			return fmt.Errorf("interpreter of %d bytes, expected 1-512", len(interpreter))
+		}
+		rngVIP = &chip8.RNGVIP{Seed: uint16(*seed), Interpreter: interpreter}
+		if *seed == 0 {
+			rngVIP.Seed = uint16(rand.Uint32())
+		}
+	}
+	filter, err := trace.ParseFilter(*traceAddrs, *traceOps)
+	if err != nil {
+		return err
+	}
+	if *traceRing < 0 {
+		return fmt.Errorf("invalid trace ring size %d", *traceRing)
+	}
+	var traces *traceLog
+	if *traceName != "" {
+		if vip != nil {
+			return fmt.Errorf("the VIP runs the CHIP-8 interpreter, -trace is not possible")
+		}
+		traces = newTraceLog(*traceName, *traceRing, filter)
+	}
+	// configure sets up an emulator from the flags
+	configure := func(e *chip8.Emulator) error {
+		e.Quirks = quirks
+		if traces != nil {
+			e.Tracer = traces.tracer
+		}
+		e.InstructionsPerFrame = *ipf
+		e.Timing = timing
+		if *seed != 0 {
+			e.Seed(*seed)
+		}
+		if rngVIP != nil {
+			e.RNG = rngVIP
+		}
+		if vip != nil {
+			return e.StartVIP(vip)
+		}
+		return nil
+	}
+	options := chip8.ImageOptions{Scale: *scale, Grid: *grid}
+	if *paletteColors != "" {
+		if options.Palette, err = chip8.ParsePalette(*paletteColors); err != nil {
+			return err
+		}
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	var movie *chip8.Movie
+	if *moviePlay != "" {
+		if movie, err = readMovie(*moviePlay); err != nil {
+			return err
+		}
+	}
+
+	if *screenshotAfter > 0 {
+		path := *screenshot
+		if path == "" {
+			path = flags.Arg(0) + ".png"
+		}
+		err := runHeadless(ctx, data, configure, movie, *screenshotAfter, &screenshots{program: flags.Arg(0), options: options}, path)
+		if traces != nil {
+			if terr := traces.close(err); err == nil {
+				err = terr
+			}
+		}
+		return err
+	}
+
+	graphics := &chip8.GraphicsTermbox{}
+	slots := &saveSlots{program: flags.Arg(0), slot: *slot, status: graphics.Status}
+	shots := &screenshots{program: flags.Arg(0), options: options, status: graphics.Status}
+	hotkeys := slots.hotkeys()
+	hotkeys[termbox.KeyF12] = shots.screenshot
+	hotkeys[termbox.KeyF11] = shots.record
+	controls := &runControls{status: graphics.Status}
+	for key, action := range controls.hotkeys() {
+		hotkeys[key] = action
+	}
+	// Esc and Ctrl-C (no signal in raw mode) quit
+	runCtx, quit := context.WithCancel(ctx)
+	defer quit()
+	hotkeys[termbox.KeyEsc] = quit
+	hotkeys[termbox.KeyCtrlC] = quit
+	input := &chip8.InputTermbox{Hotkeys: hotkeys}
+	emulator, err := chip8.CreateEmulator(graphics, input, &chip8.AudioBell{})
+	if err != nil {
+		return err
+	}
+	if err := configure(emulator); err != nil {
+		emulator.Close()
+		return err
+	}
+	slots.emulator = emulator
+	shots.emulator = emulator
+	controls.emulator = emulator
+	if *rewind > 0 {
+		emulator.Rewind = chip8.NewRewind(*rewind << 20)
+	}
+
+	emulator.LoadProgram(data)
+	var recorder *chip8.MovieRecorder
+	switch {
+	case movie != nil:
+		_, err = emulator.PlayMovie(movie, data)
+	case *movieRecord != "":
+		recorder, err = emulator.RecordMovie(data)
+	case *load:
+		err = slots.load()
+	}
+	if err != nil {
+		emulator.Close()
+		return err
+	}
+	err = emulator.Run(runCtx)
+	if emulator.Recorder != nil {
+		// save a recording still running
+		shots.record()
+	}
+	if errors.Is(err, chip8.ErrExit) {
+		// show the last screen until a key is pressed
+		graphics.Status("Program exited, press any key")
+		waitForEvent(ctx, input)
+	}
+	emulator.Close()
+	if traces != nil {
+		if terr := traces.close(err); terr != nil {
+			return terr
+		}
+	}
+	if recorder != nil {
+		if err := writeFile(*movieRecord, recorder.Movie.Write); err != nil {
+			return err
+		}
+	}
+	var desync chip8.ErrMovieDesync
+	switch {
+	case errors.As(err, &desync):
+		return err
+	case errors.Is(err, chip8.ErrMovieEnd):
+		fmt.Printf("Movie finished after %d frames\n", len(movie.Frames))
+	case errors.Is(err, chip8.ErrExit):
+	case errors.Is(err, context.Canceled):
+		// quit by a hotkey, or a signal reported by main
+		return ctx.Err()
+	default:
+		return err
+	}
+	return nil
+}
+
+// waitForEvent waits for an event of input or until ctx is done.
+func waitForEvent(ctx context.Context, input chip8.Input) {
+	done := make(chan struct{})
+	go func() {
+		input.WaitForEvent()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+func readMovie(name string) (*chip8.Movie, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return chip8.ReadMovie(f)
+}
+
+// runHeadless runs the program, or replays the movie if not nil, as fast as
+// possible for the given number of 60 Hz frames without a terminal and saves
+// a screenshot at path.
+func runHeadless(ctx context.Context, data []byte, configure func(e *chip8.Emulator) error, movie *chip8.Movie, frames int, shots *screenshots, path string) error {
+	emulator, err := chip8.CreateEmulator(&chip8.GraphicsHeadless{}, &chip8.InputNull{}, &chip8.AudioNull{})
+	if err != nil {
+		return err
+	}
+	defer emulator.Close()
+	if err := configure(emulator); err != nil {
+		return err
+	}
+	shots.emulator = emulator
+	if movie != nil {
+		_, err = emulator.PlayMovie(movie, data)
+	} else {
+		err = emulator.LoadProgram(data)
+	}
+	if err != nil {
+		return err
+	}
+
+	for frame := 0; frame < frames && err == nil; frame++ {
+		if err = ctx.Err(); err == nil {
+			err = emulator.RunFrame()
+		}
+	}
+	if err != nil && !errors.Is(err, chip8.ErrExit) && !errors.Is(err, chip8.ErrMovieEnd) {
+		return err
+	}
+	return shots.save(path)
+}
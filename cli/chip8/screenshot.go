@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/debuggerpls/go-chip8"
+)
+
+// screenshots writes PNG screenshots and GIF recordings of the display next
+// to the program, PROGRAM-1.png, PROGRAM-2.gif and so on.
+type screenshots struct {
+	emulator *chip8.Emulator
+	program  string
+	options  chip8.ImageOptions
+	status   func(msg string)
+}
+
+// next returns the first path with the extension that does not exist yet.
+func (s *screenshots) next(ext string) string {
+	for n := 1; ; n++ {
+		path := fmt.Sprintf("%s-%d%s", s.program, n, ext)
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			return path
+		}
+	}
+}
+
+func (s *screenshots) save(path string) error {
+	return writeFile(path, func(w io.Writer) error {
+		return s.emulator.Screenshot(w, s.options)
+	})
+}
+
+// screenshot saves the next screenshot and reports it in the status line.
+func (s *screenshots) screenshot() {
+	path := s.next(".png")
+	if err := s.save(path); err != nil {
+		s.status(fmt.Sprintf("Screenshot: %v", err))
+	} else {
+		s.status("Saved " + path)
+	}
+}
+
+// record starts a recording or stops it and saves the GIF.
+func (s *screenshots) record() {
+	if s.emulator.Recorder == nil {
+		s.emulator.StartRecording(s.options)
+		s.status("Recording")
+		return
+	}
+	path := s.next(".gif")
+	err := writeFile(path, s.emulator.StopRecording)
+	if err != nil {
+		s.status(fmt.Sprintf("Recording: %v", err))
+	} else {
+		s.status("Saved " + path)
+	}
+}
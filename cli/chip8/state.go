@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/debuggerpls/go-chip8"
+	"github.com/nsf/termbox-go"
+)
+
+// Number of save state slots
+const slotCount = 10
+
+// saveSlots saves and loads states of the emulator in numbered files next
+// to the program, PROGRAM.state0 to PROGRAM.state9.
+type saveSlots struct {
+	emulator *chip8.Emulator
+	program  string
+	slot     int
+	status   func(msg string)
+}
+
+func (s *saveSlots) path(slot int) string {
+	return fmt.Sprintf("%s.state%d", s.program, slot)
+}
+
+func (s *saveSlots) save() error {
+	f, err := os.Create(s.path(s.slot))
+	if err != nil {
+		return err
+	}
+	if err := s.emulator.SaveState(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s *saveSlots) load() error {
+	f, err := os.Open(s.path(s.slot))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.emulator.LoadState(f)
+}
+
+// report shows the result of an action in the status line.
+func (s *saveSlots) report(what string, err error) {
+	if err != nil {
+		s.status(fmt.Sprintf("%s slot %d: %v", what, s.slot, err))
+	} else {
+		s.status(fmt.Sprintf("%s slot %d", what, s.slot))
+	}
+}
+
+// hotkeys: F5 saves, F9 loads and F6 selects the next slot.
+func (s *saveSlots) hotkeys() map[termbox.Key]func() {
+	return map[termbox.Key]func(){
+		termbox.KeyF5: func() { s.report("Saved", s.save()) },
+		termbox.KeyF9: func() { s.report("Loaded", s.load()) },
+		termbox.KeyF6: func() {
+			s.slot = (s.slot + 1) % slotCount
+			s.report("Selected", nil)
+		},
+	}
+}
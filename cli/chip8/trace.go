@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/debuggerpls/go-chip8"
+	"github.com/debuggerpls/go-chip8/trace"
+)
+
+// traceLog writes the trace of a run to a file, which is only created by the
+// first line: in ring mode not at all if the run did not fail.
+type traceLog struct {
+	name   string
+	file   *os.File
+	tracer *trace.Tracer
+	ring   bool
+}
+
+func newTraceLog(name string, ring int, filter trace.Filter) *traceLog {
+	t := &traceLog{name: name, ring: ring > 0}
+	if t.ring {
+		t.tracer = trace.NewRing(t, ring)
+	} else {
+		t.tracer = trace.New(t)
+	}
+	t.tracer.Filter = filter
+	return t
+}
+
+func (t *traceLog) Write(p []byte) (int, error) {
+	if t.file == nil {
+		f, err := os.Create(t.name)
+		if err != nil {
+			return 0, err
+		}
+		t.file = f
+	}
+	return t.file.Write(p)
+}
+
+// close writes the rest of the trace, the ring only if err is a failure of
+// the program and not the end of the run.
+func (t *traceLog) close(err error) error {
+	failed := err != nil && !errors.Is(err, chip8.ErrExit) && !errors.Is(err, chip8.ErrMovieEnd) && !errors.Is(err, context.Canceled)
+	var ferr error
+	if !t.ring || failed {
+		ferr = t.tracer.Flush()
+	}
+	if t.file != nil {
+		if cerr := t.file.Close(); ferr == nil {
+			ferr = cerr
+		}
+	}
+	return ferr
+}
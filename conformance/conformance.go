@@ -0,0 +1,333 @@
+// Package conformance runs test ROMs headlessly and compares the final
+// display with golden hashes or images. The opcodes executed by every test
+// give a matrix of which opcodes pass and which are involved in failures.
+//
+// A test directory holds the ROMs and a manifest, conformance.json:
+//
+//	{"tests": [
+//	  {"rom": "arith.ch8", "frames": 60, "hash": "a1b2c3d4e5f60718"},
+//	  {"rom": "draw.ch8", "quirks": "cosmac", "image": "draw.png"}
+//	]}
+//
+// The hash is GraphicsHeadless.Hash of the display in hex, the image a PNG
+// of the display as written by Emulator.Screenshot in any scale.
+package conformance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/debuggerpls/go-chip8"
+	"github.com/debuggerpls/go-chip8/disasm"
+)
+
+// Manifest is the file name of the tests of a directory.
+const Manifest = "conformance.json"
+
+// Frames run by tests that do not set them
+const DefaultFrames = 60
+
+// Seed of the random numbers of every test, so they run the same every time
+const Seed = 1
+
+type Test struct {
+	ROM    string `json:"rom"`
+	Quirks string `json:"quirks,omitempty"` // preset name, modern by default
+	Frames int    `json:"frames,omitempty"` // zero value means Suite.Frames
+	Keys   uint16 `json:"keys,omitempty"`   // keys held during the whole run
+	Hash   string `json:"hash,omitempty"`
+	Image  string `json:"image,omitempty"`
+}
+
+// Name returns the ROM and the quirks, if not the default.
+func (t *Test) Name() string {
+	if t.Quirks == "" {
+		return t.ROM
+	}
+	return t.ROM + " (" + t.Quirks + ")"
+}
+
+// Suite is the tests of a directory.
+type Suite struct {
+	Dir    string `json:"-"`
+	Frames int    `json:"frames,omitempty"` // of tests without frames, zero value means DefaultFrames
+	Tests  []Test `json:"tests"`
+}
+
+type ErrMismatch struct {
+	what string
+}
+
+func (e ErrMismatch) Error() string {
+	return fmt.Sprintf("ErrMismatch: %s", e.what)
+}
+
+// Result is the outcome of a test. Err is nil if the test passed.
+type Result struct {
+	Test    Test
+	Display chip8.Framebuffer // at the end of the run
+	Hash    uint64
+	Opcodes []string // patterns of the executed opcodes, see disasm.Instruction.Pattern
+	Err     error
+}
+
+func (r *Result) Passed() bool {
+	return r.Err == nil
+}
+
+// Load reads the manifest of dir.
+func Load(dir string) (*Suite, error) {
+	data, err := os.ReadFile(filepath.Join(dir, Manifest))
+	if err != nil {
+		return nil, err
+	}
+	s := &Suite{Dir: dir}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("%s: %w", Manifest, err)
+	}
+	return s, nil
+}
+
+// Save writes the manifest, e.g. after Update.
+func (s *Suite) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.Dir, Manifest), append(data, '\n'), 0o644)
+}
+
+// Run runs all tests.
+func (s *Suite) Run() []Result {
+	results := make([]Result, len(s.Tests))
+	for i, t := range s.Tests {
+		results[i] = s.RunTest(t)
+	}
+	return results
+}
+
+// keysInput holds the same keys for the whole run.
+type keysInput struct {
+	chip8.InputNull
+	keys uint16
+}
+
+func (k *keysInput) Keys() uint16 {
+	return k.keys
+}
+
+// RunTest runs the ROM of the test for its frames and compares the display.
+func (s *Suite) RunTest(t Test) Result {
+	r := Result{Test: t}
+	rom, err := os.ReadFile(filepath.Join(s.Dir, t.ROM))
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	graphics := &chip8.GraphicsHeadless{}
+	e, err := chip8.CreateEmulator(graphics, &keysInput{keys: t.Keys}, &chip8.AudioNull{})
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	defer e.Close()
+	if t.Quirks != "" {
+		if e.Quirks, err = chip8.QuirksByName(t.Quirks); err != nil {
+			r.Err = err
+			return r
+		}
+	}
+	e.Seed(Seed)
+
+	executed := map[string]bool{}
+	e.Watchpoints = chip8.NewWatchpoints(&e.Memory, func(hit chip8.WatchHit) {
+		if hit.Addr == hit.PC {
+			executed[disasm.Decode(e.Memory[:], hit.PC).Pattern()] = true
+		}
+	})
+	e.Watchpoints.Add(chip8.Watchpoint{From: 0, To: chip8.MemorySize - 1, Access: chip8.AccessExecute})
+	if err := e.LoadProgram(rom); err != nil {
+		r.Err = err
+		return r
+	}
+
+	frames := t.Frames
+	if frames <= 0 {
+		frames = s.Frames
+	}
+	if frames <= 0 {
+		frames = DefaultFrames
+	}
+	for frame := 0; frame < frames; frame++ {
+		if err = e.RunFrame(); err != nil {
+			break
+		}
+	}
+	for op := range executed {
+		r.Opcodes = append(r.Opcodes, op)
+	}
+	slices.Sort(r.Opcodes)
+	e.Present()
+	r.Display = graphics.Buffer
+	r.Display.Pixels = slices.Clone(graphics.Buffer.Pixels)
+	r.Hash = graphics.Hash()
+	if err != nil && !errors.Is(err, chip8.ErrExit) {
+		r.Err = err
+		return r
+	}
+	r.Err = s.compare(&r)
+	return r
+}
+
+// compare checks the display of the result against the golden hash and image.
+func (s *Suite) compare(r *Result) error {
+	t := &r.Test
+	if t.Hash == "" && t.Image == "" {
+		return ErrMismatch{"no golden hash or image"}
+	}
+	if t.Hash != "" {
+		hash, err := strconv.ParseUint(t.Hash, 16, 64)
+		if err != nil {
+			return fmt.Errorf("invalid hash %q: %w", t.Hash, err)
+		}
+		if hash != r.Hash {
+			return ErrMismatch{fmt.Sprintf("hash %016x, expected %016x", r.Hash, hash)}
+		}
+	}
+	if t.Image != "" {
+		return compareImage(filepath.Join(s.Dir, t.Image), &r.Display)
+	}
+	return nil
+}
+
+// compareImage compares the PNG with the display in the default palette.
+func compareImage(name string, f *chip8.Framebuffer) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	golden, err := png.Decode(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	bounds := golden.Bounds()
+	scale := bounds.Dx() / f.Width
+	if scale == 0 || bounds.Dx() != scale*f.Width || bounds.Dy() != scale*f.Height {
+		return ErrMismatch{fmt.Sprintf("image of %dx%d pixels, display of %dx%d", bounds.Dx(), bounds.Dy(), f.Width, f.Height)}
+	}
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			c := color.RGBAModel.Convert(golden.At(bounds.Min.X+x*scale, bounds.Min.Y+y*scale))
+			if c != chip8.DefaultPalette[f.Pixel(x, y)] {
+				return ErrMismatch{fmt.Sprintf("pixel %d,%d differs from the image", x, y)}
+			}
+		}
+	}
+	return nil
+}
+
+// Update sets the golden hashes of the tests to the results, and rewrites
+// the golden images.
+func (s *Suite) Update(results []Result) error {
+	for i := range results {
+		r := &results[i]
+		t := &s.Tests[i]
+		if t.Image != "" {
+			file, err := os.Create(filepath.Join(s.Dir, t.Image))
+			if err != nil {
+				return err
+			}
+			err = png.Encode(file, r.Display.Image(chip8.ImageOptions{Scale: 4}))
+			if cerr := file.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if t.Hash != "" || t.Image == "" {
+			t.Hash = fmt.Sprintf("%016x", r.Hash)
+		}
+	}
+	return s.Save()
+}
+
+// Opcodes of CHIP-8, SUPER-CHIP and XO-CHIP in the order of the matrix
+var Opcodes = []string{
+	"00Cn", "00Dn", "00E0", "00EE", "00FB", "00FC", "00FD", "00FE", "00FF",
+	"1nnn", "2nnn", "3xkk", "4xkk", "5xy0", "5xy2", "5xy3", "6xkk", "7xkk",
+	"8xy0", "8xy1", "8xy2", "8xy3", "8xy4", "8xy5", "8xy6", "8xy7", "8xyE",
+	"9xy0", "Annn", "Bnnn", "Cxkk", "Dxyn", "Ex9E", "ExA1",
+	"F000", "Fx01", "F002", "Fx07", "Fx0A", "Fx15", "Fx18", "Fx1E", "Fx29",
+	"Fx30", "Fx33", "Fx3A", "Fx55", "Fx65", "Fx75", "Fx85",
+}
+
+// Cell is an opcode of the matrix with the tests executing it.
+type Cell struct {
+	Opcode string
+	Passed []string // names of the passed tests
+	Failed []string // names of the failed tests
+}
+
+// Status is "pass" if all tests executing the opcode passed, "FAIL" if any
+// failed and "-" if none executed it.
+func (c *Cell) Status() string {
+	switch {
+	case len(c.Failed) > 0:
+		return "FAIL"
+	case len(c.Passed) > 0:
+		return "pass"
+	}
+	return "-"
+}
+
+// Matrix returns a cell for every opcode of Opcodes, followed by the other
+// opcodes executed by the tests.
+func Matrix(results []Result) []Cell {
+	cells := make([]Cell, len(Opcodes))
+	index := map[string]int{}
+	for i, op := range Opcodes {
+		cells[i].Opcode = op
+		index[op] = i
+	}
+	for _, r := range results {
+		for _, op := range r.Opcodes {
+			i, ok := index[op]
+			if !ok {
+				i = len(cells)
+				index[op] = i
+				cells = append(cells, Cell{Opcode: op})
+			}
+			if r.Passed() {
+				cells[i].Passed = append(cells[i].Passed, r.Test.Name())
+			} else {
+				cells[i].Failed = append(cells[i].Failed, r.Test.Name())
+			}
+		}
+	}
+	return cells
+}
+
+// WriteMatrix writes the matrix of the results, an opcode per line.
+func WriteMatrix(w io.Writer, results []Result) error {
+	for _, c := range Matrix(results) {
+		line := fmt.Sprintf("%-5s %-4s", c.Opcode, c.Status())
+		if len(c.Failed) > 0 {
+			line += " " + strings.Join(c.Failed, ", ")
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
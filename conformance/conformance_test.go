@@ -0,0 +1,130 @@
+package conformance
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/debuggerpls/go-chip8"
+	"github.com/debuggerpls/go-chip8/asm"
+)
+
+func TestConformance(t *testing.T) {
+	suite, err := Load("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := suite.Run()
+	failed := false
+	for _, r := range results {
+		if !r.Passed() {
+			t.Errorf("%s: %v", r.Test.Name(), r.Err)
+			failed = true
+		}
+	}
+	if failed {
+		var b strings.Builder
+		WriteMatrix(&b, results)
+		t.Logf("Opcodes:\n%s", b.String())
+	}
+}
+
+func TestMismatch(t *testing.T) {
+	suite, err := Load("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	test := suite.Tests[0]
+	test.Hash = "0123456789abcdef"
+	r := suite.RunTest(test)
+	if _, ok := r.Err.(ErrMismatch); !ok {
+		t.Fatalf("Expected ErrMismatch, actual=%v", r.Err)
+	}
+
+	cells := Matrix([]Result{r})
+	for _, c := range cells {
+		switch c.Opcode {
+		case "8xy4":
+			if c.Status() != "FAIL" || c.Failed[0] != test.Name() {
+				t.Errorf("8xy4 executed by the failed test: %+v", c)
+			}
+		case "Fx0A":
+			if c.Status() != "-" {
+				t.Errorf("Fx0A not executed: %+v", c)
+			}
+		}
+	}
+}
+
+// The ROMs are assembled from the sources next to them.
+func TestROMSources(t *testing.T) {
+	sources, _ := filepath.Glob("testdata/*.asm")
+	for _, source := range sources {
+		rom := strings.TrimSuffix(source, ".asm") + ".ch8"
+		expected, err := os.ReadFile(rom)
+		if os.IsNotExist(err) {
+			// included by the others
+			continue
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		p, err := asm.AssembleFile(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(p.Code, expected) {
+			t.Errorf("%s differs from %s", rom, source)
+		}
+	}
+}
+
+// shown reads the 16 bytes drawn by show.asm as hex digits of the font.
+func shown(t *testing.T, f *chip8.Framebuffer) []byte {
+	var m chip8.Memory
+	m.Init()
+	digit := func(x, y int) byte {
+		for d := 0; d < 16; d++ {
+			match := true
+			for row := 0; row < 5 && match; row++ {
+				glyph := m[chip8.FontAddress+d*5+row]
+				for col := 0; col < 5; col++ {
+					if f.Pixel(x+col, y+row) != glyph>>(7-col)&1 {
+						match = false
+					}
+				}
+			}
+			if match {
+				return byte(d)
+			}
+		}
+		t.Fatalf("No digit at %d,%d", x, y)
+		return 0
+	}
+	var b []byte
+	for i := 0; i < 16; i++ {
+		x, y := i%6*10, i/6*6
+		b = append(b, digit(x, y)<<4|digit(x+5, y))
+	}
+	return b
+}
+
+// The results of the ROMs, derived by hand from Cowgod's reference and not
+// from this emulator.
+func TestResults(t *testing.T) {
+	tests := []struct {
+		rom      string
+		expected []byte
+	}{
+		{"arith.ch8", []byte{0x46, 0x46, 0xf6, 0x06, 0xb9, 0x36, 0x01, 0xca, 0x00, 0x40, 0x01, 0x36, 0x01, 0x02, 0x01, 0xaa}},
+		{"edge.ch8", []byte{0x00, 0x01, 0x00, 0x01, 0xff, 0x00, 0x00, 0x01, 0xff, 0x00, 0xff, 0x00, 0x00, 0x01, 0x55, 0x01}},
+	}
+	suite := &Suite{Dir: "testdata"}
+	for _, test := range tests {
+		r := suite.RunTest(Test{ROM: test.rom})
+		if actual := shown(t, &r.Display); !bytes.Equal(actual, test.expected) {
+			t.Errorf("%s shows % x, expected % x", test.rom, actual, test.expected)
+		}
+	}
+}
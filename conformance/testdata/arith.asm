@@ -0,0 +1,33 @@
+; arith shows the results of the arithmetic and logic opcodes:
+; V0-VE, then VF = #AA
+        LD V0, #12              ; 6xkk
+        ADD V0, #34             ; 7xkk, 46
+        LD V1, V0               ; 8xy0, 46
+        LD V2, #F0
+        OR V2, V1               ; 8xy1, F6
+        LD V3, #0F
+        AND V3, V1              ; 8xy2, 06
+        LD V4, #FF
+        XOR V4, V1              ; 8xy3, B9
+        LD V5, #F0
+        ADD V5, V1              ; 8xy4, 36
+        LD V6, VF               ; carry, 01
+        LD V7, #10
+        SUB V7, V1              ; 8xy5, CA
+        LD V8, VF               ; borrow, 00
+        LD V9, #81
+        SHR V9                  ; 8xy6, 40
+        LD VA, VF               ; 01
+        LD VB, #10
+        SUBN VB, V1             ; 8xy7, 36
+        LD VC, VF               ; 01
+        LD VD, #81
+        SHL VD                  ; 8xyE, 02
+        LD VE, VF               ; 01
+        LD VF, #AA
+        LD I, results
+        LD [I], VF
+        CALL show
+halt:   JP halt
+
+        INCLUDE "show.asm"
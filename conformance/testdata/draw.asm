@@ -0,0 +1,50 @@
+; draw shows the collision flags, BCD and registers stored and loaded
+; through memory, and draws a box below and one wrapping at the right edge
+        CLS                     ; 00E0
+        LD V4, 123
+        LD I, bcd
+        LD B, V4                ; Fx33
+        LD V2, [I]              ; Fx65, V0-V2 = 01 02 03
+        LD V5, V0
+        LD V6, V1
+        LD V7, V2
+        LD I, box
+        LD V0, 10
+        LD V1, 20
+        DRW V0, V1, 4           ; Dxyn
+        LD V8, VF               ; 00
+        DRW V0, V1, 4
+        LD V9, VF               ; 01, erased
+        DRW V0, V1, 4
+        LD V0, 62
+        LD V1, 26
+        DRW V0, V1, 4           ; wraps or clips at the edge
+        LD VA, VF               ; 00
+        LD I, bcd
+        LD V0, #5A
+        LD [I], V0              ; Fx55, only V0
+        LD V3, 1
+        LD I, bcd
+        ADD I, V3               ; Fx1E
+        LD V0, [I]
+        LD VB, V0               ; 02
+        LD I, bcd
+        LD V0, [I]
+        LD VC, V0               ; 5A
+        LD VD, 0
+        LD VE, 0
+        LD VF, 0
+        LD V0, 0
+        LD V1, 0
+        LD I, results
+        LD [I], VF
+        CALL show
+halt:   JP halt
+
+box:    SPRITE ####....
+        SPRITE #..#....
+        SPRITE #..#....
+        SPRITE ####....
+bcd:    DB 0, 0, 0, 0
+
+        INCLUDE "show.asm"
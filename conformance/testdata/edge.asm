@@ -0,0 +1,41 @@
+; edge shows the edge cases of the flags of the arithmetic opcodes:
+; 00 01 00 01 FF 00 00 01 FF 00 FF 00 00 01 55 01
+        LD V0, #05
+        LD V1, #05
+        SUB V0, V1              ; 8xy5 equal, 00
+        LD V1, VF               ; no borrow, 01
+        LD V2, #05
+        LD V3, #05
+        SUBN V2, V3             ; 8xy7 equal, 00
+        LD V3, VF               ; no borrow, 01
+        LD V4, #00
+        LD V5, #01
+        SUB V4, V5              ; 8xy5, FF
+        LD V5, VF               ; borrow, 00
+        LD V6, #80
+        LD V7, #80
+        ADD V6, V7              ; 8xy4, 00
+        LD V7, VF               ; carry, 01
+        LD V8, #FE
+        LD V9, #01
+        ADD V8, V9              ; 8xy4, FF
+        LD V9, VF               ; no carry, 00
+        LD VA, #01
+        LD VB, #00
+        SUBN VA, VB             ; 8xy7, FF
+        LD VB, VF               ; borrow, 00
+        LD VC, #80
+        SHL VC                  ; 8xyE, 00
+        LD VD, VF               ; 01
+        LD VF, #55
+        LD VE, #FF
+        ADD VE, #02             ; 7xkk does not touch VF
+        LD VE, VF               ; 55
+        LD VF, #10
+        SUB VF, VF              ; the flag is written last, 01
+        LD I, results
+        LD [I], VF
+        CALL show
+halt:   JP halt
+
+        INCLUDE "show.asm"
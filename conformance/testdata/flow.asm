@@ -0,0 +1,48 @@
+; flow shows the results of the jumps, skips, keys and timers, every
+; register should be 01 but V0 = 02, V3 = 05, V9 = 02, VA = 1E and VB = 00
+        LD V0, 5
+        LD V1, 1
+        SE V0, 5                ; 3xkk taken
+        LD V1, 0
+        LD V2, 1
+        SNE V0, 6               ; 4xkk taken
+        LD V2, 0
+        LD V3, 5
+        LD V4, 1
+        SE V0, V3               ; 5xy0 taken
+        LD V4, 0
+        LD V5, 1
+        SNE V0, V1              ; 9xy0 taken
+        LD V5, 0
+        LD V6, 0
+        CALL sub                ; 2nnn, 00EE
+        LD V0, 2
+        JP V0, table            ; Bnnn to table + 2
+table:  LD V7, 0
+        LD V7, 1
+        LD V8, 1
+        SKNP V8                 ; ExA1 taken, no key is pressed
+        LD V8, 0
+        LD V9, 1
+        SKP V9                  ; Ex9E not taken
+        ADD V9, 1
+        LD VA, 30
+        LD DT, VA               ; Fx15
+        LD ST, VA               ; Fx18
+        LD VA, DT               ; Fx07
+        RND VB, 0               ; Cxkk
+        LD VC, 1
+        JP over                 ; 1nnn
+        LD VC, 0
+over:   LD VD, 1
+        LD VE, 1
+        LD VF, 1
+        LD I, results
+        LD [I], VF
+        CALL show
+halt:   JP halt
+
+sub:    LD V6, 1
+        RET
+
+        INCLUDE "show.asm"
@@ -0,0 +1,44 @@
+; schip draws with the SUPER-CHIP opcodes in high resolution: a 16x16
+; sprite, the big font, scrolling and the RPL flags, then exits
+        HIGH                    ; 00FF
+        LD I, big
+        LD V0, 8
+        LD V1, 8
+        DRW V0, V1, 0           ; Dxy0, 16x16
+        SCD 4                   ; 00Cn
+        SCR                     ; 00FB
+        SCR
+        SCL                     ; 00FC
+        LD V2, 7
+        LD HF, V2               ; Fx30
+        LD V0, 40
+        LD V1, 20
+        DRW V0, V1, 10
+        LD V0, #42
+        LD V1, #43
+        LD R, V1                ; Fx75
+        LD V0, 0
+        LD V1, 0
+        LD V1, R                ; Fx85
+        LD F, V1
+        LD V2, 70
+        LD V3, 20
+        DRW V2, V3, 5           ; shows 3 from V1 = 43 & F
+        EXIT                    ; 00FD
+
+big:    SPRITE ################
+        SPRITE #..............#
+        SPRITE #..............#
+        SPRITE #..####..####..#
+        SPRITE #..####..####..#
+        SPRITE #..............#
+        SPRITE #..............#
+        SPRITE #......##......#
+        SPRITE #......##......#
+        SPRITE #..............#
+        SPRITE #..#........#..#
+        SPRITE #...#......#...#
+        SPRITE #....######....#
+        SPRITE #..............#
+        SPRITE #..............#
+        SPRITE ################
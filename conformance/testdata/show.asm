@@ -0,0 +1,35 @@
+; show draws the 16 bytes at results in hex, 6 per row.
+; Only uses LD, ADD, SHR, AND, SE, SNE, JP, RET, LD F, DRW, LD I, ADD I
+; and LD V0, [I] with every register in a known state.
+show:   LD VA, 0                ; index
+        LD VB, 0                ; x
+        LD VC, 0                ; y
+        LD VD, #0F
+show.next:
+        LD I, results
+        ADD I, VA
+        LD V0, [I]
+        LD V1, V0
+        SHR V1
+        SHR V1
+        SHR V1
+        SHR V1
+        LD F, V1
+        DRW VB, VC, 5
+        ADD VB, 5
+        LD V1, V0
+        AND V1, VD
+        LD F, V1
+        DRW VB, VC, 5
+        ADD VB, 5
+        ADD VA, 1
+        SNE VA, 16
+        RET
+        SE VB, 60
+        JP show.next
+        LD VB, 0
+        ADD VC, 6
+        JP show.next
+
+results:
+        DB 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0
@@ -0,0 +1,42 @@
+; xochip draws with the XO-CHIP opcodes: both planes, long I, register
+; ranges and scrolling up
+        LD I, LONG sprite       ; F000 nnnn
+        PLANE 3                 ; Fn01
+        LD V0, 4
+        LD V1, 4
+        DRW V0, V1, 4           ; 4 rows of both planes
+        PLANE 2
+        LD V0, 20
+        DRW V0, V1, 4
+        PLANE 3
+        SCU 2                   ; 00Dn
+        LD I, LONG values
+        LD V4-V6, [I]           ; 5xy3
+        LD I, LONG copy
+        LD [I], V4-V6           ; 5xy2
+        LD I, LONG copy
+        LD V0-V2, [I]
+        PLANE 1
+        LD F, V2
+        LD V3, 40
+        LD V4, 10
+        DRW V3, V4, 5           ; shows 9 from V2
+        LD I, LONG pattern
+        AUDIO                   ; F002
+        LD V5, 100
+        PITCH V5                ; Fx3A
+halt:   JP halt
+
+sprite: SPRITE ########
+        SPRITE #......#
+        SPRITE #......#
+        SPRITE ########
+        SPRITE ########
+        SPRITE ########
+        SPRITE ........
+        SPRITE ########
+values: DB 7, 8, 9
+copy:   DB 0, 0, 0
+pattern:
+        DB #F0, #F0, #F0, #F0, #0F, #0F, #0F, #0F
+        DB #F0, #F0, #F0, #F0, #0F, #0F, #0F, #0F
@@ -0,0 +1,100 @@
+package chip8
+
+import (
+	"sync"
+	"time"
+)
+
+// Limits of Emulator.SetSpeed
+const (
+	MinSpeed = 1.0 / 16
+	MaxSpeed = 64.0
+)
+
+// runControl holds the requests of other goroutines to Run.
+type runControl struct {
+	mu     sync.Mutex
+	paused bool
+	steps  int     // frames to run while paused
+	speed  float64 // zero value means 1
+	wake   chan struct{}
+}
+
+// update changes the control under the lock and wakes up a paused Run.
+func (c *runControl) update(f func()) {
+	c.mu.Lock()
+	f()
+	if c.wake == nil {
+		c.wake = make(chan struct{}, 1)
+	}
+	c.mu.Unlock()
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next reports whether Run runs the next frame and at which speed.
+func (c *runControl) next() (run bool, speed float64, wake <-chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.wake == nil {
+		c.wake = make(chan struct{}, 1)
+	}
+	speed = c.speed
+	if speed == 0 {
+		speed = 1
+	}
+	switch {
+	case !c.paused:
+		return true, speed, c.wake
+	case c.steps > 0:
+		c.steps--
+		return true, speed, c.wake
+	}
+	return false, speed, c.wake
+}
+
+// Pause makes Run stop after the current frame until Resume.
+// Safe to call from any goroutine, like all methods of the run control.
+func (e *Emulator) Pause() {
+	e.control.update(func() { e.control.paused = true })
+}
+
+// Resume continues a paused Run.
+func (e *Emulator) Resume() {
+	e.control.update(func() { e.control.paused, e.control.steps = false, 0 })
+}
+
+func (e *Emulator) Paused() bool {
+	e.control.mu.Lock()
+	defer e.control.mu.Unlock()
+	return e.control.paused
+}
+
+// StepFrame makes a paused Run run one more frame.
+func (e *Emulator) StepFrame() {
+	e.control.update(func() { e.control.steps++ })
+}
+
+// SetSpeed sets the frame rate of Run to FrameRate * speed, e.g. 0.5 for
+// slow motion or 4 to fast-forward. The timers run at the same speed. The
+// speed is limited to MinSpeed - MaxSpeed.
+func (e *Emulator) SetSpeed(speed float64) {
+	speed = min(max(speed, MinSpeed), MaxSpeed)
+	e.control.update(func() { e.control.speed = speed })
+}
+
+func (e *Emulator) Speed() float64 {
+	e.control.mu.Lock()
+	defer e.control.mu.Unlock()
+	if e.control.speed == 0 {
+		return 1
+	}
+	return e.control.speed
+}
+
+// framePeriod returns the duration of a frame at the speed.
+func framePeriod(speed float64) time.Duration {
+	return time.Duration(float64(time.Second/FrameRate) / speed)
+}
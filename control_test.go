@@ -0,0 +1,69 @@
+package chip8
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// MockFrames is an Input that counts the frames of RunFrame.
+type MockFrames struct {
+	MockInput
+	frames atomic.Int32
+}
+
+func (k *MockFrames) EndFrame(e *Emulator) error {
+	k.frames.Add(1)
+	return nil
+}
+
+func TestRunControl(t *testing.T) {
+	input := &MockFrames{}
+	e, err := CreateEmulator(&GraphicsHeadless{}, input, &AudioNull{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.LoadProgram([]byte{0x12, 0x00}) // JP #200
+
+	// waitFrames waits until at least n frames ran
+	waitFrames := func(n int32) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); input.frames.Load() < n; {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %d frames, ran %d", n, input.frames.Load())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	e.Pause()
+	go func() { done <- e.Run(ctx) }()
+
+	e.StepFrame()
+	e.StepFrame()
+	waitFrames(2)
+	time.Sleep(50 * time.Millisecond)
+	if n := input.frames.Load(); n != 2 || !e.Paused() {
+		t.Errorf("Paused Run ran %d frames, expected 2", n)
+	}
+
+	e.SetSpeed(MaxSpeed * 2)
+	if e.Speed() != MaxSpeed {
+		t.Errorf("Speed not limited, speed=%g", e.Speed())
+	}
+	e.Resume()
+	waitFrames(20)
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("Expected context.Canceled, actual=%v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Run did not return after cancel")
+	}
+}
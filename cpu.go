@@ -13,46 +13,60 @@ type CPU struct {
 	PC    uint16     // program counter
 	SP    byte       // stack pointer
 	Stack [16]uint16 // stack
+	Hires bool       // SUPER-CHIP high resolution mode
+	Flags [16]byte   // SUPER-CHIP RPL user flags, 16 on XO-CHIP
+
+	Planes  byte     // XO-CHIP selected bitplanes
+	Pattern [16]byte // XO-CHIP audio pattern buffer
+	Pitch   byte     // XO-CHIP audio pattern playback pitch
 }
 
-func (cpu *CPU) fetch(m *Memory) uint16 {
-	return ((uint16(m[cpu.PC]) << 8) | uint16(m[cpu.PC+1]))
+func (cpu *CPU) fetch(m Bus) uint16 {
+	return m.Fetch(cpu.PC)
 }
 
 func (cpu *CPU) execute(opcode uint16, e *Emulator) error {
 	var err error = nil
+	m := e.bus()
 	opnr := OpNr(opcode)
 	switch opnr {
 	case 0:
-		err = OpNr0(opcode, &e.CPU, &e.Memory, e.Graphics)
+		err = OpNr0(opcode, &e.CPU, m, &e.Display)
 	case 1:
-		err = OpNr1(opcode, &e.CPU, &e.Memory)
+		err = OpNr1(opcode, &e.CPU, m)
 	case 2:
-		err = OpNr2(opcode, &e.CPU, &e.Memory)
+		err = OpNr2(opcode, &e.CPU, m)
 	case 3:
-		err = OpNr3(opcode, &e.CPU, &e.Memory)
+		err = OpNr3(opcode, &e.CPU, m)
 	case 4:
-		err = OpNr4(opcode, &e.CPU, &e.Memory)
+		err = OpNr4(opcode, &e.CPU, m)
 	case 5:
-		err = OpNr5(opcode, &e.CPU, &e.Memory)
+		err = OpNr5(opcode, &e.CPU, m)
 	case 6:
-		err = OpNr6(opcode, &e.CPU, &e.Memory)
+		err = OpNr6(opcode, &e.CPU, m)
 	case 7:
-		err = OpNr7(opcode, &e.CPU, &e.Memory)
+		err = OpNr7(opcode, &e.CPU, m)
 	case 8:
-		err = OpNr8(opcode, &e.CPU, &e.Memory)
+		err = OpNr8(opcode, &e.CPU, m, &e.Quirks)
 	case 9:
-		err = OpNr9(opcode, &e.CPU, &e.Memory)
+		err = OpNr9(opcode, &e.CPU, m)
 	case 0xa:
-		err = OpNrA(opcode, &e.CPU, &e.Memory)
+		err = OpNrA(opcode, &e.CPU, m)
 	case 0xb:
-		err = OpNrB(opcode, &e.CPU, &e.Memory)
+		err = OpNrB(opcode, &e.CPU, m, &e.Quirks)
 	case 0xc:
-		err = OpNrC(opcode, &e.CPU, &e.Memory)
+		err = OpNrC(opcode, &e.CPU, m, e.RNG)
 	case 0xd:
-		err = OpNrD(opcode, &e.CPU, &e.Memory, e.Graphics)
+		if e.Quirks.DisplayWait && !e.vblank {
+			// wait for the vertical blank, the opcode is executed again on the next step
+			return nil
+		}
+		e.vblank = false
+		err = OpNrD(opcode, &e.CPU, m, &e.Display, &e.Quirks)
+	case 0xe:
+		err = OpNrE(opcode, &e.CPU, m, &e.Keypad)
 	case 0xf:
-		err = OpNrF(opcode, &e.CPU, &e.Memory)
+		err = OpNrF(opcode, &e.CPU, m, &e.Display, &e.Keypad, &e.Quirks)
 	default:
 		err = ErrUnknownOpcode(opcode)
 	}
@@ -66,9 +80,11 @@ func (cpu *CPU) execute(opcode uint16, e *Emulator) error {
 		return err
 	}
 
-	if e.CPU.PC += 2; e.CPU.PC >= uint16(len(e.Memory)) {
-		err = ErrOutOfBounds{"PC out of bounds"}
+	pc := int(e.CPU.PC) + 2
+	if pc >= MemorySize {
+		return ErrOutOfBounds{"PC out of bounds"}
 	}
+	e.CPU.PC = uint16(pc)
 	return err
 }
 
@@ -83,6 +99,8 @@ func (cpu *CPU) delayTick() {
 
 func (cpu *CPU) Init() error {
 	cpu.PC = 0x200
+	cpu.Planes = 1
+	cpu.Pitch = DefaultPitch
 	return nil
 }
 
@@ -1,39 +1,48 @@
 package chip8
 
-import (
-	"fmt"
-	"testing"
-)
+import "testing"
 
+// MockDisplay is a Graphics that records the presented frames.
 type MockDisplay struct {
-	clear, drawbytes int
-	x, y             byte
+	frames int
+	dirty  Rect
 }
 
-func (d *MockDisplay) Create() error {
+func (d *MockDisplay) Init() error {
 	return nil
 }
 
-func (d *MockDisplay) Destroy() {
+func (d *MockDisplay) Close() {
 }
 
-func (d *MockDisplay) Clear() {
-	d.clear += 1
+func (d *MockDisplay) Present(frame *Framebuffer, dirty Rect) {
+	d.frames++
+	d.dirty = dirty
 }
 
-func (d *MockDisplay) Update() {
+// newDisplay returns an initialized low resolution Display.
+func newDisplay() *Display {
+	d := &Display{}
+	d.Init()
+	return d
 }
 
-func (d *MockDisplay) Draw(x, y byte, sprite []byte) (collision byte) {
-	d.x = x
-	d.y = y
-	d.drawbytes = len(sprite)
-	collision = 0
-	return
+type MockInput struct {
+	keys uint16
 }
 
-func (d *MockDisplay) String() string {
-	return fmt.Sprintf("x=%d y=%d drawbytes=%d", d.x, d.y, d.drawbytes)
+func (k *MockInput) Init() error {
+	return nil
+}
+
+func (k *MockInput) Close() {
+}
+
+func (k *MockInput) WaitForEvent() {
+}
+
+func (k *MockInput) Keys() uint16 {
+	return k.keys
 }
 
 // Test opcode getter functions
@@ -62,7 +71,7 @@ func TestOpFuncs(t *testing.T) {
 func TestOpNr0(t *testing.T) {
 	r := CPU{}
 	m := Memory{}
-	d := &MockDisplay{}
+	d := newDisplay()
 	var opcode uint16 = 0x0000
 
 	if err := OpNr0(opcode, &r, &m, d); err != nil {
@@ -70,11 +79,12 @@ func TestOpNr0(t *testing.T) {
 	}
 
 	opcode = 0x00e0
+	d.Draw(0, 0, []byte{0x80}, 8, false)
 	if err := OpNr0(opcode, &r, &m, d); err != nil {
 		t.Error(err)
 	}
-	if d.clear != 1 {
-		t.Errorf("Display was not cleared, clear=%d", d.clear)
+	if d.Pixel(0, 0) != 0 {
+		t.Errorf("Display was not cleared")
 	}
 
 	opcode = 0x00ee
@@ -89,6 +99,42 @@ func TestOpNr0(t *testing.T) {
 	if r.PC != 0xabcd {
 		t.Errorf("Wrong PC, expected=%04x\n%s", 0xabcd, r.String())
 	}
+
+	scrolls := []struct {
+		op     uint16
+		dx, dy int
+	}{
+		{0x00c5, 0, 5},
+		{0x00fb, 4, 0},
+		{0x00fc, -4, 0},
+	}
+	for _, data := range scrolls {
+		d.Clear()
+		d.Draw(10, 10, []byte{0x80}, 8, false)
+		if err := OpNr0(data.op, &r, &m, d); err != nil {
+			t.Error(err)
+		}
+		if d.Pixel(10+data.dx, 10+data.dy) == 0 || d.Pixel(10, 10) != 0 {
+			t.Errorf("%04x: Wrong scroll, expected=%d,%d", data.op, data.dx, data.dy)
+		}
+	}
+
+	if err := OpNr0(0x00ff, &r, &m, d); err != nil {
+		t.Error(err)
+	}
+	if !r.Hires || d.Width != HiresWidth || d.Height != HiresHeight {
+		t.Errorf("00FF did not switch to high resolution, resize=%dx%d", d.Width, d.Height)
+	}
+	if err := OpNr0(0x00fe, &r, &m, d); err != nil {
+		t.Error(err)
+	}
+	if r.Hires || d.Width != int(DisplayWidth) || d.Height != int(DisplayHeigth) {
+		t.Errorf("00FE did not switch to low resolution, resize=%dx%d", d.Width, d.Height)
+	}
+
+	if err := OpNr0(0x00fd, &r, &m, d); err != ErrExit {
+		t.Errorf("00FD did not exit, err=%v", err)
+	}
 }
 
 func TestOpNr1(t *testing.T) {
@@ -223,10 +269,11 @@ func TestOpNr7(t *testing.T) {
 func TestOpNr8(t *testing.T) {
 	r := CPU{}
 	m := Memory{}
+	q := QuirksModern
 
 	var opcode uint16 = 0x8010
 	r.V[1] = 0x1
-	if err := OpNr8(opcode, &r, &m); err != nil {
+	if err := OpNr8(opcode, &r, &m, &q); err != nil {
 		t.Error(err)
 	}
 	if r.V[0] != 1 {
@@ -237,7 +284,7 @@ func TestOpNr8(t *testing.T) {
 	r.V[0] = 0
 	r.V[1] = 0xf0
 	expected := r.V[0] | r.V[1]
-	if err := OpNr8(opcode, &r, &m); err != nil {
+	if err := OpNr8(opcode, &r, &m, &q); err != nil {
 		t.Error(err)
 	}
 	if r.V[0] != expected {
@@ -248,7 +295,7 @@ func TestOpNr8(t *testing.T) {
 	r.V[0] = 0
 	r.V[1] = 0xf0
 	expected = r.V[0] & r.V[1]
-	if err := OpNr8(opcode, &r, &m); err != nil {
+	if err := OpNr8(opcode, &r, &m, &q); err != nil {
 		t.Error(err)
 	}
 	if r.V[0] != expected {
@@ -259,7 +306,7 @@ func TestOpNr8(t *testing.T) {
 	r.V[0] = 0
 	r.V[1] = 0xf0
 	expected = r.V[0] ^ r.V[1]
-	if err := OpNr8(opcode, &r, &m); err != nil {
+	if err := OpNr8(opcode, &r, &m, &q); err != nil {
 		t.Error(err)
 	}
 	if r.V[0] != expected {
@@ -270,7 +317,7 @@ func TestOpNr8(t *testing.T) {
 	r.V[0] = 0
 	r.V[1] = 0xf0
 	expected = r.V[0] + r.V[1]
-	if err := OpNr8(opcode, &r, &m); err != nil {
+	if err := OpNr8(opcode, &r, &m, &q); err != nil {
 		t.Error(err)
 	}
 	if r.V[0] != expected {
@@ -283,7 +330,7 @@ func TestOpNr8(t *testing.T) {
 	r.V[0] = 0xf0
 	r.V[1] = 0xf0
 	expected = r.V[0] + r.V[1]
-	if err := OpNr8(opcode, &r, &m); err != nil {
+	if err := OpNr8(opcode, &r, &m, &q); err != nil {
 		t.Error(err)
 	}
 	if r.V[0] != expected {
@@ -297,7 +344,7 @@ func TestOpNr8(t *testing.T) {
 	r.V[0] = 0
 	r.V[1] = 0xf0
 	expected = r.V[0] - r.V[1]
-	if err := OpNr8(opcode, &r, &m); err != nil {
+	if err := OpNr8(opcode, &r, &m, &q); err != nil {
 		t.Error(err)
 	}
 	if r.V[0] != expected {
@@ -307,11 +354,23 @@ func TestOpNr8(t *testing.T) {
 		t.Errorf("Wrong Vf, expected=%04x\n%s", 0, r.String())
 	}
 
+	// equal operands do not borrow
+	for _, opcode := range []uint16{0x8015, 0x8017} {
+		r.V[0] = 0x42
+		r.V[1] = 0x42
+		if err := OpNr8(opcode, &r, &m, &q); err != nil {
+			t.Error(err)
+		}
+		if r.V[0] != 0 || r.V[0xf] != 1 {
+			t.Errorf("Wrong V0 or Vf of %04x with equal operands, expected=00 and 01\n%s", opcode, r.String())
+		}
+	}
+
 	opcode = 0x8016
 	r.V[0] = 11
 	r.V[1] = 0x0
 	expected = r.V[0] / 2
-	if err := OpNr8(opcode, &r, &m); err != nil {
+	if err := OpNr8(opcode, &r, &m, &q); err != nil {
 		t.Error(err)
 	}
 	if r.V[0] != expected {
@@ -325,7 +384,7 @@ func TestOpNr8(t *testing.T) {
 	r.V[0] = 11
 	r.V[1] = 0x0
 	expected = r.V[1] - r.V[0]
-	if err := OpNr8(opcode, &r, &m); err != nil {
+	if err := OpNr8(opcode, &r, &m, &q); err != nil {
 		t.Error(err)
 	}
 	if r.V[0] != expected {
@@ -339,7 +398,7 @@ func TestOpNr8(t *testing.T) {
 	r.V[0] = 0xf0
 	r.V[1] = 0x0
 	expected = r.V[0] * 2
-	if err := OpNr8(opcode, &r, &m); err != nil {
+	if err := OpNr8(opcode, &r, &m, &q); err != nil {
 		t.Error(err)
 	}
 	if r.V[0] != expected {
@@ -381,11 +440,12 @@ func TestOpNrA(t *testing.T) {
 func TestOpNrB(t *testing.T) {
 	r := CPU{}
 	m := Memory{}
+	q := QuirksModern
 
 	var opcode uint16 = 0xb010
 	r.V[0] = 0xab
 	expected := uint16(0x10) + uint16(r.V[0])
-	if err := OpNrB(opcode, &r, &m); err != nil {
+	if err := OpNrB(opcode, &r, &m, &q); err != nil {
 		t.Error(err)
 	}
 	if r.PC != expected {
@@ -394,29 +454,135 @@ func TestOpNrB(t *testing.T) {
 }
 
 func TestOpNrD(t *testing.T) {
-	r := CPU{}
+	r := CPU{Planes: 1}
 	m := Memory{}
-	d := &MockDisplay{}
+	q := QuirksModern
+	d := newDisplay()
+	for i := range m[:32] {
+		m[i] = 0xff
+	}
 
 	var opcode uint16 = 0xd015
 	r.V[0] = 10
 	r.V[1] = 15
-	if err := OpNrD(opcode, &r, &m, d); err != nil {
+	d.flush()
+	if err := OpNrD(opcode, &r, &m, d, &q); err != nil {
 		t.Error(err)
 	}
-	if d.x != 10 || d.y != 15 || d.drawbytes != 5 {
-		t.Errorf("Wrong Display state: %s", d.String())
+	if dirty := d.Dirty(); dirty != (Rect{10, 15, 8, 5}) || r.V[0xf] != 0 {
+		t.Errorf("Wrong sprite drawn, dirty=%v VF=%d", dirty, r.V[0xf])
+	}
+
+	// 16x16 sprite, collides with the previous one
+	opcode = 0xd010
+	d.flush()
+	if err := OpNrD(opcode, &r, &m, d, &q); err != nil {
+		t.Error(err)
+	}
+	if dirty := d.Dirty(); dirty != (Rect{10, 15, 16, 16}) || r.V[0xf] != 1 {
+		t.Errorf("Wrong sprite drawn, dirty=%v VF=%d", dirty, r.V[0xf])
+	}
+	if d.Pixel(10, 15) != 0 || d.Pixel(18, 15) == 0 {
+		t.Errorf("Sprite not XORed")
+	}
+}
+
+func TestOpNrE(t *testing.T) {
+	r := CPU{}
+	m := Memory{}
+	k := Keypad{}
+
+	var opcode uint16 = 0xe09e
+	r.V[0] = 0xa
+	if err := OpNrE(opcode, &r, &m, &k); err != nil {
+		t.Error(err)
+	}
+	if r.PC != 0 {
+		t.Errorf("Wrong PC, expected=%04x\n%s", 0, r.String())
+	}
+	k.Update(1 << 0xa)
+	if err := OpNrE(opcode, &r, &m, &k); err != nil {
+		t.Error(err)
+	}
+	if r.PC != 2 {
+		t.Errorf("Wrong PC, expected=%04x\n%s", 2, r.String())
+	}
+
+	opcode = 0xe0a1
+	r.PC = 0
+	if err := OpNrE(opcode, &r, &m, &k); err != nil {
+		t.Error(err)
+	}
+	if r.PC != 0 {
+		t.Errorf("Wrong PC, expected=%04x\n%s", 0, r.String())
+	}
+	k.Update(0)
+	if err := OpNrE(opcode, &r, &m, &k); err != nil {
+		t.Error(err)
+	}
+	if r.PC != 2 {
+		t.Errorf("Wrong PC, expected=%04x\n%s", 2, r.String())
+	}
+
+	opcode = 0xe0ff
+	if err := OpNrE(opcode, &r, &m, &k); err == nil {
+		t.Errorf("Expected ErrUnknownOpcode for %04x", opcode)
+	}
+}
+
+func TestKeyWait(t *testing.T) {
+	r := CPU{}
+	m := Memory{}
+	q := QuirksModern
+	k := Keypad{}
+	d := newDisplay()
+	var opcode uint16 = 0xf30a
+
+	// a key released before the wait started is ignored
+	r.PC = 0x202
+	k.Update(1 << 5)
+	k.Update(0)
+	if err := OpNrF(opcode, &r, &m, d, &k, &q); err != nil {
+		t.Error(err)
+	}
+	if r.PC != 0x200 {
+		t.Errorf("Wrong PC, expected=%04x\n%s", 0x200, r.String())
+	}
+
+	// pressing is not enough, the key has to be released
+	r.PC = 0x202
+	k.Update(1 << 7)
+	if err := OpNrF(opcode, &r, &m, d, &k, &q); err != nil {
+		t.Error(err)
+	}
+	if r.PC != 0x200 {
+		t.Errorf("Wrong PC, expected=%04x\n%s", 0x200, r.String())
+	}
+
+	r.PC = 0x202
+	k.Update(0)
+	if err := OpNrF(opcode, &r, &m, d, &k, &q); err != nil {
+		t.Error(err)
+	}
+	if r.PC != 0x202 {
+		t.Errorf("Wrong PC, expected=%04x\n%s", 0x202, r.String())
+	}
+	if r.V[3] != 7 {
+		t.Errorf("Wrong V3, expected=%02x\n%s", 7, r.String())
 	}
 }
 
 func TestOpNrF(t *testing.T) {
 	r := CPU{}
 	m := Memory{}
+	q := QuirksModern
+	k := Keypad{}
+	d := newDisplay()
 
 	var opcode uint16 = 0xf007
 	r.DT = 0xa
 	expected := r.DT
-	if err := OpNrF(opcode, &r, &m); err != nil {
+	if err := OpNrF(opcode, &r, &m, d, &k, &q); err != nil {
 		t.Error(err)
 	}
 	if r.V[0] != expected {
@@ -427,7 +593,7 @@ func TestOpNrF(t *testing.T) {
 	r.V[0] = 0xa
 	r.DT = 0
 	expected = r.V[0]
-	if err := OpNrF(opcode, &r, &m); err != nil {
+	if err := OpNrF(opcode, &r, &m, d, &k, &q); err != nil {
 		t.Error(err)
 	}
 	if r.DT != expected {
@@ -438,7 +604,7 @@ func TestOpNrF(t *testing.T) {
 	r.V[0] = 0xa
 	r.ST = 0
 	expected = r.V[0]
-	if err := OpNrF(opcode, &r, &m); err != nil {
+	if err := OpNrF(opcode, &r, &m, d, &k, &q); err != nil {
 		t.Error(err)
 	}
 	if r.ST != expected {
@@ -449,7 +615,7 @@ func TestOpNrF(t *testing.T) {
 	r.V[0] = 0xa
 	r.I = 0
 	expected = r.V[0]
-	if err := OpNrF(opcode, &r, &m); err != nil {
+	if err := OpNrF(opcode, &r, &m, d, &k, &q); err != nil {
 		t.Error(err)
 	}
 	if r.I != uint16(expected) {
@@ -459,7 +625,7 @@ func TestOpNrF(t *testing.T) {
 	opcode = 0xf033
 	r.V[0] = 234
 	r.I = 1
-	if err := OpNrF(opcode, &r, &m); err != nil {
+	if err := OpNrF(opcode, &r, &m, d, &k, &q); err != nil {
 		t.Error(err)
 	}
 	if m[1] != 2 && m[2] != 3 && m[3] != 4 {
@@ -471,7 +637,7 @@ func TestOpNrF(t *testing.T) {
 	r.V[1] = 0xcd
 	r.V[2] = 0xef
 	r.I = 1
-	if err := OpNrF(opcode, &r, &m); err != nil {
+	if err := OpNrF(opcode, &r, &m, d, &k, &q); err != nil {
 		t.Error(err)
 	}
 	if m[1] != 0xab && m[2] != 0xcd && m[3] != 0xef {
@@ -483,7 +649,7 @@ func TestOpNrF(t *testing.T) {
 	r.V[1] = 0
 	r.V[2] = 0
 	r.I = 1
-	if err := OpNrF(opcode, &r, &m); err != nil {
+	if err := OpNrF(opcode, &r, &m, d, &k, &q); err != nil {
 		t.Error(err)
 	}
 	if r.V[0] != 0xab && r.V[1] != 0xcd && r.V[2] != 0xef {
@@ -493,11 +659,185 @@ func TestOpNrF(t *testing.T) {
 	opcode = 0xf029
 	r.V[0] = 5
 	r.I = 0
-	if err := OpNrF(opcode, &r, &m); err != nil {
+	if err := OpNrF(opcode, &r, &m, d, &k, &q); err != nil {
 		t.Error(err)
 	}
 	if r.I != 25 {
 		t.Errorf("Wrong I, expected=%04x\n%s", 25, r.String())
 	}
 
+	opcode = 0xf030
+	r.V[0] = 5
+	if err := OpNrF(opcode, &r, &m, d, &k, &q); err != nil {
+		t.Error(err)
+	}
+	if r.I != BigFontAddress+50 {
+		t.Errorf("Wrong I, expected=%04x\n%s", BigFontAddress+50, r.String())
+	}
+
+	opcode = 0xf275
+	r.V[0], r.V[1], r.V[2] = 1, 2, 3
+	if err := OpNrF(opcode, &r, &m, d, &k, &q); err != nil {
+		t.Error(err)
+	}
+	r.V[0], r.V[1], r.V[2] = 0, 0, 0
+	opcode = 0xf285
+	if err := OpNrF(opcode, &r, &m, d, &k, &q); err != nil {
+		t.Error(err)
+	}
+	if r.V[0] != 1 || r.V[1] != 2 || r.V[2] != 3 {
+		t.Errorf("Wrong V[] after Fx75, Fx85\n%s", r.String())
+	}
+
+}
+
+func TestQuirks(t *testing.T) {
+	r := CPU{}
+	m := Memory{}
+	k := Keypad{}
+	d := newDisplay()
+
+	q := Quirks{VFReset: true}
+	r.V[0xf] = 1
+	if err := OpNr8(0x8011, &r, &m, &q); err != nil {
+		t.Error(err)
+	}
+	if r.V[0xf] != 0 {
+		t.Errorf("VF not reset by 8xy1\n%s", r.String())
+	}
+
+	q = Quirks{Shift: false}
+	r.V[0] = 0
+	r.V[1] = 3
+	if err := OpNr8(0x8016, &r, &m, &q); err != nil {
+		t.Error(err)
+	}
+	if r.V[0] != 1 || r.V[0xf] != 1 {
+		t.Errorf("8xy6 did not shift Vy into Vx\n%s", r.String())
+	}
+
+	// the flag wins if x is F
+	r.V[0xf] = 0x81
+	if err := OpNr8(0x8ffe, &r, &m, &q); err != nil {
+		t.Error(err)
+	}
+	if r.V[0xf] != 1 {
+		t.Errorf("Wrong VF after 8FFE\n%s", r.String())
+	}
+
+	q = Quirks{Jump: true}
+	r.V[0] = 1
+	r.V[2] = 2
+	if err := OpNrB(0xb210, &r, &m, &q); err != nil {
+		t.Error(err)
+	}
+	if r.PC != 0x212 {
+		t.Errorf("Bxnn did not jump to xnn + Vx\n%s", r.String())
+	}
+
+	for _, data := range []struct {
+		mode     IncrementMode
+		expected uint16
+	}{
+		{IncrementNone, 0x300},
+		{IncrementX, 0x302},
+		{IncrementX1, 0x303},
+	} {
+		q = Quirks{LoadStore: data.mode}
+		for _, opcode := range []uint16{0xf255, 0xf265} {
+			r.I = 0x300
+			if err := OpNrF(opcode, &r, &m, d, &k, &q); err != nil {
+				t.Error(err)
+			}
+			if r.I != data.expected {
+				t.Errorf("%04x: Wrong I for increment mode %d, expected=%04x\n%s", opcode, data.mode, data.expected, r.String())
+			}
+		}
+	}
+}
+
+func TestDisplayWait(t *testing.T) {
+	d := &MockDisplay{}
+	e, err := CreateEmulator(d, &MockInput{}, &AudioNull{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Quirks = QuirksCOSMAC
+	// DRW V0, V0, 1; DRW V0, V0, 2
+	e.LoadProgram([]byte{0xd0, 0x01, 0xd0, 0x02})
+
+	if err := e.Step(false); err != nil {
+		t.Fatal(err)
+	}
+	if e.CPU.PC != 0x200 || d.frames != 0 {
+		t.Errorf("Dxyn did not wait for the vertical blank, PC=%04x frames=%d", e.CPU.PC, d.frames)
+	}
+	if err := e.Step(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Step(false); err != nil {
+		t.Fatal(err)
+	}
+	if e.CPU.PC != 0x202 || e.Display.Dirty() != (Rect{0, 0, 8, 1}) {
+		t.Errorf("Dxyn was not executed after the vertical blank, PC=%04x dirty=%v", e.CPU.PC, e.Display.Dirty())
+	}
+	if d.frames != 1 || d.dirty != (Rect{0, 0, 64, 32}) {
+		t.Errorf("First frame not presented, frames=%d dirty=%v", d.frames, d.dirty)
+	}
+	if err := e.Step(false); err != nil {
+		t.Fatal(err)
+	}
+	if e.CPU.PC != 0x202 {
+		t.Errorf("second Dxyn did not wait for the vertical blank, PC=%04x", e.CPU.PC)
+	}
+}
+
+func TestXOCHIP(t *testing.T) {
+	e, err := CreateEmulator(&MockDisplay{}, &MockInput{}, &AudioNull{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Quirks = QuirksXOCHIP
+	e.LoadProgram([]byte{
+		0xf0, 0x00, 0xab, 0xcd, // LD I, long 0xabcd
+		0x30, 0x00, // SE V0, 0
+		0xf0, 0x00, 0x12, 0x34, // skipped as one instruction
+		0xf2, 0x01, // PLANE 2
+		0xf1, 0x3a, // PITCH V1
+	})
+
+	for i := 0; i < 4; i++ {
+		if err := e.Step(false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if e.CPU.I != 0xabcd {
+		t.Errorf("Wrong I, expected=%04x\n%s", 0xabcd, e.CPU.String())
+	}
+	if e.CPU.PC != 0x20e {
+		t.Errorf("Wrong PC, expected=%04x\n%s", 0x20e, e.CPU.String())
+	}
+	if e.CPU.Planes != 2 {
+		t.Errorf("Wrong planes, expected=%d actual=%d", 2, e.CPU.Planes)
+	}
+	if e.CPU.Pitch != 0 {
+		t.Errorf("Wrong pitch, expected=%d actual=%d", 0, e.CPU.Pitch)
+	}
+
+	r := CPU{}
+	m := Memory{}
+	r.V[1], r.V[2], r.V[3] = 1, 2, 3
+	r.I = 0xf000
+	if err := OpNr5(0x5132, &r, &m); err != nil {
+		t.Error(err)
+	}
+	if m[0xf000] != 1 || m[0xf001] != 2 || m[0xf002] != 3 || r.I != 0xf000 {
+		t.Errorf("Wrong memory after 5132: % x", m[0xf000:0xf003])
+	}
+	if err := OpNr5(0x5313, &r, &m); err != nil {
+		t.Error(err)
+	}
+	if r.V[3] != 1 || r.V[2] != 2 || r.V[1] != 3 {
+		t.Errorf("Wrong V[] after 5313\n%s", r.String())
+	}
 }
@@ -0,0 +1,714 @@
+// Package dap is a Debug Adapter Protocol server, it lets editors like
+// VS Code debug programs with breakpoints in the assembler sources, stepping,
+// the registers and the stack as variables and a memory view. Source lines
+// are mapped to addresses with the symbol file written by chip8 asm -s.
+package dap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/debuggerpls/go-chip8"
+	"github.com/debuggerpls/go-chip8/asm"
+	"github.com/debuggerpls/go-chip8/debug"
+	"github.com/debuggerpls/go-chip8/disasm"
+)
+
+// Arguments of launch and attach requests
+type LaunchArguments struct {
+	Program     string `json:"program"`
+	Symbols     string `json:"symbols"` // symbol file, PROGRAM.sym if it exists
+	Quirks      string `json:"quirks"`
+	StopOnEntry bool   `json:"stopOnEntry"`
+}
+
+type Server struct {
+	// Debugger is debugged by attach requests.
+	Debugger *debug.Debugger
+	// Launch creates the debugger for launch requests, its emulator is
+	// closed at the end of the session.
+	Launch func(args LaunchArguments) (*debug.Debugger, error)
+}
+
+// The only thread, CHIP-8 has one CPU
+const threadID = 1
+
+// Variable references of the scopes
+const (
+	registersRef = 1
+	stackRef     = 2
+)
+
+type stop struct {
+	reason debug.Reason
+	err    error
+	step   bool // the stop of a step request
+}
+
+type session struct {
+	s        *Server
+	d        *debug.Debugger
+	w        io.Writer
+	seq      int
+	launched bool
+
+	stopOnEntry bool
+	sources     map[string][]uint16 // breakpoints by source file
+	insts       []uint16            // instruction breakpoints
+	running     bool
+	stopped     chan stop
+}
+
+// ListenAndServe accepts connections on addr and serves one at a time.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		err = s.Serve(conn, conn)
+		conn.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Serve runs one debug session until the client disconnects.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	ss := &session{
+		s:       s,
+		w:       w,
+		sources: map[string][]uint16{},
+		stopped: make(chan stop, 1),
+	}
+	defer ss.close()
+
+	requests := make(chan request)
+	done := make(chan struct{})
+	defer close(done)
+	var readErr error
+	go func() {
+		defer close(requests)
+		br := bufio.NewReader(r)
+		for {
+			var req request
+			if readErr = readMessage(br, &req); readErr != nil {
+				return
+			}
+			select {
+			case requests <- req:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case req, ok := <-requests:
+			if !ok {
+				if errors.Is(readErr, io.EOF) {
+					return nil
+				}
+				return readErr
+			}
+			quit, err := ss.handle(req)
+			if err != nil || quit {
+				return err
+			}
+		case st := <-ss.stopped:
+			ss.running = false
+			if err := ss.reportStop(st); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// close stops the program and closes a launched emulator.
+func (ss *session) close() {
+	if ss.running {
+		ss.d.Interrupt()
+		<-ss.stopped
+		ss.running = false
+	}
+	if ss.launched {
+		ss.d.Emulator.Close()
+		ss.launched = false
+	}
+}
+
+func (ss *session) send(m any) error {
+	ss.seq++
+	switch m := m.(type) {
+	case *response:
+		m.Seq = ss.seq
+	case *event:
+		m.Seq = ss.seq
+	}
+	return writeMessage(ss.w, m)
+}
+
+func (ss *session) event(name string, body any) error {
+	return ss.send(&event{Type: "event", Event: name, Body: body})
+}
+
+func (ss *session) respond(req request, body any, err error) error {
+	resp := &response{
+		Type:       "response",
+		RequestSeq: req.Seq,
+		Success:    err == nil,
+		Command:    req.Command,
+		Body:       body,
+	}
+	if err != nil {
+		resp.Message = err.Error()
+		resp.Body = nil
+	}
+	return ss.send(resp)
+}
+
+// resume runs the program in the background, the result is reported by a
+// stopped, exited or terminated event.
+func (ss *session) resume(run func() (debug.Reason, error), step bool) {
+	ss.running = true
+	go func() {
+		reason, err := run()
+		ss.stopped <- stop{reason, err, step}
+	}()
+}
+
+func (ss *session) reportStop(st stop) error {
+	body := map[string]any{"threadId": threadID, "allThreadsStopped": true}
+	switch {
+	case st.err != nil:
+		body["reason"] = "exception"
+		body["description"] = "Exception"
+		body["text"] = st.err.Error()
+	case st.reason == debug.ReasonExit:
+		if err := ss.event("exited", map[string]any{"exitCode": 0}); err != nil {
+			return err
+		}
+		return ss.event("terminated", nil)
+	case st.reason == debug.ReasonBreakpoint:
+		body["reason"] = "breakpoint"
+	case st.reason == debug.ReasonInterrupt:
+		body["reason"] = "pause"
+	case st.reason == debug.ReasonWatchpoint:
+		body["reason"] = "data breakpoint"
+		body["text"] = ss.d.Hits()[0].String()
+	default:
+		body["reason"] = "step"
+	}
+	return ss.event("stopped", body)
+}
+
+var errRunning = errors.New("the program is running")
+
+func (ss *session) handle(req request) (quit bool, err error) {
+	if ss.running {
+		switch req.Command {
+		case "pause":
+			ss.d.Interrupt()
+			return false, ss.respond(req, nil, nil)
+		case "threads":
+		case "disconnect", "terminate":
+			ss.d.Interrupt()
+			<-ss.stopped
+			ss.running = false
+		default:
+			return false, ss.respond(req, nil, errRunning)
+		}
+	}
+	if ss.d == nil {
+		switch req.Command {
+		case "initialize", "launch", "attach", "disconnect", "terminate":
+		default:
+			return false, ss.respond(req, nil, errors.New("no program, launch or attach first"))
+		}
+	}
+
+	var body any
+	switch req.Command {
+	case "initialize":
+		body = map[string]any{
+			"supportsConfigurationDoneRequest":      true,
+			"supportsSetVariable":                   true,
+			"supportsReadMemoryRequest":             true,
+			"supportsWriteMemoryRequest":            true,
+			"supportsDisassembleRequest":            true,
+			"supportsInstructionBreakpoints":        true,
+			"supportsSteppingGranularity":           true,
+			"supportsTerminateRequest":              true,
+			"supportsEvaluateForHovers":             false,
+			"supportsExceptionInfoRequest":          false,
+			"supportsSingleThreadExecutionRequests": false,
+		}
+	case "launch", "attach":
+		err = ss.start(req)
+		if err == nil {
+			// ready for breakpoints
+			if err := ss.respond(req, nil, nil); err != nil {
+				return false, err
+			}
+			return false, ss.event("initialized", nil)
+		}
+	case "configurationDone":
+		if err := ss.respond(req, nil, nil); err != nil {
+			return false, err
+		}
+		if ss.stopOnEntry {
+			return false, ss.event("stopped", map[string]any{"reason": "entry", "threadId": threadID, "allThreadsStopped": true})
+		}
+		ss.resume(ss.d.Continue, false)
+		return false, nil
+	case "setBreakpoints":
+		body, err = ss.setBreakpoints(req.Arguments)
+	case "setInstructionBreakpoints":
+		body, err = ss.setInstructionBreakpoints(req.Arguments)
+	case "setExceptionBreakpoints":
+		body = map[string]any{"breakpoints": []Breakpoint{}}
+	case "threads":
+		body = map[string]any{"threads": []Thread{{threadID, "CHIP-8"}}}
+	case "stackTrace":
+		body = ss.stackTrace()
+	case "scopes":
+		body = map[string]any{"scopes": []Scope{
+			{"Registers", registersRef, false},
+			{"Stack", stackRef, false},
+		}}
+	case "variables":
+		body, err = ss.variables(req.Arguments)
+	case "setVariable":
+		body, err = ss.setVariable(req.Arguments)
+	case "continue", "next", "stepIn", "stepOut":
+		run := map[string]func() (debug.Reason, error){
+			"continue": ss.d.Continue,
+			"next":     ss.d.StepOver,
+			"stepIn":   ss.d.Step,
+			"stepOut":  ss.d.StepOut,
+		}[req.Command]
+		if req.Command == "stepOut" && ss.d.Emulator.CPU.SP == 0 {
+			err = debug.ErrNotInSubroutine
+			break
+		}
+		if req.Command == "continue" {
+			body = map[string]any{"allThreadsContinued": true}
+		}
+		if err := ss.respond(req, body, nil); err != nil {
+			return false, err
+		}
+		ss.resume(run, req.Command != "continue")
+		return false, nil
+	case "pause":
+		// already stopped
+	case "readMemory":
+		body, err = ss.readMemory(req.Arguments)
+	case "writeMemory":
+		body, err = ss.writeMemory(req.Arguments)
+	case "disassemble":
+		body, err = ss.disassemble(req.Arguments)
+	case "evaluate":
+		body, err = ss.evaluate(req.Arguments)
+	case "disconnect", "terminate":
+		if req.Command == "terminate" {
+			if err := ss.event("terminated", nil); err != nil {
+				return false, err
+			}
+		}
+		return true, ss.respond(req, nil, nil)
+	default:
+		err = fmt.Errorf("unsupported request %s", req.Command)
+	}
+	return false, ss.respond(req, body, err)
+}
+
+func (ss *session) start(req request) error {
+	var args LaunchArguments
+	if len(req.Arguments) > 0 {
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return err
+		}
+	}
+	if ss.d != nil {
+		return errors.New("already started")
+	}
+
+	if req.Command == "launch" {
+		if ss.s.Launch == nil {
+			return errors.New("launch is not supported, attach instead")
+		}
+		d, err := ss.s.Launch(args)
+		if err != nil {
+			return err
+		}
+		ss.d, ss.launched = d, true
+	} else {
+		if ss.s.Debugger == nil {
+			return errors.New("no program to attach to")
+		}
+		ss.d = ss.s.Debugger
+	}
+	ss.stopOnEntry = args.StopOnEntry
+
+	symbols := args.Symbols
+	if symbols == "" && args.Program != "" {
+		name := strings.TrimSuffix(args.Program, filepath.Ext(args.Program)) + ".sym"
+		if _, err := os.Stat(name); err == nil {
+			symbols = name
+		}
+	}
+	if symbols != "" {
+		f, err := os.Open(symbols)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if ss.d.Symbols, err = asm.ReadSymbols(f); err != nil {
+			return fmt.Errorf("%s: %w", symbols, err)
+		}
+	}
+	return nil
+}
+
+// updateBreakpoints sets the breakpoints of all sources and instructions.
+func (ss *session) updateBreakpoints() {
+	ss.d.ClearBreakpoints()
+	for _, addrs := range ss.sources {
+		for _, addr := range addrs {
+			ss.d.AddBreakpoint(addr)
+		}
+	}
+	for _, addr := range ss.insts {
+		ss.d.AddBreakpoint(addr)
+	}
+}
+
+func (ss *session) setBreakpoints(raw json.RawMessage) (any, error) {
+	var args struct {
+		Source      Source             `json:"source"`
+		Breakpoints []SourceBreakpoint `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	var addrs []uint16
+	bps := make([]Breakpoint, len(args.Breakpoints))
+	for i, sbp := range args.Breakpoints {
+		bp := Breakpoint{Line: sbp.Line, Source: &args.Source}
+		switch {
+		case ss.d.Symbols == nil:
+			bp.Message = "no symbol file"
+		default:
+			if found := ss.d.Symbols.AddrsOf(args.Source.Path, sbp.Line); len(found) > 0 {
+				bp.Verified = true
+				bp.InstructionReference = reference(found[0])
+				addrs = append(addrs, found[0])
+			} else {
+				bp.Message = "no code at this line"
+			}
+		}
+		bps[i] = bp
+	}
+	ss.sources[args.Source.Path] = addrs
+	ss.updateBreakpoints()
+	return map[string]any{"breakpoints": bps}, nil
+}
+
+func (ss *session) setInstructionBreakpoints(raw json.RawMessage) (any, error) {
+	var args struct {
+		Breakpoints []struct {
+			InstructionReference string `json:"instructionReference"`
+			Offset               int    `json:"offset"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	ss.insts = nil
+	bps := make([]Breakpoint, len(args.Breakpoints))
+	for i, ibp := range args.Breakpoints {
+		addr, err := parseReference(ibp.InstructionReference, ibp.Offset)
+		if err != nil {
+			bps[i] = Breakpoint{Message: err.Error()}
+			continue
+		}
+		ss.insts = append(ss.insts, addr)
+		bps[i] = Breakpoint{Verified: true, InstructionReference: reference(addr)}
+	}
+	ss.updateBreakpoints()
+	return map[string]any{"breakpoints": bps}, nil
+}
+
+// Memory and instruction references are addresses, 0x0200
+func reference(addr uint16) string {
+	return fmt.Sprintf("0x%04X", addr)
+}
+
+func parseReference(ref string, offset int) (uint16, error) {
+	v, err := strconv.ParseUint(ref, 0, 32)
+	addr := int(v) + offset
+	if err != nil || addr < 0 || addr >= chip8.MemorySize {
+		return 0, fmt.Errorf("invalid address %s%+d", ref, offset)
+	}
+	return uint16(addr), nil
+}
+
+// function returns the name of the label at or before addr.
+func (ss *session) function(addr uint16) string {
+	name, best := "", -1
+	if ss.d.Symbols != nil {
+		for label, a := range ss.d.Symbols.Labels {
+			if a <= addr && (int(a) > best || int(a) == best && label < name) {
+				name, best = label, int(a)
+			}
+		}
+	}
+	switch {
+	case best < 0:
+		return reference(addr)
+	case best == int(addr):
+		return name
+	}
+	return fmt.Sprintf("%s+%d", name, int(addr)-best)
+}
+
+func (ss *session) frame(id int, addr uint16) StackFrame {
+	f := StackFrame{
+		ID:                          id,
+		Name:                        ss.function(addr),
+		InstructionPointerReference: reference(addr),
+	}
+	if ss.d.Symbols != nil {
+		if line, ok := ss.d.Symbols.LineAt(addr); ok {
+			path, _ := filepath.Abs(line.File)
+			f.Source = &Source{Name: filepath.Base(line.File), Path: path}
+			f.Line, f.Column = line.Line, 1
+		}
+	}
+	return f
+}
+
+// stackTrace returns PC and the calls on the stack, innermost first.
+func (ss *session) stackTrace() any {
+	cpu := &ss.d.Emulator.CPU
+	frames := []StackFrame{ss.frame(0, cpu.PC)}
+	for i := int(cpu.SP) - 1; i >= 0; i-- {
+		// the stack holds the address of the call
+		frames = append(frames, ss.frame(int(cpu.SP)-i, cpu.Stack[i]))
+	}
+	return map[string]any{"stackFrames": frames, "totalFrames": len(frames)}
+}
+
+func (ss *session) variables(raw json.RawMessage) (any, error) {
+	var args struct {
+		VariablesReference int `json:"variablesReference"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	vars := []Variable{}
+	cpu := &ss.d.Emulator.CPU
+	switch args.VariablesReference {
+	case registersRef:
+		for _, name := range debug.Registers {
+			v, _ := ss.d.Register(name)
+			variable := Variable{Name: name, Value: fmt.Sprintf("0x%02X", v)}
+			switch name {
+			case "I", "PC":
+				variable.Value = reference(uint16(v))
+				variable.MemoryReference = variable.Value
+			}
+			vars = append(vars, variable)
+		}
+	case stackRef:
+		for i := 0; i < int(cpu.SP); i++ {
+			vars = append(vars, Variable{
+				Name:            fmt.Sprintf("[%d]", i),
+				Value:           reference(cpu.Stack[i]),
+				MemoryReference: reference(cpu.Stack[i]),
+			})
+		}
+	default:
+		return nil, fmt.Errorf("unknown variables reference %d", args.VariablesReference)
+	}
+	return map[string]any{"variables": vars}, nil
+}
+
+func (ss *session) setVariable(raw json.RawMessage) (any, error) {
+	var args struct {
+		VariablesReference int    `json:"variablesReference"`
+		Name               string `json:"name"`
+		Value              string `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	if args.VariablesReference != registersRef {
+		return nil, errors.New("only registers can be set")
+	}
+	v, err := strconv.ParseInt(args.Value, 0, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q", args.Value)
+	}
+	if err := ss.d.SetRegister(args.Name, int(v)); err != nil {
+		return nil, err
+	}
+	v2, _ := ss.d.Register(args.Name)
+	return map[string]any{"value": fmt.Sprintf("0x%02X", v2)}, nil
+}
+
+func (ss *session) readMemory(raw json.RawMessage) (any, error) {
+	var args struct {
+		MemoryReference string `json:"memoryReference"`
+		Offset          int    `json:"offset"`
+		Count           int    `json:"count"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	addr, err := parseReference(args.MemoryReference, args.Offset)
+	if err != nil {
+		return nil, err
+	}
+	end := min(int(addr)+max(args.Count, 0), chip8.MemorySize)
+	return map[string]any{
+		"address":         reference(addr),
+		"data":            base64.StdEncoding.EncodeToString(ss.d.Emulator.Memory[addr:end]),
+		"unreadableBytes": args.Count - (end - int(addr)),
+	}, nil
+}
+
+func (ss *session) writeMemory(raw json.RawMessage) (any, error) {
+	var args struct {
+		MemoryReference string `json:"memoryReference"`
+		Offset          int    `json:"offset"`
+		Data            string `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	addr, err := parseReference(args.MemoryReference, args.Offset)
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(args.Data)
+	if err != nil {
+		return nil, err
+	}
+	data = data[:min(len(data), chip8.MemorySize-int(addr))]
+	ss.d.Emulator.Memory.Load(int(addr), data)
+	return map[string]any{"bytesWritten": len(data)}, nil
+}
+
+func (ss *session) disassemble(raw json.RawMessage) (any, error) {
+	var args struct {
+		MemoryReference   string `json:"memoryReference"`
+		Offset            int    `json:"offset"`
+		InstructionOffset int    `json:"instructionOffset"`
+		InstructionCount  int    `json:"instructionCount"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	v, err := strconv.ParseUint(args.MemoryReference, 0, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %s", args.MemoryReference)
+	}
+	// instructions are 2 bytes except F000 nnnn, going back is a guess
+	addr := int(v) + args.Offset + 2*args.InstructionOffset
+
+	type instruction struct {
+		Address          string  `json:"address"`
+		InstructionBytes string  `json:"instructionBytes,omitempty"`
+		Instruction      string  `json:"instruction"`
+		Symbol           string  `json:"symbol,omitempty"`
+		Location         *Source `json:"location,omitempty"`
+		Line             int     `json:"line,omitempty"`
+	}
+	mem := ss.d.Emulator.Memory[:]
+	insts := []instruction{}
+	for i := 0; i < args.InstructionCount; i++ {
+		if addr < 0 || addr >= len(mem) {
+			insts = append(insts, instruction{Address: fmt.Sprintf("0x%04X", addr&0xffff), Instruction: "??"})
+			addr += 2
+			continue
+		}
+		in := disasm.Decode(mem, uint16(addr))
+		text := in.Format(ss.label)
+		if text == "" {
+			text = fmt.Sprintf("DW #%04X", in.Opcode)
+		}
+		inst := instruction{
+			Address:          reference(in.Addr),
+			InstructionBytes: fmt.Sprintf("% X", mem[addr:min(addr+int(in.Size), len(mem))]),
+			Instruction:      text,
+		}
+		if name, ok := ss.label(in.Addr); ok {
+			inst.Symbol = name
+		}
+		if f := ss.frame(0, in.Addr); f.Source != nil {
+			inst.Location, inst.Line = f.Source, f.Line
+		}
+		insts = append(insts, inst)
+		addr += int(in.Size)
+	}
+	return map[string]any{"instructions": insts}, nil
+}
+
+func (ss *session) label(addr uint16) (string, bool) {
+	if ss.d.Symbols == nil {
+		return "", false
+	}
+	return ss.d.Symbols.LabelAt(addr)
+}
+
+// evaluate runs the commands of the debug REPL that do not execute the
+// program in the debug console, e.g. regs, x 300 or screen.
+func (ss *session) evaluate(raw json.RawMessage) (any, error) {
+	var args struct {
+		Expression string `json:"expression"`
+		Context    string `json:"context"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	fields := strings.Fields(args.Expression)
+	if len(fields) == 0 {
+		return nil, errors.New("empty expression")
+	}
+	// a register name shows its value
+	if v, err := ss.d.Register(fields[0]); err == nil && len(fields) == 1 {
+		return map[string]any{"result": fmt.Sprintf("0x%02X", v), "variablesReference": 0}, nil
+	}
+	switch fields[0] {
+	case "s", "step", "n", "next", "f", "finish", "c", "continue", "q", "quit":
+		return nil, errors.New("use the debugger controls to run the program")
+	}
+
+	var out bytes.Buffer
+	if _, err := ss.d.Command(&out, args.Expression); err != nil {
+		return nil, err
+	}
+	return map[string]any{"result": strings.TrimRight(out.String(), "\n"), "variablesReference": 0}, nil
+}
@@ -0,0 +1,186 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/debuggerpls/go-chip8"
+	"github.com/debuggerpls/go-chip8/asm"
+	"github.com/debuggerpls/go-chip8/debug"
+)
+
+const testSource = `start:  LD V0, 1
+        CALL sub
+        EXIT
+sub:    LD V1, 2
+        RET
+`
+
+type client struct {
+	t   *testing.T
+	w   io.Writer
+	r   *bufio.Reader
+	seq int
+}
+
+type message struct {
+	Type       string          `json:"type"`
+	Command    string          `json:"command"`
+	Event      string          `json:"event"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	Body       json.RawMessage `json:"body"`
+}
+
+func (c *client) request(command string, args any) {
+	c.seq++
+	if err := writeMessage(c.w, map[string]any{"seq": c.seq, "type": "request", "command": command, "arguments": args}); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) read() message {
+	var m message
+	done := make(chan error, 1)
+	go func() { done <- readMessage(c.r, &m) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			c.t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timeout")
+	}
+	return m
+}
+
+// call sends a request and returns the body of its response.
+func (c *client) call(command string, args any, body any) {
+	c.t.Helper()
+	c.request(command, args)
+	m := c.read()
+	if m.Type != "response" || m.Command != command || !m.Success {
+		c.t.Fatalf("%s: unexpected reply %+v", command, m)
+	}
+	if body != nil {
+		if err := json.Unmarshal(m.Body, body); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+}
+
+func (c *client) expectEvent(name string) message {
+	c.t.Helper()
+	m := c.read()
+	if m.Type != "event" || m.Event != name {
+		c.t.Fatalf("Expected event %s, actual=%+v", name, m)
+	}
+	return m
+}
+
+func TestSession(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "test.asm")
+	p, err := asm.Assemble(source, []byte(testSource), asm.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	program := filepath.Join(dir, "test.ch8")
+	os.WriteFile(program, p.Code, 0644)
+	f, _ := os.Create(filepath.Join(dir, "test.sym"))
+	p.WriteSymbols(f)
+	f.Close()
+
+	server := &Server{Launch: func(args LaunchArguments) (*debug.Debugger, error) {
+		e, err := chip8.CreateEmulator(&chip8.GraphicsHeadless{}, &debug.Keys{}, &chip8.AudioNull{})
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(args.Program)
+		if err != nil {
+			return nil, err
+		}
+		e.LoadProgram(data)
+		return debug.CreateDebugger(e), nil
+	}}
+	toServer, fromClient := io.Pipe()
+	fromServer, toClient := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Serve(toServer, toClient)
+		toClient.Close()
+	}()
+	c := &client{t: t, w: fromClient, r: bufio.NewReader(fromServer)}
+
+	c.call("initialize", map[string]any{"adapterID": "chip8"}, nil)
+	c.call("launch", LaunchArguments{Program: program}, nil)
+	c.expectEvent("initialized")
+
+	var bps struct{ Breakpoints []Breakpoint }
+	c.call("setBreakpoints", map[string]any{
+		"source":      Source{Path: source},
+		"breakpoints": []SourceBreakpoint{{Line: 5}, {Line: 6}},
+	}, &bps)
+	if len(bps.Breakpoints) != 2 || !bps.Breakpoints[0].Verified || bps.Breakpoints[1].Verified {
+		t.Errorf("Wrong breakpoints: %+v", bps.Breakpoints)
+	}
+
+	c.call("configurationDone", nil, nil)
+	var stopped struct{ Reason string }
+	json.Unmarshal(c.expectEvent("stopped").Body, &stopped)
+	if stopped.Reason != "breakpoint" {
+		t.Errorf("Expected breakpoint, actual=%q", stopped.Reason)
+	}
+
+	var trace struct{ StackFrames []StackFrame }
+	c.call("stackTrace", map[string]any{"threadId": threadID}, &trace)
+	frames := trace.StackFrames
+	if len(frames) != 2 || frames[0].Name != "sub+2" || frames[0].Line != 5 ||
+		frames[1].Name != "start+2" || frames[1].Line != 2 || frames[0].Source.Path != source {
+		t.Errorf("Wrong stack trace: %+v", frames)
+	}
+
+	var vars struct{ Variables []Variable }
+	c.call("variables", map[string]any{"variablesReference": registersRef}, &vars)
+	if vars.Variables[1].Name != "V1" || vars.Variables[1].Value != "0x02" || vars.Variables[17].Value != "0x0208" {
+		t.Errorf("Wrong registers: %+v", vars.Variables)
+	}
+	c.call("setVariable", map[string]any{"variablesReference": registersRef, "name": "V2", "value": "0x33"}, nil)
+	c.call("variables", map[string]any{"variablesReference": stackRef}, &vars)
+	if len(vars.Variables) != 1 || vars.Variables[0].Value != "0x0202" {
+		t.Errorf("Wrong stack: %+v", vars.Variables)
+	}
+
+	var mem struct{ Data string }
+	c.call("readMemory", map[string]any{"memoryReference": "0x200", "offset": 2, "count": 2}, &mem)
+	if mem.Data != "IgY=" {
+		t.Errorf("Wrong memory: %q", mem.Data)
+	}
+
+	var result struct{ Result string }
+	c.call("evaluate", map[string]any{"expression": "V2"}, &result)
+	if result.Result != "0x33" {
+		t.Errorf("Wrong evaluation: %q", result.Result)
+	}
+
+	c.call("stepOut", map[string]any{"threadId": threadID}, nil)
+	json.Unmarshal(c.expectEvent("stopped").Body, &stopped)
+	if stopped.Reason != "step" {
+		t.Errorf("Expected step, actual=%q", stopped.Reason)
+	}
+
+	c.call("continue", map[string]any{"threadId": threadID}, nil)
+	c.expectEvent("exited")
+	c.expectEvent("terminated")
+
+	c.call("disconnect", nil, nil)
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
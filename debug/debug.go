@@ -0,0 +1,376 @@
+// Package debug is a step debugger for the emulator: breakpoints, stepping
+// by call depth, register editing, memory dumps and disassembly around PC.
+package debug
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/debuggerpls/go-chip8"
+	"github.com/debuggerpls/go-chip8/asm"
+	"github.com/debuggerpls/go-chip8/disasm"
+)
+
+// Instructions executed per 60 Hz timer tick, ~600 Hz like Emulator.Run
+const DefaultCyclesPerTick = 10
+
+// Reason why execution stopped
+type Reason int
+
+const (
+	ReasonStep       Reason = iota // the step completed
+	ReasonBreakpoint               // PC reached a breakpoint
+	ReasonInterrupt                // Interrupt was called
+	ReasonExit                     // the program exited with 00FD
+	ReasonWatchpoint               // memory was accessed at a watchpoint
+)
+
+func (r Reason) String() string {
+	switch r {
+	case ReasonStep:
+		return "step"
+	case ReasonBreakpoint:
+		return "breakpoint"
+	case ReasonInterrupt:
+		return "interrupt"
+	case ReasonExit:
+		return "exit"
+	case ReasonWatchpoint:
+		return "watchpoint"
+	}
+	return fmt.Sprintf("Reason(%d)", int(r))
+}
+
+var ErrNotInSubroutine = errors.New("not in a subroutine")
+
+type ErrUnknownRegister string
+
+func (e ErrUnknownRegister) Error() string {
+	return fmt.Sprintf("unknown register %q", string(e))
+}
+
+type Debugger struct {
+	Emulator      *chip8.Emulator
+	Symbols       *asm.SymbolFile // labels for breakpoints and disassembly, optional
+	CyclesPerTick int             // zero value means DefaultCyclesPerTick
+
+	breakpoints map[uint16]bool
+	watchpoints *chip8.Watchpoints
+	hits        []chip8.WatchHit // of the last instruction
+	cycles      uint64
+	interrupted atomic.Bool
+}
+
+// CreateDebugger routes the memory accesses of the emulator through the
+// watchpoints of the debugger.
+func CreateDebugger(e *chip8.Emulator) *Debugger {
+	d := &Debugger{
+		Emulator:    e,
+		breakpoints: map[uint16]bool{},
+	}
+	d.watchpoints = chip8.NewWatchpoints(&e.Memory, func(hit chip8.WatchHit) {
+		d.hits = append(d.hits, hit)
+	})
+	e.Watchpoints = d.watchpoints
+	return d
+}
+
+// Cycles returns the number of instructions executed.
+func (d *Debugger) Cycles() uint64 {
+	return d.cycles
+}
+
+func (d *Debugger) AddBreakpoint(addr uint16) {
+	d.breakpoints[addr] = true
+}
+
+func (d *Debugger) RemoveBreakpoint(addr uint16) {
+	delete(d.breakpoints, addr)
+}
+
+func (d *Debugger) ClearBreakpoints() {
+	clear(d.breakpoints)
+}
+
+func (d *Debugger) IsBreakpoint(addr uint16) bool {
+	return d.breakpoints[addr]
+}
+
+// Breakpoints returns the addresses of all breakpoints in ascending order.
+func (d *Debugger) Breakpoints() []uint16 {
+	addrs := make([]uint16, 0, len(d.breakpoints))
+	for addr := range d.breakpoints {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	return addrs
+}
+
+// Watch stops execution after instructions that access the watched
+// addresses.
+func (d *Debugger) Watch(wp chip8.Watchpoint) {
+	d.watchpoints.Add(wp)
+}
+
+// Unwatch removes the watchpoints that contain addr.
+func (d *Debugger) Unwatch(addr uint16) {
+	d.watchpoints.Remove(addr)
+}
+
+func (d *Debugger) ClearWatchpoints() {
+	d.watchpoints.Clear()
+}
+
+func (d *Debugger) Watchpoints() []chip8.Watchpoint {
+	return d.watchpoints.List()
+}
+
+// Hits returns the watchpoint hits of the last instruction.
+func (d *Debugger) Hits() []chip8.WatchHit {
+	return d.hits
+}
+
+// Interrupt stops Continue, StepOver or StepOut after the current
+// instruction. It may be called from another goroutine.
+func (d *Debugger) Interrupt() {
+	d.interrupted.Store(true)
+}
+
+// Instruction returns the instruction at addr.
+func (d *Debugger) Instruction(addr uint16) disasm.Instruction {
+	return disasm.Decode(d.Emulator.Memory[:], addr)
+}
+
+// Step executes one instruction, the timers tick every CyclesPerTick
+// instructions.
+func (d *Debugger) Step() (Reason, error) {
+	perTick := d.CyclesPerTick
+	if perTick <= 0 {
+		perTick = DefaultCyclesPerTick
+	}
+	d.cycles++
+	d.hits = d.hits[:0]
+	err := d.Emulator.Step(d.cycles%uint64(perTick) == 0)
+	switch {
+	case errors.Is(err, chip8.ErrExit):
+		return ReasonExit, nil
+	case err == nil && len(d.hits) > 0:
+		return ReasonWatchpoint, nil
+	}
+	return ReasonStep, err
+}
+
+// run steps until done returns true, a breakpoint is reached or execution
+// is interrupted. The first instruction is executed even if PC is at a
+// breakpoint.
+func (d *Debugger) run(done func() bool) (Reason, error) {
+	d.interrupted.Store(false)
+	for {
+		reason, err := d.Step()
+		if err != nil || reason != ReasonStep {
+			return reason, err
+		}
+		switch {
+		case done():
+			return ReasonStep, nil
+		case d.breakpoints[d.Emulator.CPU.PC]:
+			return ReasonBreakpoint, nil
+		case d.interrupted.Load():
+			return ReasonInterrupt, nil
+		}
+	}
+}
+
+// Continue runs until a breakpoint is reached.
+func (d *Debugger) Continue() (Reason, error) {
+	return d.run(func() bool { return false })
+}
+
+// StepOver executes one instruction, a 2nnn call runs until the subroutine
+// returns.
+func (d *Debugger) StepOver() (Reason, error) {
+	cpu := &d.Emulator.CPU
+	if d.Instruction(cpu.PC).Flow() != disasm.FlowCall {
+		return d.Step()
+	}
+	depth := cpu.SP
+	return d.run(func() bool { return cpu.SP <= depth })
+}
+
+// StepOut runs until the current subroutine returns with 00EE.
+func (d *Debugger) StepOut() (Reason, error) {
+	cpu := &d.Emulator.CPU
+	if cpu.SP == 0 {
+		return ReasonStep, ErrNotInSubroutine
+	}
+	depth := cpu.SP
+	return d.run(func() bool { return cpu.SP < depth })
+}
+
+// Names of the registers for Register and SetRegister
+var Registers = []string{
+	"V0", "V1", "V2", "V3", "V4", "V5", "V6", "V7",
+	"V8", "V9", "VA", "VB", "VC", "VD", "VE", "VF",
+	"I", "PC", "SP", "DT", "ST",
+}
+
+// register returns a pointer to the register and its maximum value.
+func (d *Debugger) register(name string) (byteReg *byte, wordReg *uint16, err error) {
+	cpu := &d.Emulator.CPU
+	switch name = strings.ToUpper(name); name {
+	case "I":
+		return nil, &cpu.I, nil
+	case "PC":
+		return nil, &cpu.PC, nil
+	case "SP":
+		return &cpu.SP, nil, nil
+	case "DT":
+		return &cpu.DT, nil, nil
+	case "ST":
+		return &cpu.ST, nil, nil
+	}
+	if len(name) == 2 && name[0] == 'V' {
+		if x, err := strconv.ParseUint(name[1:], 16, 4); err == nil {
+			return &cpu.V[x], nil, nil
+		}
+	}
+	return nil, nil, ErrUnknownRegister(name)
+}
+
+func (d *Debugger) Register(name string) (int, error) {
+	b, w, err := d.register(name)
+	switch {
+	case err != nil:
+		return 0, err
+	case b != nil:
+		return int(*b), nil
+	}
+	return int(*w), nil
+}
+
+// SetRegister sets a register, V0-VF, I, PC, SP, DT or ST.
+func (d *Debugger) SetRegister(name string, value int) error {
+	b, w, err := d.register(name)
+	if err != nil {
+		return err
+	}
+	limit := 0xffff
+	switch {
+	case b != nil && strings.EqualFold(name, "SP"):
+		limit = len(d.Emulator.CPU.Stack)
+	case b != nil:
+		limit = 0xff
+	}
+	if value < 0 || value > limit {
+		return fmt.Errorf("%s: value %#x out of range", strings.ToUpper(name), value)
+	}
+	if b != nil {
+		*b = byte(value)
+	} else {
+		*w = uint16(value)
+	}
+	return nil
+}
+
+// Addr parses an address, a number or a label of the symbol file.
+func (d *Debugger) Addr(s string) (uint16, error) {
+	if d.Symbols != nil {
+		if addr, ok := d.Symbols.Labels[s]; ok {
+			return addr, nil
+		}
+	}
+	s = strings.TrimPrefix(s, "#")
+	addr, err := strconv.ParseUint(s, 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address %q", s)
+	}
+	return uint16(addr), nil
+}
+
+func (d *Debugger) label(addr uint16) (string, bool) {
+	if d.Symbols == nil {
+		return "", false
+	}
+	return d.Symbols.LabelAt(addr)
+}
+
+// WriteRegisters writes the registers, the timers and the stack.
+func (d *Debugger) WriteRegisters(w io.Writer) error {
+	cpu := &d.Emulator.CPU
+	var b strings.Builder
+	for i, v := range cpu.V {
+		fmt.Fprintf(&b, "V%X=%02X", i, v)
+		if (i+1)%8 == 0 {
+			b.WriteString("\n")
+		} else {
+			b.WriteString(" ")
+		}
+	}
+	fmt.Fprintf(&b, "I=%04X PC=%04X SP=%X DT=%02X ST=%02X\n", cpu.I, cpu.PC, cpu.SP, cpu.DT, cpu.ST)
+	if cpu.SP > 0 {
+		b.WriteString("Stack:")
+		for i := int(cpu.SP) - 1; i >= 0; i-- {
+			fmt.Fprintf(&b, " %04X", cpu.Stack[i])
+		}
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteMemory writes a hex dump of n bytes from addr.
+func (d *Debugger) WriteMemory(w io.Writer, addr uint16, n int) error {
+	mem := d.Emulator.Memory[:]
+	end := min(int(addr)+n, len(mem))
+	var b strings.Builder
+	for line := int(addr); line < end; line += 16 {
+		row := mem[line:min(line+16, end)]
+		ascii := make([]byte, len(row))
+		for i, c := range row {
+			if c >= 0x20 && c < 0x7f {
+				ascii[i] = c
+			} else {
+				ascii[i] = '.'
+			}
+		}
+		fmt.Fprintf(&b, "%04X  %-47s  |%s|\n", line, fmt.Sprintf("% X", row), ascii)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteDisassembly writes count instructions starting before instructions
+// before addr. PC is marked with => and breakpoints with *.
+func (d *Debugger) WriteDisassembly(w io.Writer, addr uint16, before, count int) error {
+	// instructions are 2 bytes except F000 nnnn, going back is a guess
+	start := max(int(addr)-2*before, 0)
+	mem := d.Emulator.Memory[:]
+	var b strings.Builder
+	for i, a := 0, start; i < count && a < len(mem); i++ {
+		in := disasm.Decode(mem, uint16(a))
+		if name, ok := d.label(in.Addr); ok {
+			fmt.Fprintf(&b, "%s:\n", name)
+		}
+		marker := "  "
+		if in.Addr == d.Emulator.CPU.PC {
+			marker = "=>"
+		}
+		bp := " "
+		if d.breakpoints[in.Addr] {
+			bp = "*"
+		}
+		text := in.Format(d.label)
+		if text == "" {
+			text = "???"
+		}
+		fmt.Fprintf(&b, "%s%s%04X  %04X  %s\n", bp, marker, in.Addr, in.Opcode, text)
+		a += int(in.Size)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,151 @@
+package debug
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/debuggerpls/go-chip8"
+)
+
+type nullInput struct{}
+
+func (nullInput) Init() error   { return nil }
+func (nullInput) Close()        {}
+func (nullInput) WaitForEvent() {}
+func (nullInput) Keys() uint16  { return 0 }
+
+var testROM = []byte{
+	0x60, 0x01, // 0200 LD V0, #01
+	0x22, 0x0a, // 0202 CALL #20A
+	0x61, 0x02, // 0204 LD V1, #02
+	0x00, 0xfd, // 0206 EXIT
+	0x00, 0x00, // 0208
+	0x62, 0x03, // 020A LD V2, #03
+	0x22, 0x10, // 020C CALL #210
+	0x00, 0xee, // 020E RET
+	0x63, 0x04, // 0210 LD V3, #04
+	0x00, 0xee, // 0212 RET
+}
+
+func createDebugger(t *testing.T) *Debugger {
+	e, err := chip8.CreateEmulator(&chip8.GraphicsHeadless{}, nullInput{}, &chip8.AudioNull{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.LoadProgram(testROM); err != nil {
+		t.Fatal(err)
+	}
+	return CreateDebugger(e)
+}
+
+func TestStepping(t *testing.T) {
+	d := createDebugger(t)
+	cpu := &d.Emulator.CPU
+
+	steps := []struct {
+		name   string
+		step   func() (Reason, error)
+		pc     uint16
+		reason Reason
+	}{
+		{"step", d.Step, 0x202, ReasonStep},
+		{"step over", d.StepOver, 0x204, ReasonStep},
+		{"continue", d.Continue, 0x206, ReasonExit},
+	}
+	for _, s := range steps {
+		reason, err := s.step()
+		if err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+		if cpu.PC != s.pc || reason != s.reason {
+			t.Errorf("%s: expected PC=%04x %v, actual PC=%04x %v", s.name, s.pc, s.reason, cpu.PC, reason)
+		}
+	}
+	if cpu.V[3] != 4 || cpu.V[1] != 2 {
+		t.Errorf("Subroutines were not executed:\n%s", cpu.String())
+	}
+}
+
+func TestBreakpoints(t *testing.T) {
+	d := createDebugger(t)
+	cpu := &d.Emulator.CPU
+
+	d.AddBreakpoint(0x210)
+	d.AddBreakpoint(0x204)
+	if reason, err := d.Continue(); err != nil || reason != ReasonBreakpoint || cpu.PC != 0x210 {
+		t.Fatalf("Expected breakpoint at 0210, actual PC=%04x %v %v", cpu.PC, reason, err)
+	}
+	if cpu.SP != 2 {
+		t.Errorf("Expected call depth 2, actual=%d", cpu.SP)
+	}
+
+	// step out returns into 020C's caller, the breakpoint at 0204 is hit
+	// when 020E returns
+	if reason, err := d.StepOut(); err != nil || reason != ReasonStep || cpu.PC != 0x20e {
+		t.Fatalf("Expected step out to 020E, actual PC=%04x %v %v", cpu.PC, reason, err)
+	}
+	if reason, err := d.StepOut(); err != nil || reason != ReasonStep || cpu.PC != 0x204 {
+		t.Fatalf("Expected step out to 0204, actual PC=%04x %v %v", cpu.PC, reason, err)
+	}
+	if _, err := d.StepOut(); err != ErrNotInSubroutine {
+		t.Errorf("Expected ErrNotInSubroutine, actual=%v", err)
+	}
+
+	d.RemoveBreakpoint(0x210)
+	if bps := d.Breakpoints(); len(bps) != 1 || bps[0] != 0x204 {
+		t.Errorf("Wrong breakpoints: %x", bps)
+	}
+}
+
+func TestRegisters(t *testing.T) {
+	d := createDebugger(t)
+
+	if err := d.SetRegister("va", 0x12); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetRegister("DT", 60); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := d.Register("VA"); v != 0x12 || d.Emulator.CPU.DT != 60 {
+		t.Errorf("Registers not set:\n%s", d.Emulator.CPU.String())
+	}
+	if err := d.SetRegister("V0", 0x100); err == nil {
+		t.Errorf("Expected an error for a value out of range")
+	}
+	if err := d.SetRegister("VG", 0); err == nil {
+		t.Errorf("Expected an error for an unknown register")
+	}
+
+	var b strings.Builder
+	d.WriteDisassembly(&b, 0x204, 2, 4)
+	expected := " =>0200  6001  LD V0, #01\n   0202  220A  CALL #20A\n   0204  6102  LD V1, #02\n   0206  00FD  EXIT\n"
+	if b.String() != expected {
+		t.Errorf("Wrong disassembly, expected:\n%s\nactual:\n%s", expected, b.String())
+	}
+
+	b.Reset()
+	d.WriteMemory(&b, 0x200, 4)
+	if b.String() != "0200  60 01 22 0A"+strings.Repeat(" ", 36)+"  |`.\".|\n" {
+		t.Errorf("Wrong memory dump: %q", b.String())
+	}
+}
+
+func TestWatchpoints(t *testing.T) {
+	d := createDebugger(t)
+	cpu := &d.Emulator.CPU
+
+	d.Watch(chip8.Watchpoint{From: 0x20c, To: 0x20d, Access: chip8.AccessExecute})
+	reason, err := d.Continue()
+	if err != nil || reason != ReasonWatchpoint || cpu.PC != 0x210 {
+		t.Fatalf("Expected watchpoint after 020C, actual PC=%04x %v %v", cpu.PC, reason, err)
+	}
+	hits := d.Hits()
+	if len(hits) != 2 || hits[0].PC != 0x20c || hits[0].Opcode != 0x2210 {
+		t.Errorf("Wrong hits: %v", hits)
+	}
+
+	d.Unwatch(0x20c)
+	if reason, _ := d.Continue(); reason != ReasonExit {
+		t.Errorf("Expected exit, actual=%v", reason)
+	}
+}
@@ -0,0 +1,268 @@
+package debug
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/debuggerpls/go-chip8"
+)
+
+// Keys is an Input whose keys are set by the REPL.
+type Keys struct {
+	State uint16
+}
+
+func (k *Keys) Init() error   { return nil }
+func (k *Keys) Close()        {}
+func (k *Keys) WaitForEvent() {}
+func (k *Keys) Keys() uint16  { return k.State }
+
+const replHelp = `Commands:
+  s, step [N]          execute N instructions
+  n, next              step over calls
+  f, finish            run until the subroutine returns
+  c, continue          run until a breakpoint, Ctrl-C interrupts
+  b, break ADDR        set a breakpoint, ADDR is hex or a label
+  d, delete [ADDR]     delete a breakpoint, all without ADDR
+  bl, breakpoints      list breakpoints
+  w, watch [rwx] ADDR [END]
+                       stop after reads, writes or execution of ADDR to END
+  uw, unwatch [ADDR]   delete watchpoints at ADDR, all without ADDR
+  wl, watchpoints      list watchpoints
+  r, regs              show registers
+  set REG VALUE        set V0-VF, I, PC, SP, DT or ST (hex value)
+  x ADDR [N]           dump N bytes of memory
+  l, list [ADDR]       disassemble around ADDR, PC by default
+  key [KEYS]           hold down hex keys (e.g. "key 5a"), none without KEYS
+  screen               show the display
+  q, quit              quit
+`
+
+// REPL reads commands from r until quit or the end of input.
+func (d *Debugger) REPL(r io.Reader, w io.Writer) error {
+	in := bufio.NewScanner(r)
+	last := ""
+	d.WriteDisassembly(w, d.Emulator.CPU.PC, 0, 1)
+	for {
+		fmt.Fprint(w, "(chip8) ")
+		if !in.Scan() {
+			fmt.Fprintln(w)
+			return in.Err()
+		}
+		line := strings.TrimSpace(in.Text())
+		if line == "" {
+			// repeat the last command, like gdb
+			line = last
+		}
+		last = line
+		if line == "" {
+			continue
+		}
+
+		quit, err := d.Command(w, line)
+		if err != nil {
+			fmt.Fprintln(w, "ERROR:", err)
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+// Command executes one REPL command and reports whether it was quit.
+func (d *Debugger) Command(w io.Writer, line string) (quit bool, err error) {
+	args := strings.Fields(line)
+	cmd, args := args[0], args[1:]
+	cpu := &d.Emulator.CPU
+
+	stopped := func(reason Reason, err error) error {
+		if err != nil {
+			return err
+		}
+		switch reason {
+		case ReasonBreakpoint, ReasonInterrupt:
+			fmt.Fprintf(w, "Stopped at %s\n", reason)
+		case ReasonWatchpoint:
+			for _, hit := range d.hits {
+				fmt.Fprintf(w, "Watchpoint %s: %s\n", hit.Watchpoint, hit)
+			}
+		case ReasonExit:
+			fmt.Fprintln(w, "Program exited")
+			return nil
+		}
+		return d.WriteDisassembly(w, cpu.PC, 0, 1)
+	}
+
+	switch cmd {
+	case "s", "step":
+		n := 1
+		if len(args) > 0 {
+			if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+				return false, fmt.Errorf("invalid count %q", args[0])
+			}
+		}
+		reason, err := ReasonStep, error(nil)
+		for i := 0; i < n && err == nil && reason == ReasonStep; i++ {
+			reason, err = d.Step()
+			if reason == ReasonStep && i < n-1 && d.breakpoints[cpu.PC] {
+				reason = ReasonBreakpoint
+			}
+		}
+		return false, stopped(reason, err)
+	case "n", "next":
+		return false, stopped(d.StepOver())
+	case "f", "finish":
+		return false, stopped(d.StepOut())
+	case "c", "continue":
+		return false, stopped(d.Continue())
+	case "b", "break":
+		if len(args) != 1 {
+			return false, fmt.Errorf("usage: break ADDR")
+		}
+		addr, err := d.Addr(args[0])
+		if err != nil {
+			return false, err
+		}
+		d.AddBreakpoint(addr)
+		fmt.Fprintf(w, "Breakpoint at %04X\n", addr)
+	case "d", "delete":
+		if len(args) == 0 {
+			d.ClearBreakpoints()
+			return false, nil
+		}
+		addr, err := d.Addr(args[0])
+		if err != nil {
+			return false, err
+		}
+		d.RemoveBreakpoint(addr)
+	case "bl", "breakpoints":
+		for _, addr := range d.Breakpoints() {
+			name, _ := d.label(addr)
+			fmt.Fprintf(w, "%04X %s\n", addr, name)
+		}
+	case "w", "watch":
+		return false, d.watchCommand(w, args)
+	case "uw", "unwatch":
+		if len(args) == 0 {
+			d.ClearWatchpoints()
+			return false, nil
+		}
+		addr, err := d.Addr(args[0])
+		if err != nil {
+			return false, err
+		}
+		d.Unwatch(addr)
+	case "wl", "watchpoints":
+		for _, wp := range d.Watchpoints() {
+			fmt.Fprintln(w, wp)
+		}
+	case "r", "regs":
+		return false, d.WriteRegisters(w)
+	case "set":
+		if len(args) != 2 {
+			return false, fmt.Errorf("usage: set REG VALUE")
+		}
+		v, err := strconv.ParseUint(strings.TrimPrefix(args[1], "#"), 16, 16)
+		if err != nil {
+			return false, fmt.Errorf("invalid value %q", args[1])
+		}
+		return false, d.SetRegister(args[0], int(v))
+	case "x":
+		if len(args) < 1 {
+			return false, fmt.Errorf("usage: x ADDR [N]")
+		}
+		addr, err := d.Addr(args[0])
+		if err != nil {
+			return false, err
+		}
+		n := 64
+		if len(args) > 1 {
+			if n, err = strconv.Atoi(args[1]); err != nil {
+				return false, fmt.Errorf("invalid count %q", args[1])
+			}
+		}
+		return false, d.WriteMemory(w, addr, n)
+	case "l", "list":
+		addr := cpu.PC
+		if len(args) > 0 {
+			if addr, err = d.Addr(args[0]); err != nil {
+				return false, err
+			}
+		}
+		return false, d.WriteDisassembly(w, addr, 5, 11)
+	case "key":
+		keys, ok := d.Emulator.Input.(*Keys)
+		if !ok {
+			return false, fmt.Errorf("keys are read from the terminal")
+		}
+		keys.State = 0
+		for _, c := range strings.Join(args, "") {
+			key, err := strconv.ParseUint(string(c), 16, 4)
+			if err != nil {
+				return false, fmt.Errorf("invalid key %q", c)
+			}
+			keys.State |= 1 << key
+		}
+	case "screen":
+		return false, writeScreen(w, &d.Emulator.Display.Framebuffer)
+	case "q", "quit":
+		return true, nil
+	case "h", "help":
+		fmt.Fprint(w, replHelp)
+	default:
+		return false, fmt.Errorf("unknown command %q, try help", cmd)
+	}
+	return false, nil
+}
+
+func (d *Debugger) watchCommand(w io.Writer, args []string) error {
+	wp := chip8.Watchpoint{Access: chip8.AccessWrite}
+	if len(args) > 0 && strings.Trim(args[0], "rwx") == "" {
+		wp.Access = 0
+		for _, c := range args[0] {
+			wp.Access |= map[rune]chip8.Access{'r': chip8.AccessRead, 'w': chip8.AccessWrite, 'x': chip8.AccessExecute}[c]
+		}
+		args = args[1:]
+	}
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("usage: watch [rwx] ADDR [END]")
+	}
+
+	var err error
+	if wp.From, err = d.Addr(args[0]); err != nil {
+		return err
+	}
+	wp.To = wp.From
+	if len(args) > 1 {
+		if wp.To, err = d.Addr(args[1]); err != nil {
+			return err
+		}
+	}
+	d.Watch(wp)
+	fmt.Fprintf(w, "Watchpoint %s\n", wp)
+	return nil
+}
+
+// writeScreen writes the framebuffer with 2 pixels per character.
+func writeScreen(w io.Writer, f *chip8.Framebuffer) error {
+	blocks := []string{" ", "▀", "▄", "█"}
+	var b strings.Builder
+	for y := 0; y < f.Height; y += 2 {
+		for x := 0; x < f.Width; x++ {
+			i := 0
+			if f.Pixel(x, y) != 0 {
+				i |= 1
+			}
+			if y+1 < f.Height && f.Pixel(x, y+1) != 0 {
+				i |= 2
+			}
+			b.WriteString(blocks[i])
+		}
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
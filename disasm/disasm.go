@@ -0,0 +1,326 @@
+// Package disasm disassembles CHIP-8, SUPER-CHIP and XO-CHIP programs. Code
+// is told apart from data by following the control flow from the entry
+// points, everything that is never reached is written as data.
+package disasm
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Address programs are loaded at
+const Origin = 0x200
+
+// Kind of label, also its prefix
+type LabelKind byte
+
+const (
+	LabelJump LabelKind = 'L' // target of a jump
+	LabelCall LabelKind = 'S' // subroutine
+	LabelData LabelKind = 'D' // loaded into I, usually sprites
+)
+
+type Program struct {
+	Origin uint16
+	ROM    []byte
+
+	mem    []byte // ROM at its address, to decode addresses outside of it too
+	code   []bool // byte belongs to an instruction
+	starts map[uint16]Instruction
+	labels map[uint16]LabelKind
+}
+
+// Disassemble the program loaded at origin. Tracing starts at origin and at
+// every additional entry point.
+func Disassemble(rom []byte, origin uint16, entries ...uint16) *Program {
+	p := &Program{
+		Origin: origin,
+		ROM:    rom,
+		mem:    make([]byte, int(origin)+len(rom)),
+		code:   make([]bool, len(rom)),
+		starts: map[uint16]Instruction{},
+		labels: map[uint16]LabelKind{},
+	}
+	copy(p.mem[origin:], rom)
+
+	p.trace(append([]uint16{origin}, entries...))
+	return p
+}
+
+func (p *Program) inROM(addr uint16) bool {
+	return addr >= p.Origin && int(addr) < int(p.Origin)+len(p.ROM)
+}
+
+func (p *Program) addLabel(addr uint16, kind LabelKind) {
+	// subroutines win over jumps, code wins over data
+	if old, ok := p.labels[addr]; ok && (old == LabelCall || kind == LabelData) {
+		return
+	}
+	p.labels[addr] = kind
+}
+
+// trace follows the control flow from the entry points and marks the
+// reached instructions as code.
+func (p *Program) trace(entries []uint16) {
+	queue := append([]uint16{}, entries...)
+	for _, addr := range entries {
+		p.addLabel(addr, LabelJump)
+	}
+
+	for len(queue) > 0 {
+		addr := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+
+		for p.inROM(addr) {
+			if _, done := p.starts[addr]; done {
+				break
+			}
+			in := Decode(p.mem, addr)
+			flow := in.Flow()
+			if flow == FlowInvalid || !p.inROM(addr+in.Size-1) {
+				break
+			}
+			p.starts[addr] = in
+			for i := uint16(0); i < in.Size; i++ {
+				p.code[addr+i-p.Origin] = true
+			}
+
+			target, hasTarget := in.Target()
+			switch flow {
+			case FlowJump:
+				p.addLabel(target, LabelJump)
+				queue = append(queue, target)
+			case FlowCall:
+				p.addLabel(target, LabelCall)
+				queue = append(queue, target)
+			case FlowJumpV0:
+				p.addLabel(target, LabelJump)
+				queue = append(queue, p.jumpTable(target)...)
+			case FlowSkip:
+				after := Decode(p.mem, in.Next())
+				queue = append(queue, after.Next())
+			default:
+				if hasTarget {
+					p.addLabel(target, LabelData)
+				}
+			}
+
+			if flow == FlowJump || flow == FlowJumpV0 || flow == FlowReturn || flow == FlowExit {
+				break
+			}
+			addr = in.Next()
+		}
+	}
+}
+
+// jumpTable returns the entries of a Bnnn jump table. The table starts at
+// nnn and is usually a list of 1nnn jumps, every one of them is an entry.
+func (p *Program) jumpTable(addr uint16) []uint16 {
+	entries := []uint16{addr}
+	for a := addr; p.inROM(a + 1); a += 2 {
+		in := Decode(p.mem, a)
+		if in.Flow() != FlowJump {
+			break
+		}
+		entries = append(entries, a)
+	}
+	return entries
+}
+
+// IsCode reports whether the byte at addr belongs to an instruction.
+func (p *Program) IsCode(addr uint16) bool {
+	return p.inROM(addr) && p.code[addr-p.Origin]
+}
+
+// Instructions returns the reached instructions ordered by address.
+func (p *Program) Instructions() []Instruction {
+	ins := make([]Instruction, 0, len(p.starts))
+	for _, in := range p.starts {
+		ins = append(ins, in)
+	}
+	sort.Slice(ins, func(i, j int) bool { return ins[i].Addr < ins[j].Addr })
+	return ins
+}
+
+// Label returns the generated name of a label at addr.
+func (p *Program) Label(addr uint16) (name string, ok bool) {
+	kind, ok := p.labels[addr]
+	if !ok || !p.inROM(addr) {
+		return "", false
+	}
+	return fmt.Sprintf("%c%04X", kind, addr), true
+}
+
+// Labels returns all label addresses in the program ordered by address.
+func (p *Program) Labels() []uint16 {
+	addrs := make([]uint16, 0, len(p.labels))
+	for addr := range p.labels {
+		if p.inROM(addr) {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	return addrs
+}
+
+// A line of output, either an instruction or a run of data bytes
+type line struct {
+	addr uint16
+	in   *Instruction
+	data []byte
+}
+
+// layout splits the program into lines. Instructions that overlap a
+// previous one (jumps into the middle of an instruction) are left out and
+// their labels are written as numbers.
+func (p *Program) layout(maxData int) (lines []line, emitted map[uint16]bool) {
+	emitted = map[uint16]bool{}
+	end := int(p.Origin) + len(p.ROM)
+	for a := int(p.Origin); a < end; {
+		addr := uint16(a)
+		emitted[addr] = true
+		if in, ok := p.starts[addr]; ok {
+			lines = append(lines, line{addr: addr, in: &in})
+			a += int(in.Size)
+			continue
+		}
+
+		// data up to the next label, instruction or maxData bytes
+		n := 0
+		for a+n < end && n < maxData {
+			b := uint16(a + n)
+			if n > 0 {
+				if _, ok := p.labels[b]; ok {
+					break
+				}
+			}
+			if _, ok := p.starts[b]; ok || (n > 0 && p.code[b-p.Origin]) {
+				break
+			}
+			n++
+		}
+		if n == 0 {
+			// inside an overlapping instruction
+			n = 1
+		}
+		lines = append(lines, line{addr: addr, data: p.ROM[a-int(p.Origin) : a+n-int(p.Origin)]})
+		a += n
+	}
+	return lines, emitted
+}
+
+func (p *Program) labelFunc(emitted map[uint16]bool) LabelFunc {
+	return func(addr uint16) (string, bool) {
+		if !emitted[addr] {
+			return "", false
+		}
+		return p.Label(addr)
+	}
+}
+
+// isSprite reports whether the data at addr follows a label loaded into I.
+func (p *Program) isSprite(addr uint16) bool {
+	for a := int(addr); a >= int(p.Origin); a-- {
+		if kind, ok := p.labels[uint16(a)]; ok {
+			return kind == LabelData
+		}
+		if p.code[a-int(p.Origin)] {
+			return false
+		}
+	}
+	return false
+}
+
+func bitmap(b byte) string {
+	var s strings.Builder
+	for i := 7; i >= 0; i-- {
+		if (b>>i)&1 == 1 {
+			s.WriteByte('#')
+		} else {
+			s.WriteByte('.')
+		}
+	}
+	return s.String()
+}
+
+// WriteListing writes the program as a listing of addresses, bytes and
+// mnemonics in Cowgod's notation. Sprite data is shown as a bitmap.
+func (p *Program) WriteListing(w io.Writer) error {
+	lines, emitted := p.layout(8)
+	label := p.labelFunc(emitted)
+
+	var b strings.Builder
+	for _, l := range lines {
+		if name, ok := label(l.addr); ok {
+			fmt.Fprintf(&b, "%s:\n", name)
+		}
+		switch {
+		case l.in != nil:
+			raw := fmt.Sprintf("%04X", l.in.Opcode)
+			if l.in.Size == 4 {
+				raw += fmt.Sprintf(" %04X", l.in.Long)
+			}
+			fmt.Fprintf(&b, "%04X  %-9s  %s\n", l.addr, raw, l.in.Format(label))
+		case p.isSprite(l.addr):
+			for i, d := range l.data {
+				fmt.Fprintf(&b, "%04X  %02X         DB #%02X  ; %s\n", int(l.addr)+i, d, d, bitmap(d))
+			}
+		default:
+			hex := make([]string, len(l.data))
+			for i, d := range l.data {
+				hex[i] = fmt.Sprintf("#%02X", d)
+			}
+			fmt.Fprintf(&b, "%04X  %-9s  DB %s\n", l.addr, "", strings.Join(hex, ", "))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteOcto writes the program as Octo source.
+func (p *Program) WriteOcto(w io.Writer) error {
+	lines, emitted := p.layout(8)
+	label := p.labelFunc(emitted)
+
+	var b strings.Builder
+	if p.Origin != Origin {
+		fmt.Fprintf(&b, ":org 0x%X\n", p.Origin)
+	}
+	for _, l := range lines {
+		if name, ok := label(l.addr); ok {
+			if l.addr == p.Origin {
+				// Octo starts executing at main
+				fmt.Fprintf(&b, ": main\n")
+			}
+			fmt.Fprintf(&b, ": %s\n", name)
+		}
+		var text string
+		if l.in != nil {
+			text = l.in.Octo(label)
+			if text == "" {
+				// no Octo equivalent, 0nnn SYS
+				text = fmt.Sprintf("0x%02X 0x%02X", l.in.Opcode>>8, l.in.Opcode&0xff)
+			}
+			fmt.Fprintf(&b, "\t%-24s # %04X\n", text, l.addr)
+			continue
+		}
+
+		if p.isSprite(l.addr) {
+			for _, d := range l.data {
+				fmt.Fprintf(&b, "\t0x%02X  # %s\n", d, bitmap(d))
+			}
+			continue
+		}
+		hex := make([]string, len(l.data))
+		for i, d := range l.data {
+			hex[i] = fmt.Sprintf("0x%02X", d)
+		}
+		fmt.Fprintf(&b, "\t%s\n", strings.Join(hex, " "))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,124 @@
+package disasm
+
+import (
+	"strings"
+	"testing"
+)
+
+var testROM = []byte{
+	0x00, 0xe0, // 0200 CLS
+	0xa2, 0x0e, // 0202 LD I, D020E
+	0x22, 0x08, // 0204 CALL S0208
+	0x12, 0x06, // 0206 JP L0206
+	0x30, 0x00, // 0208 SE V0, #00
+	0xd0, 0x15, // 020A DRW V0, V1, 5
+	0x00, 0xee, // 020C RET
+	0xf0, 0x90, 0x90, 0x90, 0xf0, // 020E sprite
+}
+
+func TestDecode(t *testing.T) {
+	testData := []struct {
+		mem      []byte
+		mnemonic string
+		octo     string
+		pattern  string
+	}{
+		{[]byte{0x00, 0xe0}, "CLS", "clear", "00E0"},
+		{[]byte{0x00, 0xc3}, "SCD 3", "scroll-down 3", "00Cn"},
+		{[]byte{0x12, 0x34}, "JP #234", "jump 0x234", "1nnn"},
+		{[]byte{0x3a, 0x05}, "SE VA, #05", "if va != 0x05 then", "3xkk"},
+		{[]byte{0x51, 0x32}, "LD [I], V1-V3", "save v1 - v3", "5xy2"},
+		{[]byte{0x81, 0x27}, "SUBN V1, V2", "v1 =- v2", "8xy7"},
+		{[]byte{0x81, 0x2e}, "SHL V1, V2", "v1 <<= v2", "8xyE"},
+		{[]byte{0xb2, 0x00}, "JP V0, #200", "jump0 0x200", "Bnnn"},
+		{[]byte{0xd1, 0x20}, "DRW V1, V2, 0", "sprite v1 v2 0", "Dxyn"},
+		{[]byte{0xe3, 0xa1}, "SKNP V3", "if v3 key then", "ExA1"},
+		{[]byte{0xf0, 0x00, 0x12, 0x34}, "LD I, LONG #1234", "i := long 0x1234", "F000"},
+		{[]byte{0xf5, 0x0a}, "LD V5, K", "v5 := key", "Fx0A"},
+		{[]byte{0xf5, 0x65}, "LD V5, [I]", "load v5", "Fx65"},
+		{[]byte{0x80, 0x08}, "", "", "8008"},
+	}
+
+	for _, data := range testData {
+		in := Decode(data.mem, 0)
+		if m := in.Mnemonic(); m != data.mnemonic {
+			t.Errorf("% x: Wrong mnemonic, expected=%q actual=%q", data.mem, data.mnemonic, m)
+		}
+		if o := in.Octo(nil); o != data.octo {
+			t.Errorf("% x: Wrong Octo, expected=%q actual=%q", data.mem, data.octo, o)
+		}
+		if p := in.Pattern(); p != data.pattern {
+			t.Errorf("% x: Wrong pattern, expected=%q actual=%q", data.mem, data.pattern, p)
+		}
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	p := Disassemble(testROM, Origin)
+
+	for addr := uint16(0x200); addr < 0x20e; addr++ {
+		if !p.IsCode(addr) {
+			t.Errorf("%04x should be code", addr)
+		}
+	}
+	for addr := uint16(0x20e); addr < 0x213; addr++ {
+		if p.IsCode(addr) {
+			t.Errorf("%04x should be data", addr)
+		}
+	}
+
+	var b strings.Builder
+	if err := p.WriteListing(&b); err != nil {
+		t.Fatal(err)
+	}
+	listing := b.String()
+	for _, expected := range []string{
+		"L0200:\n0200  00E0       CLS\n",
+		"0202  A20E       LD I, D020E\n",
+		"0204  2208       CALL S0208\n",
+		"L0206:\n0206  1206       JP L0206\n",
+		"S0208:\n0208  3000       SE V0, #00\n",
+		"D020E:\n020E  F0         DB #F0  ; ####....\n",
+	} {
+		if !strings.Contains(listing, expected) {
+			t.Errorf("Listing does not contain %q:\n%s", expected, listing)
+		}
+	}
+
+	b.Reset()
+	if err := p.WriteOcto(&b); err != nil {
+		t.Fatal(err)
+	}
+	octo := b.String()
+	for _, expected := range []string{
+		": main\n: L0200\n\tclear",
+		"\ti := D020E ",
+		"\t:call S0208 ",
+		": L0206\n\tjump L0206 ",
+		": D020E\n\t0xF0  # ####....\n",
+	} {
+		if !strings.Contains(octo, expected) {
+			t.Errorf("Octo source does not contain %q:\n%s", expected, octo)
+		}
+	}
+}
+
+func TestJumpTable(t *testing.T) {
+	rom := []byte{
+		0xb2, 0x02, // 0200 JP V0, L0202
+		0x12, 0x06, // 0202 JP L0206
+		0x12, 0x08, // 0204 JP L0208
+		0x00, 0xfd, // 0206 EXIT
+		0x00, 0xfd, // 0208 EXIT
+		0xff, 0xff, // 020A data
+	}
+	p := Disassemble(rom, Origin)
+	for _, addr := range []uint16{0x200, 0x202, 0x204, 0x206, 0x208} {
+		if !p.IsCode(addr) {
+			t.Errorf("%04x should be code", addr)
+		}
+	}
+	if p.IsCode(0x20a) {
+		t.Errorf("%04x should be data", 0x20a)
+	}
+}
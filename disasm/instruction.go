@@ -0,0 +1,403 @@
+package disasm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/debuggerpls/go-chip8"
+)
+
+// Instruction is a decoded CHIP-8, SUPER-CHIP or XO-CHIP instruction.
+type Instruction struct {
+	Addr   uint16
+	Opcode uint16
+	Long   uint16 // address following F000
+	Size   uint16 // 2, or 4 for F000 nnnn
+}
+
+// Kind of control flow of an instruction
+type Flow int
+
+const (
+	FlowNext    Flow = iota // continues with the next instruction
+	FlowJump                // 1nnn, continues at Target
+	FlowCall                // 2nnn, continues at Target and after the return
+	FlowJumpV0              // Bnnn, continues at Target plus a register
+	FlowSkip                // continues with the next or the one after
+	FlowReturn              // 00EE
+	FlowExit                // 00FD
+	FlowWait                // Fx0A, continues with the next instruction
+	FlowInvalid             // unknown opcode
+)
+
+// Decode the instruction at addr in mem.
+func Decode(mem []byte, addr uint16) Instruction {
+	in := Instruction{Addr: addr, Size: 2}
+	in.Opcode = word(mem, addr)
+	if in.Opcode == 0xf000 {
+		in.Long = word(mem, addr+2)
+		in.Size = 4
+	}
+	return in
+}
+
+func word(mem []byte, addr uint16) uint16 {
+	var hi, lo byte
+	if int(addr) < len(mem) {
+		hi = mem[addr]
+	}
+	if int(addr)+1 < len(mem) {
+		lo = mem[addr+1]
+	}
+	return uint16(hi)<<8 | uint16(lo)
+}
+
+// Next returns the address of the following instruction.
+func (in Instruction) Next() uint16 {
+	return in.Addr + in.Size
+}
+
+// Flow returns how the instruction continues.
+func (in Instruction) Flow() Flow {
+	op := in.Opcode
+	switch chip8.OpNr(op) {
+	case 0:
+		switch {
+		case op == 0x00ee:
+			return FlowReturn
+		case op == 0x00fd:
+			return FlowExit
+		}
+	case 1:
+		return FlowJump
+	case 2:
+		return FlowCall
+	case 3, 4, 9:
+		return FlowSkip
+	case 5:
+		if chip8.OpN(op) == 0 {
+			return FlowSkip
+		}
+	case 0xb:
+		return FlowJumpV0
+	case 0xe:
+		return FlowSkip
+	case 0xf:
+		if chip8.OpKK(op) == 0x0a {
+			return FlowWait
+		}
+	}
+	if in.Mnemonic() == "" {
+		return FlowInvalid
+	}
+	return FlowNext
+}
+
+// Target returns the address referenced by the instruction, if any.
+func (in Instruction) Target() (addr uint16, ok bool) {
+	switch chip8.OpNr(in.Opcode) {
+	case 1, 2, 0xa, 0xb:
+		return chip8.OpNNN(in.Opcode), true
+	case 0xf:
+		if in.Size == 4 {
+			return in.Long, true
+		}
+	}
+	return 0, false
+}
+
+// Label names target addresses, unlabeled targets are written as numbers.
+type LabelFunc func(addr uint16) (name string, ok bool)
+
+func (in Instruction) target(label LabelFunc, digits int) string {
+	addr, _ := in.Target()
+	if label != nil {
+		if name, ok := label(addr); ok {
+			return name
+		}
+	}
+	return fmt.Sprintf("#%0*X", digits, addr)
+}
+
+// Mnemonic returns the instruction in Cowgod's notation, or "" if the opcode is unknown.
+func (in Instruction) Mnemonic() string {
+	return in.Format(nil)
+}
+
+// Pattern returns the opcode with its operands in Cowgod's notation, e.g.
+// 8xy4 or Fx33, which names the instruction independent of the registers and
+// values. Unknown opcodes are returned in hex.
+func (in Instruction) Pattern() string {
+	op := in.Opcode
+	hex := fmt.Sprintf("%04X", op)
+	if in.Mnemonic() == "" {
+		return hex
+	}
+	switch chip8.OpNr(op) {
+	case 0:
+		switch {
+		case op&0xfff0 == 0x00c0, op&0xfff0 == 0x00d0:
+			return hex[:3] + "n"
+		case strings.HasPrefix(in.Mnemonic(), "SYS"):
+			return "0nnn"
+		}
+		return hex
+	case 1, 2, 0xa, 0xb:
+		return hex[:1] + "nnn"
+	case 3, 4, 6, 7, 0xc:
+		return hex[:1] + "xkk"
+	case 5, 8, 9:
+		return hex[:1] + "xy" + hex[3:]
+	case 0xd:
+		return "Dxyn"
+	case 0xf:
+		if op == 0xf000 || op == 0xf002 {
+			return hex
+		}
+	}
+	return hex[:1] + "x" + hex[2:]
+}
+
+// Format returns the instruction in Cowgod's notation with targets named by
+// label, or "" if the opcode is unknown.
+func (in Instruction) Format(label LabelFunc) string {
+	op := in.Opcode
+	x, y, n, kk := chip8.OpX(op), chip8.OpY(op), chip8.OpN(op), chip8.OpKK(op)
+
+	switch chip8.OpNr(op) {
+	case 0:
+		switch {
+		case op&0xfff0 == 0x00c0:
+			return fmt.Sprintf("SCD %d", n)
+		case op&0xfff0 == 0x00d0:
+			return fmt.Sprintf("SCU %d", n)
+		case op == 0x00e0:
+			return "CLS"
+		case op == 0x00ee:
+			return "RET"
+		case op == 0x00fb:
+			return "SCR"
+		case op == 0x00fc:
+			return "SCL"
+		case op == 0x00fd:
+			return "EXIT"
+		case op == 0x00fe:
+			return "LOW"
+		case op == 0x00ff:
+			return "HIGH"
+		}
+		return fmt.Sprintf("SYS #%03X", chip8.OpNNN(op))
+	case 1:
+		return "JP " + in.target(label, 3)
+	case 2:
+		return "CALL " + in.target(label, 3)
+	case 3:
+		return fmt.Sprintf("SE V%X, #%02X", x, kk)
+	case 4:
+		return fmt.Sprintf("SNE V%X, #%02X", x, kk)
+	case 5:
+		switch n {
+		case 0:
+			return fmt.Sprintf("SE V%X, V%X", x, y)
+		case 2:
+			return fmt.Sprintf("LD [I], V%X-V%X", x, y)
+		case 3:
+			return fmt.Sprintf("LD V%X-V%X, [I]", x, y)
+		}
+	case 6:
+		return fmt.Sprintf("LD V%X, #%02X", x, kk)
+	case 7:
+		return fmt.Sprintf("ADD V%X, #%02X", x, kk)
+	case 8:
+		names := map[uint16]string{
+			0: "LD", 1: "OR", 2: "AND", 3: "XOR", 4: "ADD",
+			5: "SUB", 6: "SHR", 7: "SUBN", 0xe: "SHL",
+		}
+		if name, ok := names[n]; ok {
+			return fmt.Sprintf("%s V%X, V%X", name, x, y)
+		}
+	case 9:
+		if n == 0 {
+			return fmt.Sprintf("SNE V%X, V%X", x, y)
+		}
+	case 0xa:
+		return "LD I, " + in.target(label, 3)
+	case 0xb:
+		return "JP V0, " + in.target(label, 3)
+	case 0xc:
+		return fmt.Sprintf("RND V%X, #%02X", x, kk)
+	case 0xd:
+		return fmt.Sprintf("DRW V%X, V%X, %d", x, y, n)
+	case 0xe:
+		switch kk {
+		case 0x9e:
+			return fmt.Sprintf("SKP V%X", x)
+		case 0xa1:
+			return fmt.Sprintf("SKNP V%X", x)
+		}
+	case 0xf:
+		if in.Size == 4 {
+			return "LD I, LONG " + in.target(label, 4)
+		}
+		switch kk {
+		case 0x01:
+			return fmt.Sprintf("PLANE %d", x)
+		case 0x02:
+			if x == 0 {
+				return "AUDIO"
+			}
+		case 0x07:
+			return fmt.Sprintf("LD V%X, DT", x)
+		case 0x0a:
+			return fmt.Sprintf("LD V%X, K", x)
+		case 0x15:
+			return fmt.Sprintf("LD DT, V%X", x)
+		case 0x18:
+			return fmt.Sprintf("LD ST, V%X", x)
+		case 0x1e:
+			return fmt.Sprintf("ADD I, V%X", x)
+		case 0x29:
+			return fmt.Sprintf("LD F, V%X", x)
+		case 0x30:
+			return fmt.Sprintf("LD HF, V%X", x)
+		case 0x33:
+			return fmt.Sprintf("LD B, V%X", x)
+		case 0x3a:
+			return fmt.Sprintf("PITCH V%X", x)
+		case 0x55:
+			return fmt.Sprintf("LD [I], V%X", x)
+		case 0x65:
+			return fmt.Sprintf("LD V%X, [I]", x)
+		case 0x75:
+			return fmt.Sprintf("LD R, V%X", x)
+		case 0x85:
+			return fmt.Sprintf("LD V%X, R", x)
+		}
+	}
+	return ""
+}
+
+// Octo returns the instruction in Octo syntax with targets named by label,
+// or "" if the opcode is unknown or has no Octo equivalent.
+func (in Instruction) Octo(label LabelFunc) string {
+	op := in.Opcode
+	x, y, n, kk := chip8.OpX(op), chip8.OpY(op), chip8.OpN(op), chip8.OpKK(op)
+	target := func() string {
+		addr, _ := in.Target()
+		if label != nil {
+			if name, ok := label(addr); ok {
+				return name
+			}
+		}
+		return fmt.Sprintf("0x%X", addr)
+	}
+
+	switch chip8.OpNr(op) {
+	case 0:
+		switch {
+		case op&0xfff0 == 0x00c0:
+			return fmt.Sprintf("scroll-down %d", n)
+		case op&0xfff0 == 0x00d0:
+			return fmt.Sprintf("scroll-up %d", n)
+		case op == 0x00e0:
+			return "clear"
+		case op == 0x00ee:
+			return "return"
+		case op == 0x00fb:
+			return "scroll-right"
+		case op == 0x00fc:
+			return "scroll-left"
+		case op == 0x00fd:
+			return "exit"
+		case op == 0x00fe:
+			return "lores"
+		case op == 0x00ff:
+			return "hires"
+		}
+	case 1:
+		return "jump " + target()
+	case 2:
+		return ":call " + target()
+	// Octo only has conditional execution, which skips if the condition is false
+	case 3:
+		return fmt.Sprintf("if v%x != 0x%02X then", x, kk)
+	case 4:
+		return fmt.Sprintf("if v%x == 0x%02X then", x, kk)
+	case 5:
+		switch n {
+		case 0:
+			return fmt.Sprintf("if v%x != v%x then", x, y)
+		case 2:
+			return fmt.Sprintf("save v%x - v%x", x, y)
+		case 3:
+			return fmt.Sprintf("load v%x - v%x", x, y)
+		}
+	case 6:
+		return fmt.Sprintf("v%x := 0x%02X", x, kk)
+	case 7:
+		return fmt.Sprintf("v%x += 0x%02X", x, kk)
+	case 8:
+		ops := map[uint16]string{
+			0: ":=", 1: "|=", 2: "&=", 3: "^=", 4: "+=",
+			5: "-=", 6: ">>=", 7: "=-", 0xe: "<<=",
+		}
+		if o, ok := ops[n]; ok {
+			return fmt.Sprintf("v%x %s v%x", x, o, y)
+		}
+	case 9:
+		if n == 0 {
+			return fmt.Sprintf("if v%x == v%x then", x, y)
+		}
+	case 0xa:
+		return "i := " + target()
+	case 0xb:
+		return "jump0 " + target()
+	case 0xc:
+		return fmt.Sprintf("v%x := random 0x%02X", x, kk)
+	case 0xd:
+		return fmt.Sprintf("sprite v%x v%x %d", x, y, n)
+	case 0xe:
+		switch kk {
+		case 0x9e:
+			return fmt.Sprintf("if v%x -key then", x)
+		case 0xa1:
+			return fmt.Sprintf("if v%x key then", x)
+		}
+	case 0xf:
+		if in.Size == 4 {
+			return "i := long " + target()
+		}
+		forms := map[uint16]string{
+			0x07: "v%x := delay",
+			0x0a: "v%x := key",
+			0x15: "delay := v%x",
+			0x18: "buzzer := v%x",
+			0x1e: "i += v%x",
+			0x29: "i := hex v%x",
+			0x30: "i := bighex v%x",
+			0x33: "bcd v%x",
+			0x3a: "pitch := v%x",
+			0x55: "save v%x",
+			0x65: "load v%x",
+			0x75: "saveflags v%x",
+			0x85: "loadflags v%x",
+		}
+		switch {
+		case kk == 0x01:
+			return fmt.Sprintf("plane %d", x)
+		case kk == 0x02 && x == 0:
+			return "audio"
+		}
+		if form, ok := forms[kk]; ok {
+			return fmt.Sprintf(form, x)
+		}
+	}
+	return ""
+}
+
+func (in Instruction) String() string {
+	if m := in.Mnemonic(); m != "" {
+		return m
+	}
+	return fmt.Sprintf("DW #%04X", in.Opcode)
+}
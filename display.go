@@ -0,0 +1,126 @@
+package chip8
+
+// Rect is a region of the display in pixels.
+type Rect struct {
+	X, Y, Width, Height int
+}
+
+func (r Rect) Empty() bool {
+	return r.Width <= 0 || r.Height <= 0
+}
+
+// Union returns the smallest Rect containing r and s.
+func (r Rect) Union(s Rect) Rect {
+	if r.Empty() {
+		return s
+	}
+	if s.Empty() {
+		return r
+	}
+	x0, y0 := min(r.X, s.X), min(r.Y, s.Y)
+	x1, y1 := max(r.X+r.Width, s.X+s.Width), max(r.Y+r.Height, s.Y+s.Height)
+	return Rect{x0, y0, x1 - x0, y1 - y0}
+}
+
+// Display is the screen of the Emulator. It implements drawing, collision,
+// clipping and scrolling for all Graphics, which only present the frames,
+// and keeps track of the region changed since the last frame.
+type Display struct {
+	Framebuffer
+	dirty Rect
+}
+
+// Init switches to the low resolution with the first bitplane selected.
+func (d *Display) Init() error {
+	d.Framebuffer = *NewFramebuffer(int(DisplayWidth), int(DisplayHeigth))
+	d.touch()
+	return nil
+}
+
+// touch marks the whole display as changed.
+func (d *Display) touch() {
+	d.dirty = Rect{0, 0, d.Width, d.Height}
+}
+
+// Set replaces the content of the display, e.g. from a save state.
+func (d *Display) Set(f Framebuffer) {
+	d.Framebuffer = f
+	d.touch()
+}
+
+func (d *Display) Clear() {
+	d.Framebuffer.Clear()
+	d.touch()
+}
+
+// Resize switches the resolution and clears the display.
+func (d *Display) Resize(width, height int) {
+	d.Framebuffer.Resize(width, height)
+	d.touch()
+}
+
+// Scroll moves the content of the display by dx, dy pixels. Pixels
+// scrolled in from outside are blank.
+func (d *Display) Scroll(dx, dy int) {
+	d.Framebuffer.Scroll(dx, dy)
+	d.touch()
+}
+
+// Draw XORs the sprite onto the display at (x, y). The sprite is width
+// (8 or 16) pixels wide, every row takes width/8 bytes. The position wraps
+// around the display; pixels beyond the edges are clipped if clip is set
+// and wrap around otherwise. The data of every selected plane follows the
+// previous one. Returns the number of rows with collision.
+func (d *Display) Draw(x, y int, sprite []byte, width int, clip bool) (collision int) {
+	planes := 0
+	for plane := 0; plane < PlaneCount; plane++ {
+		if d.Planes&(1<<plane) != 0 {
+			planes++
+		}
+	}
+	if planes == 0 || len(sprite) == 0 {
+		return 0
+	}
+	x, y = x%d.Width, y%d.Height
+	height := len(sprite) / planes / (width / 8)
+
+	// a wrapped sprite touches both edges, which is the full span
+	area := Rect{x, y, width, height}
+	if x+width > d.Width {
+		if clip {
+			area.Width = d.Width - x
+		} else {
+			area.X, area.Width = 0, d.Width
+		}
+	}
+	if y+height > d.Height {
+		if clip {
+			area.Height = d.Height - y
+		} else {
+			area.Y, area.Height = 0, d.Height
+		}
+	}
+	d.dirty = d.dirty.Union(area)
+
+	return d.Framebuffer.Draw(x, y, sprite, width, clip)
+}
+
+// setPixel sets the color of the pixel and marks it changed if it differs.
+func (d *Display) setPixel(x, y int, c byte) {
+	if i := y*d.Width + x; d.Pixels[i] != c {
+		d.Pixels[i] = c
+		d.dirty = d.dirty.Union(Rect{x, y, 1, 1})
+	}
+}
+
+// Dirty returns the region changed since the last frame.
+func (d *Display) Dirty() Rect {
+	return d.dirty
+}
+
+// flush returns the region changed since the last frame and starts a new frame.
+func (d *Display) flush() Rect {
+	dirty := d.dirty
+	d.dirty = Rect{}
+	return dirty
+}
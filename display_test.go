@@ -0,0 +1,42 @@
+package chip8
+
+import "testing"
+
+func TestDisplayDirty(t *testing.T) {
+	d := newDisplay()
+	if dirty := d.flush(); dirty != (Rect{0, 0, 64, 32}) {
+		t.Errorf("Initial frame not dirty, dirty=%v", dirty)
+	}
+	if !d.flush().Empty() {
+		t.Errorf("Dirty after flush")
+	}
+
+	for _, data := range []struct {
+		x, y   int
+		sprite []byte
+		width  int
+		clip   bool
+		dirty  Rect
+	}{
+		{1, 2, []byte{0xff, 0xff}, 8, false, Rect{1, 2, 8, 2}},
+		{60, 31, []byte{0xff, 0xff}, 8, true, Rect{60, 31, 4, 1}},
+		{60, 31, []byte{0xff, 0xff}, 8, false, Rect{0, 0, 64, 32}},
+		{124, 2, []byte{0xff, 0xff}, 16, false, Rect{0, 2, 64, 1}},
+	} {
+		d.Draw(data.x, data.y, data.sprite, data.width, data.clip)
+		if dirty := d.flush(); dirty != data.dirty {
+			t.Errorf("Draw at %d,%d: expected dirty=%v actual=%v", data.x, data.y, data.dirty, dirty)
+		}
+	}
+
+	// the union of several changes
+	d.Draw(1, 1, []byte{0x80}, 8, false)
+	d.Draw(20, 10, []byte{0x80}, 8, false)
+	if dirty := d.flush(); dirty != (Rect{1, 1, 27, 10}) {
+		t.Errorf("Wrong union, dirty=%v", dirty)
+	}
+	d.Scroll(0, 1)
+	if dirty := d.flush(); dirty != (Rect{0, 0, 64, 32}) {
+		t.Errorf("Scroll did not dirty the display, dirty=%v", dirty)
+	}
+}
@@ -1,36 +1,95 @@
 package chip8
 
-import "time"
+import (
+	"bytes"
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// Instructions executed per 60 Hz frame by RunFrame, about 600 per second
+const DefaultInstructionsPerFrame = 10
+
+// Frame rate of Run, which is also the rate of the timers
+const FrameRate = 60
+
+// Tracer follows the instructions executed by Step and RunFrame, e.g. to
+// log them.
+type Tracer interface {
+	// Trace is called with the emulator in the state before the
+	// instruction at pc
+	Trace(e *Emulator, pc, opcode uint16)
+}
 
 type Emulator struct {
 	isInit   bool
 	CPU      CPU
 	Memory   Memory
+	Keypad   Keypad
+	Display  Display
 	Graphics Graphics
 	Input    Input
+	Audio    Audio
+	Quirks   Quirks
+	// InstructionsPerFrame is the speed of RunFrame, zero value means
+	// DefaultInstructionsPerFrame
+	InstructionsPerFrame int
+	// Timing replaces InstructionsPerFrame by cycle costs if not nil
+	Timing Timing
+	// RNG is the source of the random numbers of Cxkk, a randomly
+	// seeded RNGPCG by default
+	RNG RNG
+	// Watchpoints reports memory accesses of the CPU if not nil
+	Watchpoints *Watchpoints
+	// Rewind records the state of every frame if not nil
+	Rewind *Rewind
+	// Recorder captures every frame if not nil
+	Recorder *Recorder
+	// Tracer is called before every instruction of CPU if not nil
+	Tracer Tracer
+	// VIP runs the frames of RunFrame on the emulated COSMAC VIP instead of
+	// CPU if not nil, see StartVIP
+	VIP *VIP
+
+	beeping bool
+	pattern [16]byte // XO-CHIP audio pattern and pitch last passed to Audio
+	pitch   byte
+	vblank  bool // a frame started since the last Dxyn
+	cycles  int  // cycles of Timing left in the frame
+	control runControl
 }
 
 func CreateDefaultEmulator() (*Emulator, error) {
-	return CreateEmulator(&GraphicsTermbox{}, &InputTermbox{})
+	return CreateEmulator(&GraphicsTermbox{}, &InputTermbox{}, &AudioBell{})
 }
 
-func CreateEmulator(graphics Graphics, input Input) (*Emulator, error) {
+func CreateEmulator(graphics Graphics, input Input, audio Audio) (*Emulator, error) {
 	emulator := &Emulator{
 		Graphics: graphics,
 		Input:    input,
+		Audio:    audio,
+		Quirks:   QuirksModern,
 	}
+	emulator.Seed(rand.Uint64())
 	if err := emulator.Graphics.Init(); err != nil {
 		return nil, err
 	}
 	if err := emulator.Input.Init(); err != nil {
 		return nil, err
 	}
+	if err := emulator.Audio.Init(); err != nil {
+		return nil, err
+	}
 	if err := emulator.Memory.Init(); err != nil {
 		return nil, err
 	}
 	if err := emulator.CPU.Init(); err != nil {
 		return nil, err
 	}
+	if err := emulator.Display.Init(); err != nil {
+		return nil, err
+	}
+	emulator.pattern, emulator.pitch = emulator.CPU.Pattern, emulator.CPU.Pitch
 
 	emulator.isInit = true
 	return emulator, nil
@@ -40,45 +99,248 @@ func (e *Emulator) Close() {
 	if !e.isInit {
 		return
 	}
-	e.Input.WaitForEvent()
-	e.Graphics.Close()
 	e.Input.Close()
+	e.Graphics.Close()
+	e.Audio.Close()
 	e.isInit = false
 }
 
 func (e *Emulator) Step(delayTick bool) error {
-	opcode := e.CPU.fetch(&e.Memory)
+	e.Keypad.Update(e.Input.Keys())
+	return e.step(delayTick)
+}
+
+// step executes one instruction without polling Input.
+func (e *Emulator) step(delayTick bool) error {
+	opcode := e.CPU.fetch(e.bus())
+	if e.Tracer != nil {
+		e.Tracer.Trace(e, e.CPU.PC, opcode)
+	}
+	if e.Watchpoints != nil {
+		e.Watchpoints.execute(e.CPU.PC, opcode)
+	}
 	if err := e.CPU.execute(opcode, e); err != nil {
 		return err
 	}
+	e.updateBeeper()
 	if delayTick {
-		e.CPU.delayTick()
+		e.frameTick()
+	}
+
+	return nil
+}
+
+// frameTick ends a 60 Hz frame: the timers tick and the display is presented.
+func (e *Emulator) frameTick() {
+	e.CPU.delayTick()
+	e.vblank = true
+	e.updateBeeper()
+	e.Audio.Tick()
+	e.Present()
+	if e.Recorder != nil {
+		e.Recorder.Frame(&e.Display.Framebuffer)
+	}
+}
+
+// RunFrame executes the InstructionsPerFrame instructions of one 60 Hz
+// frame, or the instructions fitting in the frame if Timing is set, the
+// timers tick once after the last one. The keypad is polled from Input
+// once at the start, so the same keys in the same state always lead to the
+// same next state. Input implementing FrameInput is called after the frame.
+func (e *Emulator) RunFrame() error {
+	e.Keypad.Update(e.Input.Keys())
+	if e.VIP != nil {
+		e.VIP.runFrame(e)
+		e.frameTick()
+	} else if e.Timing != nil {
+		if err := e.runCycles(); err != nil {
+			return err
+		}
+	} else {
+		n := e.InstructionsPerFrame
+		if n <= 0 {
+			n = DefaultInstructionsPerFrame
+		}
+		for i := 1; i <= n; i++ {
+			if err := e.step(i == n); err != nil {
+				return err
+			}
+		}
+	}
+	if f, ok := e.Input.(FrameInput); ok {
+		return f.EndFrame(e)
 	}
+	return nil
+}
 
+// Reset returns to the power-on state: the memory holds only the fonts, or
+// the interpreter of the VIP, and the display is blank. Quirks and the random
+// numbers are kept.
+func (e *Emulator) Reset() error {
+	e.Memory = Memory{}
+	e.CPU = CPU{}
+	e.Keypad = Keypad{}
+	e.vblank = false
+	e.cycles = 0
+	for _, init := range []func() error{e.Memory.Init, e.CPU.Init, e.Display.Init} {
+		if err := init(); err != nil {
+			return err
+		}
+	}
+	if e.VIP != nil {
+		e.VIP.reset(e)
+	}
+	e.updateBeeper()
 	return nil
 }
 
-func (e *Emulator) Run() error {
-	// ~600Hz
-	processor_tick := time.NewTicker(time.Second / 600)
-	// 60Hz for timers
-	delay_tick := time.NewTicker(time.Second / 60)
-	delay := false
-	var err error = nil
+// Present passes the display to Graphics if it changed since the last frame.
+// Step presents at every delay tick.
+func (e *Emulator) Present() {
+	if dirty := e.Display.flush(); !dirty.Empty() {
+		e.Graphics.Present(&e.Display.Framebuffer, dirty)
+	}
+}
+
+// Seed replaces RNG by an RNGPCG with the seed.
+func (e *Emulator) Seed(seed uint64) {
+	e.RNG = NewRNGPCG(seed)
+}
 
-	for err == nil {
-		<-processor_tick.C
-		err = e.Step(delay)
+// bus returns how the CPU accesses memory.
+func (e *Emulator) bus() Bus {
+	if e.Watchpoints != nil {
+		return e.Watchpoints
+	}
+	return &e.Memory
+}
+
+// updateBeeper starts or stops the beeper when the sound timer changes
+// between zero and non-zero, or Q of the VIP changes, and passes on a new XO-CHIP audio pattern.
+func (e *Emulator) updateBeeper() {
+	if e.CPU.Pattern != e.pattern || e.CPU.Pitch != e.pitch {
+		e.pattern, e.pitch = e.CPU.Pattern, e.CPU.Pitch
+		e.Audio.SetPattern(e.pattern, e.pitch)
+	}
+	on := e.CPU.ST > 0
+	if e.VIP != nil {
+		// the Q output drives the tone of the VIP
+		on = e.VIP.CPU.Q
+	}
+	if on != e.beeping {
+		e.beeping = on
+		if on {
+			e.Audio.Start()
+		} else {
+			e.Audio.Stop()
+		}
+	}
+}
+
+// Run runs frames at FrameRate times Speed until an error or until ctx is
+// done, which returns ctx.Err(). While paused, only the hotkeys are handled.
+func (e *Emulator) Run(ctx context.Context) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	// stop stops the timer and drains a tick not received, which would end
+	// the next wait at once
+	stop := func() {
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+	}
+	// sleep waits for the duration or until ctx is done
+	sleep := func(d time.Duration) {
+		timer.Reset(d)
 		select {
-		case <-delay_tick.C:
-			delay = true
-		default:
-			delay = false
+		case <-ctx.Done():
+			stop()
+		case <-timer.C:
+		}
+	}
+	<-timer.C
+	p := &pacer{now: time.Now, sleep: sleep}
+
+	for ctx.Err() == nil {
+		run, speed, wake := e.control.next()
+		if !run {
+			// poll the hotkeys, which may resume
+			timer.Reset(framePeriod(1))
+			select {
+			case <-ctx.Done():
+			case <-wake:
+			case <-timer.C:
+			}
+			stop()
+			e.runHotkeys()
+			p.next = time.Time{}
+			continue
+		}
+		if period := framePeriod(speed); period != p.period {
+			p.period, p.next = period, time.Time{}
+		}
+		p.wait()
+		if ctx.Err() != nil {
+			break
+		}
+
+		var err error
+		if e.rewinding() {
+			// time runs backwards one frame per tick
+			_, err = e.StepBack()
+		} else if err = e.RunFrame(); err == nil {
+			err = e.RecordFrame()
+		}
+		if err != nil {
+			return err
+		}
+		e.runHotkeys()
+	}
+	return ctx.Err()
+}
+
+// RecordFrame pushes the current state to Rewind, if set.
+func (e *Emulator) RecordFrame() error {
+	if e.Rewind == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := e.SaveState(&buf); err != nil {
+		return err
+	}
+	e.Rewind.Push(buf.Bytes())
+	return nil
+}
+
+// StepBack goes back to the previous frame recorded by Rewind. Returns false
+// if there is none.
+func (e *Emulator) StepBack() (bool, error) {
+	if e.Rewind == nil {
+		return false, nil
+	}
+	state, ok := e.Rewind.Pop()
+	if !ok {
+		return false, nil
+	}
+	return true, e.LoadState(bytes.NewReader(state))
+}
+
+// rewinding reports whether Input asks to run time backwards.
+func (e *Emulator) rewinding() bool {
+	r, ok := e.Input.(RewindInput)
+	return ok && e.Rewind != nil && r.Rewinding()
+}
+
+// runHotkeys calls the actions of the hotkeys pressed on Input.
+func (e *Emulator) runHotkeys() {
+	if h, ok := e.Input.(HotkeyInput); ok {
+		for _, action := range h.PendingHotkeys() {
+			action()
 		}
 	}
-	delay_tick.Stop()
-	processor_tick.Stop()
-	return err
 }
 
 func (e *Emulator) LoadProgram(b []byte) error {
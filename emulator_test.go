@@ -0,0 +1,64 @@
+package chip8
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRunFrame(t *testing.T) {
+	e, err := CreateEmulator(&GraphicsHeadless{}, &InputNull{}, &AudioNull{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{7, 1000} {
+		e.Reset()
+		// LD V0, #50; LD DT, V0; ADD V1, 1; JP #204
+		e.LoadProgram([]byte{0x60, 0x50, 0xf0, 0x15, 0x71, 0x01, 0x12, 0x04})
+		e.InstructionsPerFrame = n
+		for frame := 1; frame <= 3; frame++ {
+			if err := e.RunFrame(); err != nil {
+				t.Fatal(err)
+			}
+			if e.CPU.DT != 0x50-byte(frame) {
+				t.Errorf("%d instructions, frame %d: DT=%02x", n, frame, e.CPU.DT)
+			}
+		}
+		// 2 instructions of setup, then ADD and JP in turn
+		if expected := byte((3*n - 2 + 1) / 2); e.CPU.V[1] != expected {
+			t.Errorf("%d instructions: V1=%d, expected %d", n, e.CPU.V[1], expected)
+		}
+	}
+}
+
+func TestPacer(t *testing.T) {
+	now := time.Unix(0, 0)
+	var slept []time.Duration
+	p := &pacer{
+		period: 10 * time.Millisecond,
+		now:    func() time.Time { return now },
+		sleep: func(d time.Duration) {
+			slept = append(slept, d)
+			now = now.Add(d)
+		},
+	}
+
+	p.wait() // starts at once
+	now = now.Add(4 * time.Millisecond)
+	p.wait() // waits for the rest of the period
+	now = now.Add(13 * time.Millisecond)
+	p.wait() // late, no wait and the next deadline stays
+	p.wait()
+	now = now.Add(time.Second)
+	p.wait() // too far behind, starts over
+	p.wait()
+
+	expected := []time.Duration{6 * time.Millisecond, 7 * time.Millisecond, 10 * time.Millisecond}
+	if len(slept) != len(expected) {
+		t.Fatalf("Wrong sleeps %v, expected %v", slept, expected)
+	}
+	for i := range expected {
+		if slept[i] != expected[i] {
+			t.Fatalf("Wrong sleeps %v, expected %v", slept, expected)
+		}
+	}
+}
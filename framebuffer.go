@@ -0,0 +1,119 @@
+package chip8
+
+// Framebuffer is a resizable display that implements the CHIP-8 drawing
+// operations. Every pixel holds one bit per XO-CHIP bitplane, which gives
+// up to 4 colors.
+type Framebuffer struct {
+	Width  int
+	Height int
+	Pixels []byte // row by row, Width*Height pixels
+	Planes byte   // bitplanes affected by Clear, Scroll and Draw
+}
+
+// Number of XO-CHIP bitplanes
+const PlaneCount = 2
+
+func NewFramebuffer(width, height int) *Framebuffer {
+	f := &Framebuffer{Planes: 1}
+	f.Resize(width, height)
+	return f
+}
+
+func (f *Framebuffer) Resize(width, height int) {
+	f.Width = width
+	f.Height = height
+	f.Pixels = make([]byte, width*height)
+}
+
+func (f *Framebuffer) Clear() {
+	for i := range f.Pixels {
+		f.Pixels[i] &^= f.Planes
+	}
+}
+
+// Pixel returns the color of the pixel, bit n is set if it is on in plane n.
+func (f *Framebuffer) Pixel(x, y int) byte {
+	return f.Pixels[y*f.Width+x]
+}
+
+func (f *Framebuffer) Scroll(dx, dy int) {
+	pixels := make([]byte, len(f.Pixels))
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			i := y*f.Width + x
+			pixels[i] = f.Pixels[i] &^ f.Planes
+
+			sx, sy := x-dx, y-dy
+			if sx < 0 || sx >= f.Width || sy < 0 || sy >= f.Height {
+				continue
+			}
+			pixels[i] |= f.Pixels[sy*f.Width+sx] & f.Planes
+		}
+	}
+	f.Pixels = pixels
+}
+
+// Draw XORs the sprite onto the framebuffer, see Display.Draw. The sprite
+// holds the data of every selected plane one after the other.
+func (f *Framebuffer) Draw(x, y int, sprite []byte, width int, clip bool) (collision int) {
+	x, y = x%f.Width, y%f.Height
+	rowBytes := width / 8
+
+	planes := 0
+	for plane := 0; plane < PlaneCount; plane++ {
+		if f.Planes&(1<<plane) != 0 {
+			planes++
+		}
+	}
+	if planes == 0 {
+		return 0
+	}
+	size := len(sprite) / planes
+
+	for plane := byte(0); plane < PlaneCount; plane++ {
+		bit := byte(1) << plane
+		if f.Planes&bit == 0 {
+			continue
+		}
+		collision += f.drawPlane(x, y, sprite[:size], rowBytes, bit, clip)
+		sprite = sprite[size:]
+	}
+	return collision
+}
+
+func (f *Framebuffer) drawPlane(x, y int, sprite []byte, rowBytes int, bit byte, clip bool) (collision int) {
+	width := rowBytes * 8
+	for row := 0; (row+1)*rowBytes <= len(sprite); row++ {
+		py := y + row
+		if py >= f.Height {
+			if clip {
+				break
+			}
+			py %= f.Height
+		}
+
+		hit := false
+		for col := 0; col < width; col++ {
+			if (sprite[row*rowBytes+col/8]>>(7-col%8))&1 == 0 {
+				continue
+			}
+			px := x + col
+			if px >= f.Width {
+				if clip {
+					break
+				}
+				px %= f.Width
+			}
+			i := py*f.Width + px
+			if f.Pixels[i]&bit != 0 {
+				// collision only set on erased pixels
+				hit = true
+			}
+			f.Pixels[i] ^= bit
+		}
+		if hit {
+			collision++
+		}
+	}
+	return collision
+}
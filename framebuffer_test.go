@@ -0,0 +1,97 @@
+package chip8
+
+import "testing"
+
+func framebufferRows(f *Framebuffer) []string {
+	rows := make([]string, f.Height)
+	for y := range rows {
+		for x := 0; x < f.Width; x++ {
+			if f.Pixel(x, y) != 0 {
+				rows[y] += "#"
+			} else {
+				rows[y] += "."
+			}
+		}
+	}
+	return rows
+}
+
+func expectRows(t *testing.T, f *Framebuffer, expected []string) {
+	t.Helper()
+	actual := framebufferRows(f)
+	for y := range expected {
+		if actual[y] != expected[y] {
+			t.Errorf("Wrong framebuffer\nexpected=%q\nactual=  %q", expected, actual)
+			return
+		}
+	}
+}
+
+func TestFramebufferDraw(t *testing.T) {
+	f := NewFramebuffer(8, 4)
+
+	if c := f.Draw(0, 0, []byte{0xc0, 0x80}, 8, false); c != 0 {
+		t.Errorf("Unexpected collision=%d", c)
+	}
+	expectRows(t, f, []string{"##......", "#.......", "........", "........"})
+
+	if c := f.Draw(1, 0, []byte{0xc0, 0xc0}, 8, false); c != 1 {
+		t.Errorf("Wrong collision, expected=%d actual=%d", 1, c)
+	}
+	expectRows(t, f, []string{"#.#.....", "###.....", "........", "........"})
+
+	// the start position wraps, the sprite wraps or is clipped
+	f.Clear()
+	f.Draw(15, 3, []byte{0xc0, 0xc0}, 8, false)
+	expectRows(t, f, []string{"#......#", "........", "........", "#......#"})
+	f.Clear()
+	f.Draw(15, 3, []byte{0xc0, 0xc0}, 8, true)
+	expectRows(t, f, []string{"........", "........", "........", ".......#"})
+
+	f.Clear()
+	f.Draw(0, 0, []byte{0x80, 0x01, 0x80, 0x01}, 16, true)
+	if f.Pixel(0, 0) != 1 || f.Pixel(7, 1) != 0 {
+		t.Errorf("Wrong 16 pixel wide sprite\n%q", framebufferRows(f))
+	}
+}
+
+func TestFramebufferScroll(t *testing.T) {
+	f := NewFramebuffer(8, 4)
+	f.Draw(0, 0, []byte{0x81}, 8, false)
+
+	f.Scroll(0, 2)
+	expectRows(t, f, []string{"........", "........", "#......#", "........"})
+	f.Scroll(4, 0)
+	expectRows(t, f, []string{"........", "........", "....#...", "........"})
+	f.Scroll(-4, -1)
+	expectRows(t, f, []string{"........", "#.......", "........", "........"})
+}
+
+func TestFramebufferPlanes(t *testing.T) {
+	f := NewFramebuffer(8, 2)
+
+	f.Planes = 3
+	f.Draw(0, 0, []byte{0xf0, 0xf0, 0x3c, 0x3c}, 8, false)
+	for x, expected := range []byte{1, 1, 3, 3, 2, 2, 0, 0} {
+		if actual := f.Pixel(x, 1); actual != expected {
+			t.Errorf("Wrong color at %d,1: expected=%d actual=%d", x, expected, actual)
+		}
+	}
+
+	f.Planes = 2
+	if c := f.Draw(0, 0, []byte{0x80}, 8, false); c != 0 {
+		t.Errorf("Unexpected collision on plane 2: %d", c)
+	}
+	f.Clear()
+	for x, expected := range []byte{1, 1, 1, 1, 0, 0, 0, 0} {
+		if actual := f.Pixel(x, 0); actual != expected {
+			t.Errorf("Wrong color after clearing plane 2 at %d,0: expected=%d actual=%d", x, expected, actual)
+		}
+	}
+
+	f.Planes = 1
+	f.Scroll(0, 1)
+	if f.Pixel(0, 0) != 0 || f.Pixel(0, 1) != 1 || f.Pixel(2, 1) != 1 {
+		t.Errorf("Wrong framebuffer after scrolling plane 1: %v", f.Pixels)
+	}
+}
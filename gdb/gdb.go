@@ -0,0 +1,413 @@
+// Package gdb is a stub for the GDB remote serial protocol, it lets gdb and
+// other tools debug the emulator over TCP. Registers, memory, breakpoints,
+// watchpoints, single step and continue are supported.
+//
+// The protocol is described at
+// https://sourceware.org/gdb/current/onlinedocs/gdb.html/Remote-Protocol.html
+package gdb
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/debuggerpls/go-chip8"
+	"github.com/debuggerpls/go-chip8/debug"
+)
+
+// Default address of the stub
+const DefaultAddr = "localhost:2159"
+
+// Signals of stop replies
+const (
+	sigInt  = 2
+	sigIll  = 4
+	sigTrap = 5
+)
+
+type Server struct {
+	Debugger *debug.Debugger
+}
+
+func CreateServer(d *debug.Debugger) *Server {
+	return &Server{Debugger: d}
+}
+
+// ListenAndServe accepts connections on addr and serves one at a time.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return s.ServeListener(l)
+}
+
+func (s *Server) ServeListener(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		err = s.Serve(conn)
+		conn.Close()
+		if errors.Is(err, errKilled) {
+			return nil
+		}
+	}
+}
+
+var errKilled = errors.New("killed by the client")
+
+type session struct {
+	d       *debug.Debugger
+	w       io.Writer
+	mu      sync.Mutex // writes
+	noAck   bool
+	packets chan string
+	done    chan struct{} // closed when the session ends
+	err     error         // of the reader, valid after packets is closed
+}
+
+// Serve runs one debugging session on conn until the client detaches or
+// the connection is closed.
+func (s *Server) Serve(conn io.ReadWriter) error {
+	ss := &session{d: s.Debugger, w: conn, packets: make(chan string), done: make(chan struct{})}
+	defer close(ss.done)
+	go ss.read(bufio.NewReader(conn))
+
+	for packet := range ss.packets {
+		reply, err := ss.handle(packet)
+		if err == errDetached {
+			ss.send("OK")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := ss.send(reply); err != nil {
+			return err
+		}
+	}
+	if ss.err == io.EOF {
+		return nil
+	}
+	return ss.err
+}
+
+// read reads packets, a Ctrl-C (0x03) interrupts the running program right
+// away.
+func (ss *session) read(r *bufio.Reader) {
+	defer close(ss.packets)
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			ss.err = err
+			return
+		}
+		switch c {
+		case 0x03:
+			ss.d.Interrupt()
+			continue
+		case '$':
+		default:
+			// acks and noise between packets
+			continue
+		}
+
+		data, err := r.ReadString('#')
+		if err != nil {
+			ss.err = err
+			return
+		}
+		data = data[:len(data)-1]
+		var sum [2]byte
+		if _, err := io.ReadFull(r, sum[:]); err != nil {
+			ss.err = err
+			return
+		}
+		if !ss.noAck {
+			ack := "+"
+			if fmt.Sprintf("%02x", checksum(data)) != strings.ToLower(string(sum[:])) {
+				ack = "-"
+			}
+			ss.write(ack)
+			if ack == "-" {
+				continue
+			}
+		}
+		select {
+		case ss.packets <- data:
+		case <-ss.done:
+			return
+		}
+		if data == "QStartNoAckMode" {
+			ss.noAck = true
+		}
+	}
+}
+
+func checksum(data string) byte {
+	var sum byte
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	return sum
+}
+
+func (ss *session) write(s string) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	_, err := io.WriteString(ss.w, s)
+	return err
+}
+
+func (ss *session) send(data string) error {
+	return ss.write(fmt.Sprintf("$%s#%02x", escape(data), checksum(escape(data))))
+}
+
+// escape escapes the characters that frame packets.
+func escape(data string) string {
+	if !strings.ContainsAny(data, "$#}*") {
+		return data
+	}
+	var b strings.Builder
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; c {
+		case '$', '#', '}', '*':
+			b.WriteByte('}')
+			b.WriteByte(c ^ 0x20)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+var errDetached = errors.New("detached")
+
+func errorReply(code int) string {
+	return fmt.Sprintf("E%02x", code)
+}
+
+// handle executes a packet and returns the reply, "" for unsupported packets.
+func (ss *session) handle(packet string) (string, error) {
+	d := ss.d
+	if packet == "" {
+		return "", nil
+	}
+	cmd, args := packet[0], packet[1:]
+
+	switch cmd {
+	case '?':
+		return fmt.Sprintf("S%02x", sigTrap), nil
+	case 'g':
+		var b strings.Builder
+		for n := range debug.Registers {
+			b.WriteString(ss.register(n))
+		}
+		return b.String(), nil
+	case 'G':
+		for n := range debug.Registers {
+			size := 2 * registerSize(n)
+			if len(args) < size {
+				return errorReply(1), nil
+			}
+			if !ss.setRegister(n, args[:size]) {
+				return errorReply(1), nil
+			}
+			args = args[size:]
+		}
+		return "OK", nil
+	case 'p':
+		n, err := strconv.ParseUint(args, 16, 8)
+		if err != nil || int(n) >= len(debug.Registers) {
+			return errorReply(1), nil
+		}
+		return ss.register(int(n)), nil
+	case 'P':
+		num, value, _ := strings.Cut(args, "=")
+		n, err := strconv.ParseUint(num, 16, 8)
+		if err != nil || int(n) >= len(debug.Registers) || len(value) != 2*registerSize(int(n)) {
+			return errorReply(1), nil
+		}
+		if !ss.setRegister(int(n), value) {
+			return errorReply(1), nil
+		}
+		return "OK", nil
+	case 'm':
+		addr, length, ok := parseAddrLength(args)
+		if !ok {
+			return errorReply(1), nil
+		}
+		mem := d.Emulator.Memory[:]
+		end := min(int(addr)+length, len(mem))
+		return hex.EncodeToString(mem[addr:end]), nil
+	case 'M':
+		spec, data, _ := strings.Cut(args, ":")
+		addr, length, ok := parseAddrLength(spec)
+		b, err := hex.DecodeString(data)
+		if !ok || err != nil || len(b) != length || int(addr)+length > chip8.MemorySize {
+			return errorReply(1), nil
+		}
+		d.Emulator.Memory.Load(int(addr), b)
+		return "OK", nil
+	case 'Z', 'z':
+		return ss.breakpoint(cmd == 'Z', args), nil
+	case 's':
+		if args != "" {
+			return "", nil
+		}
+		return ss.stopReply(d.Step()), nil
+	case 'c':
+		if args != "" {
+			return "", nil
+		}
+		return ss.stopReply(d.Continue()), nil
+	case 'H':
+		return "OK", nil
+	case 'D':
+		return "", errDetached
+	case 'k':
+		return "", errKilled
+	case 'q', 'Q':
+		return ss.query(packet), nil
+	}
+	return "", nil
+}
+
+// register returns the hex value of register n, little endian.
+func (ss *session) register(n int) string {
+	v, _ := ss.d.Register(debug.Registers[n])
+	if registerSize(n) == 2 {
+		return fmt.Sprintf("%02x%02x", v&0xff, v>>8)
+	}
+	return fmt.Sprintf("%02x", v)
+}
+
+func (ss *session) setRegister(n int, value string) bool {
+	b, err := hex.DecodeString(value)
+	if err != nil {
+		return false
+	}
+	v := int(b[0])
+	if len(b) == 2 {
+		v |= int(b[1]) << 8
+	}
+	return ss.d.SetRegister(debug.Registers[n], v) == nil
+}
+
+func parseAddrLength(s string) (uint16, int, bool) {
+	a, l, ok := strings.Cut(s, ",")
+	addr, err1 := strconv.ParseUint(a, 16, 16)
+	length, err2 := strconv.ParseUint(l, 16, 32)
+	return uint16(addr), int(length), ok && err1 == nil && err2 == nil
+}
+
+// breakpoint inserts or removes Z0/Z1 breakpoints and Z2-Z4 watchpoints.
+func (ss *session) breakpoint(insert bool, args string) string {
+	parts := strings.Split(args, ",")
+	if len(parts) < 3 {
+		return errorReply(1)
+	}
+	addr, err1 := strconv.ParseUint(parts[1], 16, 16)
+	kind, err2 := strconv.ParseUint(parts[2], 16, 16)
+	if err1 != nil || err2 != nil {
+		return errorReply(1)
+	}
+
+	access := map[string]chip8.Access{
+		"2": chip8.AccessWrite,
+		"3": chip8.AccessRead,
+		"4": chip8.AccessRead | chip8.AccessWrite,
+	}
+	switch {
+	case parts[0] == "0" || parts[0] == "1":
+		if insert {
+			ss.d.AddBreakpoint(uint16(addr))
+		} else {
+			ss.d.RemoveBreakpoint(uint16(addr))
+		}
+	case access[parts[0]] != 0:
+		if insert {
+			to := addr + max(kind, 1) - 1
+			ss.d.Watch(chip8.Watchpoint{From: uint16(addr), To: uint16(min(to, 0xffff)), Access: access[parts[0]]})
+		} else {
+			ss.d.Unwatch(uint16(addr))
+		}
+	default:
+		return ""
+	}
+	return "OK"
+}
+
+func (ss *session) stopReply(reason debug.Reason, err error) string {
+	switch {
+	case err != nil:
+		return fmt.Sprintf("S%02x", sigIll)
+	case reason == debug.ReasonExit:
+		return "W00"
+	case reason == debug.ReasonInterrupt:
+		return fmt.Sprintf("S%02x", sigInt)
+	case reason == debug.ReasonWatchpoint:
+		hit := ss.d.Hits()[0]
+		kind := "watch"
+		switch hit.Access {
+		case chip8.AccessRead:
+			kind = "rwatch"
+			if hit.Watchpoint.Access&chip8.AccessWrite != 0 {
+				kind = "awatch"
+			}
+		case chip8.AccessExecute:
+			return fmt.Sprintf("S%02x", sigTrap)
+		}
+		return fmt.Sprintf("T%02x%s:%x;", sigTrap, kind, hit.Addr)
+	}
+	return fmt.Sprintf("S%02x", sigTrap)
+}
+
+func (ss *session) query(packet string) string {
+	name, args, _ := strings.Cut(packet, ":")
+	switch name {
+	case "qSupported":
+		return "PacketSize=4000;qXfer:features:read+;QStartNoAckMode+"
+	case "QStartNoAckMode":
+		return "OK"
+	case "qAttached":
+		return "1"
+	case "qC":
+		return "QC1"
+	case "qfThreadInfo":
+		return "m1"
+	case "qsThreadInfo":
+		return "l"
+	case "qXfer":
+		// features:read:target.xml:offset,length
+		parts := strings.Split(args, ":")
+		if len(parts) != 4 || parts[0] != "features" || parts[1] != "read" {
+			return ""
+		}
+		if parts[2] != "target.xml" {
+			return errorReply(0)
+		}
+		offset, length, ok := parseAddrLength(parts[3])
+		if !ok {
+			return errorReply(1)
+		}
+		if int(offset) >= len(TargetXML) {
+			return "l"
+		}
+		data := TargetXML[offset:]
+		if len(data) > length {
+			return "m" + data[:length]
+		}
+		return "l" + data
+	}
+	return ""
+}
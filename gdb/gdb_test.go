@@ -0,0 +1,145 @@
+package gdb
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/debuggerpls/go-chip8"
+	"github.com/debuggerpls/go-chip8/debug"
+)
+
+var testROM = []byte{
+	0x60, 0x01, // 0200 LD V0, #01
+	0xa3, 0x00, // 0202 LD I, #300
+	0xf0, 0x55, // 0204 LD [I], V0
+	0x12, 0x06, // 0206 JP #206
+}
+
+// client talks to the stub like gdb does.
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (c *client) send(data string) {
+	fmt.Fprintf(c.conn, "$%s#%02x", data, checksum(data))
+}
+
+func (c *client) receive() string {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		if b != '$' {
+			continue
+		}
+		data, err := c.r.ReadString('#')
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		sum := make([]byte, 2)
+		if _, err := c.r.Read(sum); err != nil {
+			c.t.Fatal(err)
+		}
+		data = data[:len(data)-1]
+		if fmt.Sprintf("%02x", checksum(data)) != string(sum) {
+			c.t.Fatalf("Wrong checksum of %q", data)
+		}
+		c.conn.Write([]byte("+"))
+		return data
+	}
+}
+
+func (c *client) expect(packet, reply string) {
+	c.t.Helper()
+	c.send(packet)
+	if r := c.receive(); r != reply {
+		c.t.Errorf("%s: expected reply %q, actual=%q", packet, reply, r)
+	}
+}
+
+func startServer(t *testing.T) (*client, *debug.Debugger) {
+	e, err := chip8.CreateEmulator(&chip8.GraphicsHeadless{}, &debug.Keys{}, &chip8.AudioNull{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.LoadProgram(testROM)
+	d := debug.CreateDebugger(e)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go CreateServer(d).ServeListener(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &client{t, conn, bufio.NewReader(conn)}, d
+}
+
+func TestSession(t *testing.T) {
+	c, _ := startServer(t)
+
+	c.send("qSupported:multiprocess+;xmlRegisters=i386")
+	if r := c.receive(); !strings.Contains(r, "qXfer:features:read+") {
+		t.Errorf("Features not supported: %q", r)
+	}
+	c.send("qXfer:features:read:target.xml:0,fff")
+	if r := c.receive(); !strings.HasPrefix(r, "l<?xml") || !strings.Contains(r, `<reg name="pc" bitsize="16" type="code_ptr" regnum="17"/>`) {
+		t.Errorf("Wrong target description: %q", r)
+	}
+
+	c.expect("?", "S05")
+	c.expect("p11", "0002")
+	c.expect("s", "S05")
+	c.expect("g", "01"+strings.Repeat("00", 15)+"0000"+"0202"+"000000")
+
+	// registers and memory
+	c.expect("P5=7f", "OK")
+	c.expect("P10=3412", "OK")
+	c.expect("p10", "3412")
+	c.expect("p5", "7f")
+	c.expect("M300,2:abcd", "OK")
+	c.expect("m2fe,4", "0000abcd")
+	c.expect("p16", "E01")
+
+	// a watchpoint stops after the write, the breakpoint in the loop
+	c.expect("Z2,300,1", "OK")
+	c.expect("Z0,206,2", "OK")
+	c.expect("c", "T05watch:300;")
+	c.expect("m300,1", "01")
+	c.expect("p11", "0602")
+	c.expect("c", "S05")
+	c.expect("z0,206,2", "OK")
+	c.expect("z2,300,1", "OK")
+
+	// Ctrl-C interrupts continue
+	c.send("c")
+	time.Sleep(50 * time.Millisecond)
+	c.conn.Write([]byte{0x03})
+	if r := c.receive(); r != "S02" {
+		t.Errorf("Expected interrupt, actual=%q", r)
+	}
+
+	c.expect("D", "OK")
+}
+
+func TestNoAck(t *testing.T) {
+	c, d := startServer(t)
+	c.expect("QStartNoAckMode", "OK")
+	c.expect("P0=42", "OK")
+	if d.Emulator.CPU.V[0] != 0x42 {
+		t.Errorf("Register not written: %02x", d.Emulator.CPU.V[0])
+	}
+}
@@ -0,0 +1,44 @@
+package gdb
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/debuggerpls/go-chip8/debug"
+)
+
+// Register numbers follow debug.Registers: V0-VF are 0-15, then I, PC, SP,
+// DT and ST. I and PC are 16 bit, the others 8 bit, all little endian.
+func registerSize(n int) int {
+	switch debug.Registers[n] {
+	case "I", "PC":
+		return 2
+	}
+	return 1
+}
+
+// TargetXML describes the registers to gdb, it is read with
+// qXfer:features:read:target.xml.
+var TargetXML = targetXML()
+
+func targetXML() string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+  <feature name="org.chip8.cpu">
+`)
+	for n, name := range debug.Registers {
+		typ := "uint8"
+		switch name {
+		case "I":
+			typ = "data_ptr"
+		case "PC":
+			typ = "code_ptr"
+		}
+		fmt.Fprintf(&b, "    <reg name=\"%s\" bitsize=\"%d\" type=\"%s\" regnum=\"%d\"/>\n",
+			strings.ToLower(name), 8*registerSize(n), typ, n)
+	}
+	b.WriteString("  </feature>\n</target>\n")
+	return b.String()
+}
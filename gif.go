@@ -0,0 +1,103 @@
+package chip8
+
+import (
+	"bytes"
+	"errors"
+	"image/gif"
+	"io"
+)
+
+var ErrNotRecording = errors.New("not recording")
+
+// Shortest GIF delay in 1/100s that browsers play at its speed
+const minDelay = 2
+
+// Recorder captures 60 Hz frames for an animated GIF. Identical frames are
+// merged into one with a longer delay, frames shorter than 2/100s into the
+// previous one.
+type Recorder struct {
+	Options ImageOptions
+
+	frames []recordedFrame
+	count  int // number of captured frames
+}
+
+type recordedFrame struct {
+	Framebuffer
+	start, count int // first captured frame and number of repeats
+}
+
+func NewRecorder(o ImageOptions) *Recorder {
+	return &Recorder{Options: o}
+}
+
+// Frame captures the framebuffer as the next frame.
+func (r *Recorder) Frame(f *Framebuffer) {
+	r.count++
+	if n := len(r.frames); n > 0 {
+		last := &r.frames[n-1]
+		if last.Width == f.Width && last.Height == f.Height && bytes.Equal(last.Pixels, f.Pixels) {
+			last.count++
+			return
+		}
+	}
+	frame := recordedFrame{*f, r.count - 1, 1}
+	frame.Pixels = bytes.Clone(f.Pixels)
+	r.frames = append(r.frames, frame)
+}
+
+// Len returns the number of distinct frames.
+func (r *Recorder) Len() int {
+	return len(r.frames)
+}
+
+// Encode writes the frames as GIF that loops forever. Frames of the low
+// resolution are scaled up to the size of the highest resolution recorded.
+func (r *Recorder) Encode(w io.Writer) error {
+	if len(r.frames) == 0 {
+		return errors.New("no frames recorded")
+	}
+	width := 0
+	for _, f := range r.frames {
+		width = max(width, f.Width)
+	}
+
+	g := &gif.GIF{}
+	end := 0 // of the last frame in 1/100s
+	for _, f := range r.frames {
+		// GIF delays are in 1/100s, rounding the end of every frame keeps
+		// the total time exact
+		delay := (f.start+f.count)*100/60 - end
+		end += delay
+		// browsers play delays below minDelay slower, such frames are
+		// merged into the previous one
+		if n := len(g.Delay); n > 0 && (delay < minDelay || g.Delay[n-1] < minDelay) {
+			g.Delay[n-1] += delay
+			continue
+		}
+		o := r.Options
+		o.Scale = max(o.Scale, 1) * width / f.Width
+		img := f.Image(o)
+		g.Image = append(g.Image, img)
+		g.Delay = append(g.Delay, delay)
+		g.Config.Width = max(g.Config.Width, img.Rect.Dx())
+		g.Config.Height = max(g.Config.Height, img.Rect.Dy())
+	}
+	g.Config.ColorModel = g.Image[0].Palette
+	return gif.EncodeAll(w, g)
+}
+
+// StartRecording captures every frame from now on, see Recorder.
+func (e *Emulator) StartRecording(o ImageOptions) {
+	e.Recorder = NewRecorder(o)
+}
+
+// StopRecording writes the frames captured since StartRecording as GIF.
+func (e *Emulator) StopRecording(w io.Writer) error {
+	if e.Recorder == nil {
+		return ErrNotRecording
+	}
+	r := e.Recorder
+	e.Recorder = nil
+	return r.Encode(w)
+}
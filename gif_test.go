@@ -0,0 +1,87 @@
+package chip8
+
+import (
+	"bytes"
+	"image/gif"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	e, err := CreateEmulator(&GraphicsHeadless{}, &InputNull{}, &AudioNull{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.StopRecording(&bytes.Buffer{}); err != ErrNotRecording {
+		t.Errorf("Expected ErrNotRecording, actual=%v", err)
+	}
+	e.LoadProgram([]byte{
+		0x60, 0x05, // 0200 LD V0, #05
+		0xf0, 0x29, // 0202 LD F, V0
+		0xd0, 0x05, // 0204 DRW V0, V0, 5
+		0x00, 0xff, // 0206 HIGH
+		0x12, 0x08, // 0208 JP #208
+	})
+	e.StartRecording(ImageOptions{Scale: 2})
+
+	// every instruction in its own frame, then 6 frames of the same
+	for i := 0; i < 10; i++ {
+		if err := e.Step(true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if e.Recorder.Len() != 3 {
+		t.Errorf("Expected 3 distinct frames, actual=%d", e.Recorder.Len())
+	}
+
+	var b bytes.Buffer
+	if err := e.StopRecording(&b); err != nil {
+		t.Fatal(err)
+	}
+	if e.Recorder != nil {
+		t.Errorf("Still recording")
+	}
+	g, err := gif.DecodeAll(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Image) != 3 || g.Config.Width != 256 || g.Config.Height != 128 {
+		t.Fatalf("Wrong GIF: %d frames of %dx%d", len(g.Image), g.Config.Width, g.Config.Height)
+	}
+	// low resolution frames are scaled to the size of the high resolution
+	if b := g.Image[0].Bounds(); b.Dx() != 256 {
+		t.Errorf("Low resolution frame not scaled, %v", b)
+	}
+	total := 0
+	for _, d := range g.Delay {
+		total += d
+	}
+	if total != 1000/60 || g.Delay[2] < g.Delay[0] {
+		t.Errorf("Wrong delays %v", g.Delay)
+	}
+
+	// frames changing at 60 Hz are merged to delays of at least 2/100s
+	r := NewRecorder(ImageOptions{})
+	frames := [2]*Framebuffer{NewFramebuffer(64, 32), NewFramebuffer(64, 32)}
+	frames[1].Pixels[0] = 1
+	for i := 0; i < 60; i++ {
+		r.Frame(frames[i%2])
+	}
+	b.Reset()
+	if err := r.Encode(&b); err != nil {
+		t.Fatal(err)
+	}
+	if g, err = gif.DecodeAll(&b); err != nil {
+		t.Fatal(err)
+	}
+	total = 0
+	for _, d := range g.Delay {
+		if d < 2 {
+			t.Errorf("Delay below 2 in %v", g.Delay)
+			break
+		}
+		total += d
+	}
+	if total != 100 {
+		t.Errorf("Delays %v add up to %d, expected 100", g.Delay, total)
+	}
+}
@@ -3,11 +3,19 @@ package chip8
 const (
 	DisplayWidth  uint8 = 64
 	DisplayHeigth uint8 = 32
+
+	// SUPER-CHIP high resolution mode
+	HiresWidth  = 128
+	HiresHeight = 64
 )
 
+// Graphics presents the frames of the Display, once per 60 Hz frame in
+// which the display changed.
 type Graphics interface {
 	Init() error
 	Close()
-	Clear()
-	Draw(x, y byte, sprite []byte) (collision byte)
+	// Present shows the complete frame. dirty is the region that changed
+	// since the previous frame, the rest may be left as it is. The frame is
+	// only valid during the call.
+	Present(frame *Framebuffer, dirty Rect)
 }
@@ -0,0 +1,47 @@
+package chip8
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+)
+
+// GraphicsHeadless keeps the last presented frame in memory only, for
+// running programs without a terminal, e.g. in tests and CI.
+type GraphicsHeadless struct {
+	Buffer Framebuffer
+	Frames int // number of presented frames
+}
+
+func (d *GraphicsHeadless) Init() error {
+	d.Buffer = *NewFramebuffer(int(DisplayWidth), int(DisplayHeigth))
+	return nil
+}
+
+func (d *GraphicsHeadless) Close() {
+}
+
+func (d *GraphicsHeadless) Present(frame *Framebuffer, dirty Rect) {
+	if d.Buffer.Width != frame.Width || d.Buffer.Height != frame.Height {
+		d.Buffer.Resize(frame.Width, frame.Height)
+	}
+	copy(d.Buffer.Pixels, frame.Pixels)
+	d.Buffer.Planes = frame.Planes
+	d.Frames++
+}
+
+// Pixels returns the pixels row by row, see Framebuffer.Pixel.
+func (d *GraphicsHeadless) Pixels() []byte {
+	return d.Buffer.Pixels
+}
+
+// Hash returns the FNV-1a hash of the resolution and the pixels, which
+// identifies the content of the display, e.g. for comparing screenshots.
+func (d *GraphicsHeadless) Hash() uint64 {
+	h := fnv.New64a()
+	var size [4]byte
+	binary.BigEndian.PutUint16(size[0:], uint16(d.Buffer.Width))
+	binary.BigEndian.PutUint16(size[2:], uint16(d.Buffer.Height))
+	h.Write(size[:])
+	h.Write(d.Buffer.Pixels)
+	return h.Sum64()
+}
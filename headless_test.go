@@ -0,0 +1,66 @@
+package chip8
+
+import "testing"
+
+func TestGraphicsHeadless(t *testing.T) {
+	d := &GraphicsHeadless{}
+	e, err := CreateEmulator(d, &MockInput{}, &MockAudio{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Present()
+	blank := d.Hash()
+	e.LoadProgram([]byte{
+		0x60, 0x3e, // 0200 LD V0, #3E
+		0xf1, 0x29, // 0202 LD F, V1
+		0xd0, 0x05, // 0204 DRW V0, V0, 5
+		0xd0, 0x05, // 0206 DRW V0, V0, 5
+		0xd0, 0x05, // 0208 DRW V0, V0, 5
+		0x00, 0xff, // 020A HIGH
+	})
+
+	e.Step(false)
+	e.Step(false)
+	e.Step(false)
+	if d.Hash() != blank || d.Frames != 1 {
+		t.Errorf("Frame presented before the delay tick")
+	}
+	e.Present()
+	if e.CPU.V[0xf] != 0 {
+		t.Errorf("Unexpected collision")
+	}
+	// the 0 at x=62 wraps around to the left edge
+	if d.Buffer.Pixel(62, 62%32) == 0 || d.Buffer.Pixel(0, 62%32) == 0 {
+		t.Errorf("Sprite not drawn or not wrapped")
+	}
+	drawn := d.Hash()
+	if drawn == blank || len(d.Pixels()) != 64*32 {
+		t.Errorf("Hash unchanged after drawing")
+	}
+
+	e.Step(false)
+	e.Present()
+	if e.CPU.V[0xf] != 1 || d.Hash() != blank {
+		t.Errorf("Second draw did not collide and erase, VF=%d", e.CPU.V[0xf])
+	}
+
+	e.Step(false)
+	e.Present()
+	if d.Hash() != drawn {
+		t.Errorf("Same content with a different hash")
+	}
+
+	// the hash tells resolutions apart
+	e.Step(false)
+	e.Present()
+	if d.Buffer.Width != HiresWidth || d.Hash() == blank {
+		t.Errorf("Same hash for different resolutions")
+	}
+
+	// nothing to present without changes
+	frames := d.Frames
+	e.Present()
+	if d.Frames != frames {
+		t.Errorf("Unchanged frame presented")
+	}
+}
@@ -0,0 +1,87 @@
+package chip8
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Palette colors the pixels by their XO-CHIP bitplanes, see Framebuffer.Pixel.
+type Palette [1 << PlaneCount]color.RGBA
+
+// DefaultPalette matches the colors of the termbox frontend.
+var DefaultPalette = Palette{
+	{0x00, 0x00, 0x00, 0xff},
+	{0xff, 0xff, 0xff, 0xff},
+	{0xff, 0x00, 0x00, 0xff},
+	{0xff, 0xff, 0x00, 0xff},
+}
+
+// ParsePalette parses up to 4 comma separated hex colors like "000000,ffffff".
+// Missing colors are taken from DefaultPalette.
+func ParsePalette(s string) (Palette, error) {
+	p := DefaultPalette
+	colors := strings.Split(s, ",")
+	if len(colors) > len(p) {
+		return p, fmt.Errorf("palette %q has more than %d colors", s, len(p))
+	}
+	for i, c := range colors {
+		c = strings.TrimPrefix(strings.TrimSpace(c), "#")
+		v, err := strconv.ParseUint(c, 16, 24)
+		if err != nil || len(c) != 6 {
+			return p, fmt.Errorf("invalid color %q, expected RRGGBB", c)
+		}
+		p[i] = color.RGBA{byte(v >> 16), byte(v >> 8), byte(v), 0xff}
+	}
+	return p, nil
+}
+
+// ImageOptions control how a framebuffer is rendered to an image.
+type ImageOptions struct {
+	Scale   int     // size of a pixel in the image, zero value means 1
+	Palette Palette // zero value means DefaultPalette
+	// Grid draws the top and left edge of every pixel in GridColor, if
+	// Scale is at least 2
+	Grid      bool
+	GridColor color.RGBA // zero value means dark gray
+}
+
+// Image renders the framebuffer into a paletted image: the colors of the
+// palette come first, followed by the grid color.
+func (f *Framebuffer) Image(o ImageOptions) *image.Paletted {
+	scale := max(o.Scale, 1)
+	palette := o.Palette
+	if palette == (Palette{}) {
+		palette = DefaultPalette
+	}
+	grid := o.GridColor
+	if grid == (color.RGBA{}) {
+		grid = color.RGBA{0x40, 0x40, 0x40, 0xff}
+	}
+	colors := color.Palette{}
+	for _, c := range palette {
+		colors = append(colors, c)
+	}
+	colors = append(colors, grid)
+
+	img := image.NewPaletted(image.Rect(0, 0, f.Width*scale, f.Height*scale), colors)
+	for y := 0; y < img.Rect.Dy(); y++ {
+		for x := 0; x < img.Rect.Dx(); x++ {
+			i := f.Pixel(x/scale, y/scale)
+			if o.Grid && scale > 1 && (x%scale == 0 || y%scale == 0) {
+				i = byte(len(palette))
+			}
+			img.Pix[y*img.Stride+x] = i
+		}
+	}
+	return img
+}
+
+// Screenshot writes the display as PNG.
+func (e *Emulator) Screenshot(w io.Writer, o ImageOptions) error {
+	return png.Encode(w, e.Display.Image(o))
+}
@@ -0,0 +1,78 @@
+package chip8
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestImage(t *testing.T) {
+	f := NewFramebuffer(8, 4)
+	f.Draw(1, 1, []byte{0x80}, 8, false)
+	f.Planes = 2
+	f.Draw(2, 1, []byte{0x80}, 8, false)
+
+	img := f.Image(ImageOptions{Scale: 3})
+	if b := img.Bounds(); b.Dx() != 24 || b.Dy() != 12 {
+		t.Fatalf("Wrong size %v", b)
+	}
+	for _, data := range []struct {
+		x, y  int
+		color color.Color
+	}{
+		{0, 0, DefaultPalette[0]},
+		{3, 3, DefaultPalette[1]},
+		{5, 5, DefaultPalette[1]},
+		{6, 3, DefaultPalette[2]},
+	} {
+		if c := img.At(data.x, data.y); c != data.color {
+			t.Errorf("%d,%d: expected=%v actual=%v", data.x, data.y, data.color, c)
+		}
+	}
+
+	palette, err := ParsePalette("102030,#ffeedd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grid := color.RGBA{1, 2, 3, 0xff}
+	img = f.Image(ImageOptions{Scale: 3, Palette: palette, Grid: true, GridColor: grid})
+	if c := img.At(3, 3); c != grid {
+		t.Errorf("Expected grid at 3,3, actual=%v", c)
+	}
+	if c := img.At(4, 4); c != (color.RGBA{0xff, 0xee, 0xdd, 0xff}) {
+		t.Errorf("Wrong palette color %v", c)
+	}
+	if c := img.At(7, 4); c != DefaultPalette[2] {
+		t.Errorf("Missing palette color not taken from the default, actual=%v", c)
+	}
+
+	for _, s := range []string{"12345", "gggggg", "0,0,0,0,0"} {
+		if _, err := ParsePalette(s); err == nil {
+			t.Errorf("Expected an error for palette %q", s)
+		}
+	}
+}
+
+func TestScreenshot(t *testing.T) {
+	e, err := CreateEmulator(&GraphicsHeadless{}, &InputNull{}, &AudioNull{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Display.Draw(0, 0, []byte{0x80}, 8, false)
+
+	var b bytes.Buffer
+	if err := e.Screenshot(&b, ImageOptions{Scale: 2}); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 128 || img.Bounds().Dy() != 64 {
+		t.Errorf("Wrong size %v", img.Bounds())
+	}
+	if r, _, _, _ := img.At(1, 1).RGBA(); r != 0xffff {
+		t.Errorf("Pixel not white")
+	}
+}
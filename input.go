@@ -1,7 +1,86 @@
 package chip8
 
+// Number of keys on the hexadecimal keypad (0x0-0xF)
+const KeyCount = 16
+
 type Input interface {
 	Init() error
 	Close()
 	WaitForEvent()
+	// Keys returns the current state of the keypad, bit n is set while key n is held down.
+	Keys() uint16
+}
+
+// InputNull never has a key pressed, e.g. for headless runs.
+type InputNull struct{}
+
+func (k *InputNull) Init() error   { return nil }
+func (k *InputNull) Close()        {}
+func (k *InputNull) WaitForEvent() {}
+func (k *InputNull) Keys() uint16  { return 0 }
+
+// HotkeyInput is implemented by Input with keys for functions of the
+// frontend, e.g. save states. Emulator.Run calls the actions of the hotkeys
+// pressed since the last call between instructions.
+type HotkeyInput interface {
+	PendingHotkeys() []func()
+}
+
+// FrameInput is implemented by Input that follows the frames of
+// Emulator.RunFrame, e.g. movies. EndFrame is called after every frame.
+type FrameInput interface {
+	EndFrame(e *Emulator) error
+}
+
+// RewindInput is implemented by Input with a key that runs time backwards
+// in Emulator.Run while held.
+type RewindInput interface {
+	Rewinding() bool
+}
+
+// Keypad is the 16-key hexadecimal keypad as seen by the CPU. The state is
+// polled from Input before every instruction.
+type Keypad struct {
+	state    uint16 // bit n is set while key n is held down
+	released uint16 // keys that went up since the last wait started
+	waiting  bool   // Fx0A is waiting for a key
+}
+
+// Update sets the current state of the keypad and records key-up edges.
+func (k *Keypad) Update(state uint16) {
+	k.released |= k.state &^ state
+	k.state = state
+}
+
+func (k *Keypad) State() uint16 {
+	return k.state
+}
+
+func (k *Keypad) IsPressed(key byte) bool {
+	return key < KeyCount && (k.state>>key)&1 == 1
+}
+
+// IsReleased reports whether the key went up since the last wait started.
+func (k *Keypad) IsReleased(key byte) bool {
+	return key < KeyCount && (k.released>>key)&1 == 1
+}
+
+// WaitKey implements the Fx0A key wait. The first call starts the wait, every
+// following call reports the first key that was released since then.
+// As on the COSMAC VIP, a key is only accepted once it is released again.
+func (k *Keypad) WaitKey() (key byte, ok bool) {
+	if !k.waiting {
+		k.waiting = true
+		k.released = 0
+		return 0, false
+	}
+
+	for key = 0; key < KeyCount; key++ {
+		if k.IsReleased(key) {
+			k.waiting = false
+			k.released = 0
+			return key, true
+		}
+	}
+	return 0, false
 }
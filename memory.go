@@ -2,7 +2,19 @@ package chip8
 
 import "fmt"
 
-type Memory [4096]byte
+// 64 KiB of memory, classic CHIP-8 programs only use the first 4 KiB.
+const MemorySize = 65536
+
+type Memory [MemorySize]byte
+
+// Bus is how the CPU accesses memory. Memory implements it directly,
+// Watchpoints reports the accesses to watched addresses.
+type Bus interface {
+	Read(addr uint16) byte
+	Write(addr uint16, value byte)
+	// Fetch reads the 2 byte word of an instruction at addr.
+	Fetch(addr uint16) uint16
+}
 
 type ErrOutOfBounds struct {
 	what string
@@ -25,28 +37,69 @@ func (m *Memory) Load(address int, data []byte) error {
 	return nil
 }
 
-func (m *Memory) Init() error {
-	var fontData = [][]byte{
-		{0xF0, 0x90, 0x90, 0x90, 0xF0},
-		{0x20, 0x60, 0x20, 0x20, 0x70},
-		{0xF0, 0x10, 0xF0, 0x80, 0xF0},
-		{0xF0, 0x10, 0xF0, 0x10, 0xF0},
-		{0x90, 0x90, 0xF0, 0x10, 0x10},
-		{0xF0, 0x80, 0xF0, 0x10, 0xF0},
-		{0xF0, 0x80, 0xF0, 0x90, 0xF0},
-		{0xF0, 0x10, 0x20, 0x40, 0x40},
-		{0xF0, 0x90, 0xF0, 0x90, 0xF0},
-		{0xF0, 0x90, 0xF0, 0x10, 0xF0},
-		{0xF0, 0x90, 0xF0, 0x90, 0x90},
-		{0xE0, 0x90, 0xE0, 0x90, 0xE0},
-		{0xF0, 0x80, 0x80, 0x80, 0xF0},
-		{0xE0, 0x90, 0x90, 0x90, 0xE0},
-		{0xF0, 0x80, 0xF0, 0x80, 0xF0},
-		{0xF0, 0x80, 0xF0, 0x80, 0x80},
-	}
+func (m *Memory) Read(addr uint16) byte {
+	return m[addr]
+}
+
+func (m *Memory) Write(addr uint16, value byte) {
+	m[addr] = value
+}
 
+func (m *Memory) Fetch(addr uint16) uint16 {
+	return uint16(m[addr])<<8 | uint16(m[addr+1])
+}
+
+const (
+	// Location of the 5 byte hexadecimal font
+	FontAddress = 0x000
+	// Location of the 10 byte SUPER-CHIP font
+	BigFontAddress = FontAddress + 16*5
+)
+
+var fontData = [][]byte{
+	{0xF0, 0x90, 0x90, 0x90, 0xF0},
+	{0x20, 0x60, 0x20, 0x20, 0x70},
+	{0xF0, 0x10, 0xF0, 0x80, 0xF0},
+	{0xF0, 0x10, 0xF0, 0x10, 0xF0},
+	{0x90, 0x90, 0xF0, 0x10, 0x10},
+	{0xF0, 0x80, 0xF0, 0x10, 0xF0},
+	{0xF0, 0x80, 0xF0, 0x90, 0xF0},
+	{0xF0, 0x10, 0x20, 0x40, 0x40},
+	{0xF0, 0x90, 0xF0, 0x90, 0xF0},
+	{0xF0, 0x90, 0xF0, 0x10, 0xF0},
+	{0xF0, 0x90, 0xF0, 0x90, 0x90},
+	{0xE0, 0x90, 0xE0, 0x90, 0xE0},
+	{0xF0, 0x80, 0x80, 0x80, 0xF0},
+	{0xE0, 0x90, 0x90, 0x90, 0xE0},
+	{0xF0, 0x80, 0xF0, 0x80, 0xF0},
+	{0xF0, 0x80, 0xF0, 0x80, 0x80},
+}
+
+var bigFontData = [][]byte{
+	{0x3C, 0x7E, 0xE7, 0xC3, 0xC3, 0xC3, 0xC3, 0xE7, 0x7E, 0x3C},
+	{0x18, 0x38, 0x58, 0x18, 0x18, 0x18, 0x18, 0x18, 0x18, 0x3C},
+	{0x3E, 0x7F, 0xC3, 0x06, 0x0C, 0x18, 0x30, 0x60, 0xFF, 0xFF},
+	{0x3C, 0x7E, 0xC3, 0x03, 0x0E, 0x0E, 0x03, 0xC3, 0x7E, 0x3C},
+	{0x06, 0x0E, 0x1E, 0x36, 0x66, 0xC6, 0xFF, 0xFF, 0x06, 0x06},
+	{0xFF, 0xFF, 0xC0, 0xC0, 0xFC, 0xFE, 0x03, 0xC3, 0x7E, 0x3C},
+	{0x3E, 0x7C, 0xC0, 0xC0, 0xFC, 0xFE, 0xC3, 0xC3, 0x7E, 0x3C},
+	{0xFF, 0xFF, 0x03, 0x06, 0x0C, 0x18, 0x30, 0x60, 0x60, 0x60},
+	{0x3C, 0x7E, 0xC3, 0xC3, 0x7E, 0x7E, 0xC3, 0xC3, 0x7E, 0x3C},
+	{0x3C, 0x7E, 0xC3, 0xC3, 0x7F, 0x3F, 0x03, 0x03, 0x3E, 0x7C},
+	{0x3C, 0x7E, 0xC3, 0xC3, 0xFF, 0xFF, 0xC3, 0xC3, 0xC3, 0xC3},
+	{0xFC, 0xFE, 0xC3, 0xC3, 0xFE, 0xFE, 0xC3, 0xC3, 0xFE, 0xFC},
+	{0x3C, 0x7E, 0xC3, 0xC0, 0xC0, 0xC0, 0xC0, 0xC3, 0x7E, 0x3C},
+	{0xFC, 0xFE, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xFE, 0xFC},
+	{0xFF, 0xFF, 0xC0, 0xC0, 0xFC, 0xFC, 0xC0, 0xC0, 0xFF, 0xFF},
+	{0xFF, 0xFF, 0xC0, 0xC0, 0xFC, 0xFC, 0xC0, 0xC0, 0xC0, 0xC0},
+}
+
+func (m *Memory) Init() error {
 	for ifont, font := range fontData {
-		m.Load(ifont*len(font), font)
+		m.Load(FontAddress+ifont*len(font), font)
+	}
+	for ifont, font := range bigFontData {
+		m.Load(BigFontAddress+ifont*len(font), font)
 	}
 
 	return nil
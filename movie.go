@@ -0,0 +1,274 @@
+package chip8
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/rand/v2"
+)
+
+// Movies are written as:
+//
+//	magic "CH8M", version uint16
+//	SHA-256 of the program, quirks, seed uint64,
+//	instructions per frame uint16 (since version 2), frame count uint32
+//	frames: keys uint16, state hash uint32
+//	CRC-32 (IEEE) of everything before
+//
+// All numbers are big endian.
+const MovieVersion = 2
+
+const movieMagic = "CH8M"
+
+// ErrMovieEnd is returned by the frame after the last one of a movie.
+var ErrMovieEnd = errors.New("end of movie")
+
+type ErrMovie struct {
+	what string
+}
+
+func (e ErrMovie) Error() string {
+	return fmt.Sprintf("ErrMovie: %s", e.what)
+}
+
+// ErrMovieDesync is returned when the state after a replayed frame differs
+// from the recorded one.
+type ErrMovieDesync int
+
+func (e ErrMovieDesync) Error() string {
+	return fmt.Sprintf("ErrMovieDesync: state differs from the recording after frame %d", int(e))
+}
+
+// Movie is the keypad input of every frame of a run from power-on, with
+// everything needed to replay it bit-exactly.
+type Movie struct {
+	ROMHash [sha256.Size]byte
+	Quirks  Quirks
+	Seed    uint64
+	// InstructionsPerFrame of the recording, version 1 movies always
+	// used DefaultInstructionsPerFrame
+	InstructionsPerFrame int
+	Frames               []MovieFrame
+}
+
+type MovieFrame struct {
+	Keys uint16 // keypad state during the frame
+	Hash uint32 // StateHash after the frame
+}
+
+type movieHeader struct {
+	ROMHash              [sha256.Size]byte
+	Quirks               quirksState
+	Seed                 uint64
+	InstructionsPerFrame uint16
+	Frames               uint32
+}
+
+type movieHeaderV1 struct {
+	ROMHash [sha256.Size]byte
+	Quirks  quirksState
+	Seed    uint64
+	Frames  uint32
+}
+
+func (m *Movie) Write(w io.Writer) error {
+	var b bytes.Buffer
+	b.WriteString(movieMagic)
+	binary.Write(&b, binary.BigEndian, uint16(MovieVersion))
+	q := &m.Quirks
+	binary.Write(&b, binary.BigEndian, &movieHeader{
+		m.ROMHash,
+		quirksState{q.VFReset, q.Shift, byte(q.LoadStore), q.Jump, q.Clip, q.DisplayWait},
+		m.Seed,
+		uint16(m.InstructionsPerFrame),
+		uint32(len(m.Frames)),
+	})
+	binary.Write(&b, binary.BigEndian, m.Frames)
+	binary.Write(&b, binary.BigEndian, crc32.ChecksumIEEE(b.Bytes()))
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func ReadMovie(r io.Reader) (*Movie, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < len(movieMagic)+2+4 || string(data[:len(movieMagic)]) != movieMagic {
+		return nil, ErrMovie{"not a movie"}
+	}
+	body, sum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return nil, ErrMovie{"checksum mismatch"}
+	}
+	version := binary.BigEndian.Uint16(body[len(movieMagic):])
+	if version == 0 || version > MovieVersion {
+		return nil, ErrMovie{fmt.Sprintf("unsupported version %d", version)}
+	}
+
+	br := bytes.NewReader(body[len(movieMagic)+2:])
+	var h movieHeader
+	if version == 1 {
+		var h1 movieHeaderV1
+		err = binary.Read(br, binary.BigEndian, &h1)
+		h = movieHeader{h1.ROMHash, h1.Quirks, h1.Seed, DefaultInstructionsPerFrame, h1.Frames}
+	} else {
+		err = binary.Read(br, binary.BigEndian, &h)
+	}
+	if err != nil {
+		return nil, ErrMovie{"truncated header"}
+	}
+	if uint64(br.Len()) != uint64(h.Frames)*uint64(binary.Size(MovieFrame{})) {
+		return nil, ErrMovie{"wrong number of frames"}
+	}
+	m := &Movie{ROMHash: h.ROMHash, Seed: h.Seed, InstructionsPerFrame: int(h.InstructionsPerFrame), Frames: make([]MovieFrame, h.Frames)}
+	q := h.Quirks
+	m.Quirks = Quirks{q.VFReset, q.Shift, IncrementMode(q.LoadStore), q.Jump, q.Clip, q.DisplayWait}
+	binary.Read(br, binary.BigEndian, m.Frames)
+	return m, nil
+}
+
+// StateHash returns a CRC-32 of the CPU, memory, keypad and display, which
+// tells whether two runs are in the same state.
+func (e *Emulator) StateHash() uint32 {
+	h := crc32.NewIEEE()
+	c := &e.CPU
+	binary.Write(h, binary.BigEndian, &cpuState{c.V, c.I, c.DT, c.ST, c.PC, c.SP, c.Stack, c.Hires, c.Flags, c.Planes, c.Pattern, c.Pitch, e.vblank})
+	h.Write(e.Memory[:])
+	binary.Write(h, binary.BigEndian, &keypadState{e.Keypad.state, e.Keypad.released, e.Keypad.waiting})
+	binary.Write(h, binary.BigEndian, [2]uint16{uint16(e.Display.Width), uint16(e.Display.Height)})
+	h.Write(e.Display.Pixels)
+	return h.Sum32()
+}
+
+// startMovie resets the emulator for a movie and loads the program.
+func (e *Emulator) startMovie(m *Movie, program []byte) error {
+	e.VIP = nil
+	if err := e.Reset(); err != nil {
+		return err
+	}
+	e.Quirks = m.Quirks
+	e.InstructionsPerFrame = m.InstructionsPerFrame
+	e.Timing = nil
+	e.Seed(m.Seed)
+	return e.LoadProgram(program)
+}
+
+// movieInput returns the Input, without the recorder or player of a
+// previous movie.
+func (e *Emulator) movieInput() Input {
+	switch i := e.Input.(type) {
+	case *MovieRecorder:
+		return i.Input
+	case *MoviePlayer:
+		return i.Input
+	}
+	return e.Input
+}
+
+// MovieRecorder is an Input that records the keys of another Input for
+// every frame of Emulator.RunFrame.
+type MovieRecorder struct {
+	Input
+	Movie *Movie
+
+	keys uint16
+}
+
+// RecordMovie resets the emulator, loads the program with a new seed and
+// records the keys of its Input from now on. Movies run
+// InstructionsPerFrame instructions per frame on the CPU, recording with a
+// Timing or on the VIP fails. Loading a state while a movie records or
+// plays fails too, as it would desync the movie.
+func (e *Emulator) RecordMovie(program []byte) (*MovieRecorder, error) {
+	if e.Timing != nil {
+		return nil, ErrMovie{"recording with a Timing is not supported"}
+	}
+	if e.VIP != nil {
+		return nil, ErrMovie{"recording on the VIP is not supported"}
+	}
+	m := &Movie{ROMHash: sha256.Sum256(program), Quirks: e.Quirks, Seed: rand.Uint64(), InstructionsPerFrame: e.InstructionsPerFrame}
+	if m.InstructionsPerFrame <= 0 {
+		m.InstructionsPerFrame = DefaultInstructionsPerFrame
+	}
+	if err := e.startMovie(m, program); err != nil {
+		return nil, err
+	}
+	r := &MovieRecorder{Input: e.movieInput(), Movie: m}
+	e.Input = r
+	return r, nil
+}
+
+func (r *MovieRecorder) Keys() uint16 {
+	r.keys = r.Input.Keys()
+	return r.keys
+}
+
+func (r *MovieRecorder) EndFrame(e *Emulator) error {
+	r.Movie.Frames = append(r.Movie.Frames, MovieFrame{r.keys, e.StateHash()})
+	return nil
+}
+
+// PendingHotkeys passes on the hotkeys of the recorded Input.
+func (r *MovieRecorder) PendingHotkeys() []func() {
+	if h, ok := r.Input.(HotkeyInput); ok {
+		return h.PendingHotkeys()
+	}
+	return nil
+}
+
+// MoviePlayer is an Input that replays the keys of a movie frame by frame
+// and checks that every frame ends in the recorded state. Everything but the
+// keys, e.g. the hotkeys, comes from the replaced Input.
+type MoviePlayer struct {
+	Input
+	Movie *Movie
+	Frame int // next frame
+}
+
+// PlayMovie resets the emulator, loads the program and wraps Input in a
+// MoviePlayer. Fails if the program is not the one of the movie.
+func (e *Emulator) PlayMovie(m *Movie, program []byte) (*MoviePlayer, error) {
+	if sha256.Sum256(program) != m.ROMHash {
+		return nil, ErrMovie{"program differs from the recording"}
+	}
+	if err := e.startMovie(m, program); err != nil {
+		return nil, err
+	}
+	p := &MoviePlayer{Input: e.movieInput(), Movie: m}
+	e.Input = p
+	return p, nil
+}
+
+func (p *MoviePlayer) Keys() uint16 {
+	if p.Frame < len(p.Movie.Frames) {
+		return p.Movie.Frames[p.Frame].Keys
+	}
+	return 0
+}
+
+// PendingHotkeys passes on the hotkeys of the replaced Input.
+func (p *MoviePlayer) PendingHotkeys() []func() {
+	if h, ok := p.Input.(HotkeyInput); ok {
+		return h.PendingHotkeys()
+	}
+	return nil
+}
+
+func (p *MoviePlayer) EndFrame(e *Emulator) error {
+	if p.Frame >= len(p.Movie.Frames) {
+		return ErrMovieEnd
+	}
+	if e.StateHash() != p.Movie.Frames[p.Frame].Hash {
+		return ErrMovieDesync(p.Frame)
+	}
+	p.Frame++
+	if p.Frame == len(p.Movie.Frames) {
+		return ErrMovieEnd
+	}
+	return nil
+}
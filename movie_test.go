@@ -0,0 +1,147 @@
+package chip8
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// MockKeys is an Input with a scripted key state for every call of Keys.
+type MockKeys struct {
+	MockInput
+	script []uint16
+}
+
+func (k *MockKeys) Keys() uint16 {
+	if len(k.script) == 0 {
+		return 0
+	}
+	keys := k.script[0]
+	k.script = k.script[1:]
+	return keys
+}
+
+// MockHotkeys is an Input with pending hotkeys that records Close.
+type MockHotkeys struct {
+	MockInput
+	hotkeys []func()
+	closed  bool
+}
+
+func (k *MockHotkeys) PendingHotkeys() []func() { return k.hotkeys }
+func (k *MockHotkeys) Close()                   { k.closed = true }
+
+var movieROM = []byte{
+	0x00, 0xe0, // 0200 CLS
+	0xc0, 0xff, // 0202 RND V0, #FF
+	0xf1, 0x0a, // 0204 LD V1, K
+	0xf1, 0x29, // 0206 LD F, V1
+	0xd0, 0x05, // 0208 DRW V0, V0, 5
+	0x12, 0x04, // 020A JP #204
+}
+
+func TestMovie(t *testing.T) {
+	e, err := CreateEmulator(&GraphicsHeadless{}, &MockKeys{script: []uint16{0, 1 << 3, 0, 0, 1 << 7, 0, 0}}, &MockAudio{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Quirks = QuirksCOSMAC
+	e.InstructionsPerFrame = 7
+	recorder, err := e.RecordMovie(movieROM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 8; i++ {
+		if err := e.RunFrame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if e.CPU.V[1] != 7 {
+		t.Errorf("Keys not seen by the program\n%s", e.CPU.String())
+	}
+
+	var b bytes.Buffer
+	if err := recorder.Movie.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	movie, err := ReadMovie(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(movie.Frames) != 8 || movie.Frames[1].Keys != 1<<3 || movie.Quirks != QuirksCOSMAC || movie.InstructionsPerFrame != 7 || movie.Seed != recorder.Movie.Seed {
+		t.Fatalf("Movie not restored: %+v", movie)
+	}
+
+	// a replay in another emulator ends in the same state
+	e2, err := CreateEmulator(&GraphicsHeadless{}, &InputNull{}, &MockAudio{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e2.PlayMovie(movie, movieROM); err != nil {
+		t.Fatal(err)
+	}
+	for err == nil {
+		err = e2.RunFrame()
+	}
+	if err != ErrMovieEnd {
+		t.Fatal(err)
+	}
+	if e2.StateHash() != e.StateHash() || e2.CPU != e.CPU {
+		t.Errorf("Replay differs\n%s", e2.CPU.String())
+	}
+
+	// the program and the states have to match
+	if _, err := e2.PlayMovie(movie, movieROM[:10]); err == nil {
+		t.Errorf("Expected an error for a different program")
+	}
+	movie.Frames[4].Keys = 1 << 9
+	e2.PlayMovie(movie, movieROM)
+	err = nil
+	for err == nil {
+		err = e2.RunFrame()
+	}
+	var desync ErrMovieDesync
+	if !errors.As(err, &desync) || desync != 4 {
+		t.Errorf("Expected ErrMovieDesync(4), actual=%v", err)
+	}
+
+	b.Bytes()[10] ^= 1
+	if _, err := ReadMovie(&b); err == nil {
+		t.Errorf("Expected a checksum error")
+	}
+}
+
+func TestMovieInput(t *testing.T) {
+	input := &MockHotkeys{hotkeys: []func(){func() {}}}
+	e, err := CreateEmulator(&GraphicsHeadless{}, input, &MockAudio{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state bytes.Buffer
+	if err := e.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+	recorder, err := e.RecordMovie(movieROM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.LoadState(bytes.NewReader(state.Bytes())); err == nil {
+		t.Errorf("State loaded while recording")
+	}
+
+	// the player keeps the hotkeys and closes the replaced Input
+	player, err := e.PlayMovie(recorder.Movie, movieROM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if player.Input != input || len(player.PendingHotkeys()) != 1 {
+		t.Errorf("Hotkeys of the Input lost in the replay")
+	}
+	if err := e.LoadState(bytes.NewReader(state.Bytes())); err == nil {
+		t.Errorf("State loaded while replaying")
+	}
+	e.Close()
+	if !input.closed {
+		t.Errorf("Input not closed")
+	}
+}
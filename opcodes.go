@@ -1,33 +1,17 @@
 package chip8
 
-// TODO: failing opcodes
-// AX
-// F5
-// F3
-// 1XX
-// spacing wrong
-
-// fixed:
-// F55
-// F3
-// F65
-// 1NNN
-//
-// left:
-// ANNN
-// 00EE?
-// 2NNN?
-// BNNN?
-// collision not working properly
-// Framed2 seems to not work lines
-// Framed1 seems to be too long?
-// Check against chip8 implementation from others
+// Conformance of the opcodes is tested by the ROMs of conformance/testdata,
+// chip8 conformance prints which opcodes pass.
 
 import (
+	"errors"
 	"fmt"
-	"math/rand"
+	"math/bits"
 )
 
+// ErrExit is returned when the program exits with 00FD.
+var ErrExit = errors.New("program exited")
+
 type ErrUnknownOpcode uint16
 
 func (e ErrUnknownOpcode) Error() string {
@@ -80,24 +64,54 @@ func OpKK(op uint16) uint16 {
 	return op & 0xff
 }
 
-func OpNr0(op uint16, r *CPU, m *Memory, d Graphics) error {
+func OpNr0(op uint16, r *CPU, m Bus, d *Display) error {
 	if OpNr(op) != 0 {
 		return &OpError{"Wrong OpNr", op, r}
 	}
 
-	switch o := op & 0xff; o {
+	switch o := op & 0xff; {
+	// 00Cn - SCD nibble
+	// Scroll the display down by n pixels.
+	case o&0xf0 == 0xc0:
+		d.Scroll(0, int(OpN(op)))
+	// 00Dn - SCU nibble
+	// Scroll the display up by n pixels.
+	case o&0xf0 == 0xd0:
+		d.Scroll(0, -int(OpN(op)))
 	// 00E0 - CLS
 	// Clear the display.
-	case 0xe0:
+	case o == 0xe0:
 		d.Clear()
 	// 00EE - RET
 	// Return from a subroutine.
-	case 0xee:
+	case o == 0xee:
 		if r.SP == 0 {
 			return &OpError{"SP=0, cannot return from subroutine", op, r}
 		}
-		r.PC = r.Stack[r.SP]
 		r.SP--
+		r.PC = r.Stack[r.SP]
+	// 00FB - SCR
+	// Scroll the display right by 4 pixels.
+	case o == 0xfb:
+		d.Scroll(4, 0)
+	// 00FC - SCL
+	// Scroll the display left by 4 pixels.
+	case o == 0xfc:
+		d.Scroll(-4, 0)
+	// 00FD - EXIT
+	// Exit the interpreter.
+	case o == 0xfd:
+		return ErrExit
+	// 00FE - LOW
+	// Switch to the 64x32 low resolution mode.
+	case o == 0xfe:
+		r.Hires = false
+		d.Resize(int(DisplayWidth), int(DisplayHeigth))
+	// 00FF - HIGH
+	// Switch to the 128x64 high resolution mode.
+	case o == 0xff:
+		r.Hires = true
+		d.Resize(HiresWidth, HiresHeight)
 	}
 	// By default it is ignored in modern interpreters
 	// 0nnn - SYS addr
@@ -108,7 +122,7 @@ func OpNr0(op uint16, r *CPU, m *Memory, d Graphics) error {
 
 // 1nnn - JP addr
 // Jump to location nnn.
-func OpNr1(op uint16, r *CPU, m *Memory) error {
+func OpNr1(op uint16, r *CPU, m Bus) error {
 	if OpNr(op) != 1 {
 		return &OpError{"Wrong OpNr", op, r}
 	}
@@ -119,20 +133,23 @@ func OpNr1(op uint16, r *CPU, m *Memory) error {
 
 // 2nnn - CALL addr
 // Call subroutine at nnn.
-func OpNr2(op uint16, r *CPU, m *Memory) error {
+func OpNr2(op uint16, r *CPU, m Bus) error {
 	if OpNr(op) != 2 {
 		return &OpError{"Wrong OpNr", op, r}
 	}
 
-	r.SP++
+	if int(r.SP) >= len(r.Stack) {
+		return &OpError{"stack overflow, cannot call subroutine", op, r}
+	}
 	r.Stack[r.SP] = r.PC
+	r.SP++
 	r.PC = OpNNN(op)
 	return nil
 }
 
 // 3xkk - SE Vx, byte
 // Skip next instruction if Vx = kk.
-func OpNr3(op uint16, r *CPU, m *Memory) error {
+func OpNr3(op uint16, r *CPU, m Bus) error {
 	if OpNr(op) != 3 {
 		return &OpError{"Wrong OpNr", op, r}
 	}
@@ -140,14 +157,14 @@ func OpNr3(op uint16, r *CPU, m *Memory) error {
 	x := OpX(op)
 	kk := byte(OpKK(op))
 	if r.V[x] == kk {
-		r.PC += 2
+		skip(r, m)
 	}
 	return nil
 }
 
 // 4xkk - SNE Vx, byte
 // Skip next instruction if Vx != kk.
-func OpNr4(op uint16, r *CPU, m *Memory) error {
+func OpNr4(op uint16, r *CPU, m Bus) error {
 	if OpNr(op) != 4 {
 		return &OpError{"Wrong OpNr", op, r}
 	}
@@ -155,29 +172,62 @@ func OpNr4(op uint16, r *CPU, m *Memory) error {
 	x := OpX(op)
 	kk := byte(OpKK(op))
 	if r.V[x] != kk {
-		r.PC += 2
+		skip(r, m)
 	}
 	return nil
 }
 
-// 5xy0 - SE Vx, Vy
-// Skip next instruction if Vx = Vy.
-func OpNr5(op uint16, r *CPU, m *Memory) error {
+func OpNr5(op uint16, r *CPU, m Bus) error {
 	if OpNr(op) != 5 {
 		return &OpError{"Wrong OpNr", op, r}
 	}
 
 	x := OpX(op)
 	y := OpY(op)
-	if r.V[x] == r.V[y] {
-		r.PC += 2
+	switch n := OpN(op); n {
+	// 5xy0 - SE Vx, Vy
+	// Skip next instruction if Vx = Vy.
+	case 0:
+		if r.V[x] == r.V[y] {
+			skip(r, m)
+		}
+	// 5xy2 - LD [I], Vx-Vy
+	// Store registers Vx through Vy in memory starting at location I, I is unchanged.
+	case 2:
+		for j, v := range registerRange(x, y) {
+			m.Write(r.I+uint16(j), r.V[v])
+		}
+	// 5xy3 - LD Vx-Vy, [I]
+	// Read registers Vx through Vy from memory starting at location I, I is unchanged.
+	case 3:
+		for j, v := range registerRange(x, y) {
+			r.V[v] = m.Read(r.I + uint16(j))
+		}
+	default:
+		return ErrUnknownOpcode(op)
 	}
 	return nil
 }
 
+// Registers x through y, in reverse order if x > y
+func registerRange(x, y uint16) []uint16 {
+	var regs []uint16
+	for v := int(x); ; {
+		regs = append(regs, uint16(v))
+		if v == int(y) {
+			return regs
+		}
+		if x < y {
+			v++
+		} else {
+			v--
+		}
+	}
+}
+
 // 6xkk - LD Vx, byte
 // Set Vx = kk.
-func OpNr6(op uint16, r *CPU, m *Memory) error {
+func OpNr6(op uint16, r *CPU, m Bus) error {
 	if OpNr(op) != 6 {
 		return &OpError{"Wrong OpNr", op, r}
 	}
@@ -190,7 +240,7 @@ func OpNr6(op uint16, r *CPU, m *Memory) error {
 
 // 7xkk - ADD Vx, byte
 // Set Vx = Vx + kk.
-func OpNr7(op uint16, r *CPU, m *Memory) error {
+func OpNr7(op uint16, r *CPU, m Bus) error {
 	if OpNr(op) != 7 {
 		return &OpError{"Wrong OpNr", op, r}
 	}
@@ -201,7 +251,7 @@ func OpNr7(op uint16, r *CPU, m *Memory) error {
 	return nil
 }
 
-func OpNr8(op uint16, r *CPU, m *Memory) error {
+func OpNr8(op uint16, r *CPU, m Bus, q *Quirks) error {
 	if OpNr(op) != 8 {
 		return &OpError{"Wrong OpNr", op, r}
 	}
@@ -209,79 +259,84 @@ func OpNr8(op uint16, r *CPU, m *Memory) error {
 	x := OpX(op)
 	y := OpY(op)
 
+	// VF is always written last, so it holds the flag even if x is F
+	var flag byte
 	switch n := OpN(op); n {
 	// 8xy0 - LD Vx, Vy
 	// Set Vx = Vy.
 	case 0:
 		r.V[x] = r.V[y]
+		return nil
 	// 8xy1 - OR Vx, Vy
 	// Set Vx = Vx OR Vy.
 	case 1:
 		r.V[x] = r.V[x] | r.V[y]
+		if !q.VFReset {
+			return nil
+		}
 	// 8xy2 - AND Vx, Vy
 	// Set Vx = Vx AND Vy.
 	case 2:
 		r.V[x] = r.V[x] & r.V[y]
+		if !q.VFReset {
+			return nil
+		}
 	// 8xy3 - XOR Vx, Vy
 	// Set Vx = Vx XOR Vy.
 	case 3:
 		r.V[x] = r.V[x] ^ r.V[y]
+		if !q.VFReset {
+			return nil
+		}
 	// 8xy4 - ADD Vx, Vy
 	// Set Vx = Vx + Vy, set VF = carry.
 	case 4:
 		var sum int = int(r.V[x]) + int(r.V[y])
 		if sum > 255 {
-			r.V[0xf] = 1
-		} else {
-			r.V[0xf] = 0
+			flag = 1
 		}
 		r.V[x] = byte(sum & 0xff)
 	// 8xy5 - SUB Vx, Vy
 	// Set Vx = Vx - Vy, set VF = NOT borrow.
 	case 5:
-		if r.V[x] > r.V[y] {
-			r.V[0xf] = 1
-		} else {
-			r.V[0xf] = 0
+		if r.V[x] >= r.V[y] {
+			flag = 1
 		}
 		r.V[x] = r.V[x] - r.V[y]
 	// 8xy6 - SHR Vx {, Vy}
-	//Set Vx = Vx SHR 1.
+	// Set Vx = Vx SHR 1.
 	case 6:
-		if r.V[x]&1 == 1 {
-			r.V[0xf] = 1
-		} else {
-			r.V[0xf] = 0
+		if !q.Shift {
+			r.V[x] = r.V[y]
 		}
+		flag = r.V[x] & 1
 		r.V[x] = r.V[x] / 2
 	// 8xy7 - SUBN Vx, Vy
 	// Set Vx = Vy - Vx, set VF = NOT borrow.
 	case 7:
-		if r.V[y] > r.V[x] {
-			r.V[0xf] = 1
-		} else {
-			r.V[0xf] = 0
+		if r.V[y] >= r.V[x] {
+			flag = 1
 		}
 		r.V[x] = r.V[y] - r.V[x]
 	// 8xyE - SHL Vx {, Vy}
 	// Set Vx = Vx SHL 1.
 	case 0xe:
-		if (r.V[x]>>7)&1 == 1 {
-			r.V[0xf] = 1
-		} else {
-			r.V[0xf] = 0
+		if !q.Shift {
+			r.V[x] = r.V[y]
 		}
+		flag = (r.V[x] >> 7) & 1
 		r.V[x] = r.V[x] * 2
 	default:
 		return ErrUnknownOpcode(op)
 	}
 
+	r.V[0xf] = flag
 	return nil
 }
 
 // 9xy0 - SNE Vx, Vy
 // Skip next instruction if Vx != Vy.
-func OpNr9(op uint16, r *CPU, m *Memory) error {
+func OpNr9(op uint16, r *CPU, m Bus) error {
 	if OpNr(op) != 9 {
 		return &OpError{"Wrong OpNr", op, r}
 	}
@@ -289,14 +344,14 @@ func OpNr9(op uint16, r *CPU, m *Memory) error {
 	x := OpX(op)
 	y := OpY(op)
 	if r.V[x] != r.V[y] {
-		r.PC += 2
+		skip(r, m)
 	}
 	return nil
 }
 
 // Annn - LD I, addr
 // Set I = nnn.
-func OpNrA(op uint16, r *CPU, m *Memory) error {
+func OpNrA(op uint16, r *CPU, m Bus) error {
 	if OpNr(op) != 0xa {
 		return &OpError{"Wrong OpNr", op, r}
 	}
@@ -307,31 +362,40 @@ func OpNrA(op uint16, r *CPU, m *Memory) error {
 
 // Bnnn - JP V0, addr
 // Jump to location nnn + V0.
-func OpNrB(op uint16, r *CPU, m *Memory) error {
+// With the jump quirk: Bxnn - JP Vx, addr, jump to location xnn + Vx.
+func OpNrB(op uint16, r *CPU, m Bus, q *Quirks) error {
 	if OpNr(op) != 0xb {
 		return &OpError{"Wrong OpNr", op, r}
 	}
 
-	r.PC = OpNNN(op) + uint16(r.V[0])
+	if q.Jump {
+		r.PC = OpNNN(op) + uint16(r.V[OpX(op)])
+	} else {
+		r.PC = OpNNN(op) + uint16(r.V[0])
+	}
 	return nil
 }
 
 // Cxkk - RND Vx, byte
 // Set Vx = random byte AND kk.
-func OpNrC(op uint16, r *CPU, m *Memory) error {
+func OpNrC(op uint16, r *CPU, m Bus, rng RNG) error {
 	if OpNr(op) != 0xc {
 		return &OpError{"Wrong OpNr", op, r}
 	}
 
 	x := OpX(op)
 	kk := byte(OpKK(op))
-	r.V[x] = byte(rand.Intn(256)) & kk
+	r.V[x] = rng.Byte(m) & kk
 	return nil
 }
 
 // Dxyn - DRW Vx, Vy, nibble
 // Display n-byte sprite starting at memory location I at (Vx, Vy), set VF = collision.
-func OpNrD(op uint16, r *CPU, m *Memory, d Graphics) error {
+// Dxy0 - DRW Vx, Vy, 0
+// Display 16x16 sprite (32 bytes) starting at memory location I at (Vx, Vy).
+// In high resolution mode VF is set to the number of rows with collision.
+// With several bitplanes selected, the sprite of each plane follows the previous one.
+func OpNrD(op uint16, r *CPU, m Bus, d *Display, q *Quirks) error {
 	if OpNr(op) != 0xd {
 		return &OpError{"Wrong OpNr", op, r}
 	}
@@ -339,34 +403,83 @@ func OpNrD(op uint16, r *CPU, m *Memory, d Graphics) error {
 	x := OpX(op)
 	y := OpY(op)
 	n := OpN(op)
-	r.V[0xf] = d.Draw(r.V[x], r.V[y], m[r.I:r.I+n])
+	width := 8
+	if n == 0 {
+		width = 16
+		n = 32
+	}
+	// the sprite data of every selected plane follows each other
+	n *= uint16(bits.OnesCount8(r.Planes))
+	if int(r.I)+int(n) > MemorySize {
+		return &OpError{"sprite out of memory bounds", op, r}
+	}
+	sprite := make([]byte, n)
+	for j := range sprite {
+		sprite[j] = m.Read(r.I + uint16(j))
+	}
+
+	collision := byte(d.Draw(int(r.V[x]), int(r.V[y]), sprite, width, q.Clip))
+	if !r.Hires && collision > 1 {
+		collision = 1
+	}
+	r.V[0xf] = collision
 	return nil
 }
 
-func OpNrE(op uint16, r *CPU, m *Memory) error {
+func OpNrE(op uint16, r *CPU, m Bus, k *Keypad) error {
 	if OpNr(op) != 0xe {
 		return &OpError{"Wrong OpNr", op, r}
 	}
 
-	return ErrOpcodeNotImplemented(op)
-
+	x := OpX(op)
+	switch o := op & 0xff; o {
 	// Ex9E - SKP Vx
 	// Skip next instruction if key with the value of Vx is pressed.
-
+	case 0x9e:
+		if k.IsPressed(r.V[x] & 0xf) {
+			skip(r, m)
+		}
 	// ExA1 - SKNP Vx
 	// Skip next instruction if key with the value of Vx is not pressed.
-
-	// TODO: implement
-	//return nil
+	case 0xa1:
+		if !k.IsPressed(r.V[x] & 0xf) {
+			skip(r, m)
+		}
+	default:
+		return ErrUnknownOpcode(op)
+	}
+	return nil
 }
 
-func OpNrF(op uint16, r *CPU, m *Memory) error {
+func OpNrF(op uint16, r *CPU, m Bus, d *Display, k *Keypad, q *Quirks) error {
 	if OpNr(op) != 0xf {
 		return &OpError{"Wrong OpNr", op, r}
 	}
 
 	x := OpX(op)
 	switch o := op & 0xff; o {
+	// F000 nnnn - LD I, long addr
+	// Set I = nnnn, the 16-bit address following the instruction.
+	case 0x00:
+		if x != 0 {
+			return ErrUnknownOpcode(op)
+		}
+		r.I = m.Fetch(r.PC + 2)
+		r.PC += 2
+	// Fn01 - PLANE n
+	// Select the bitplanes n for drawing, clearing and scrolling.
+	case 0x01:
+		r.Planes = byte(x) & 0x3
+		d.Planes = r.Planes
+	// F002 - AUDIO
+	// Load the 16-byte audio pattern buffer from memory starting at location I.
+	case 0x02:
+		if x != 0 {
+			return ErrUnknownOpcode(op)
+		}
+		for j := range r.Pattern {
+			r.Pattern[j] = m.Read(r.I + uint16(j))
+		}
 	// Fx07 - LD Vx, DT
 	// Set Vx = delay timer value.
 	case 0x07:
@@ -374,9 +487,13 @@ func OpNrF(op uint16, r *CPU, m *Memory) error {
 	// Fx0A - LD Vx, K
 	// Wait for a key press, store the value of the key in Vx.
 	case 0x0a:
-		// TODO: implement
-		// TODO: stop all execution here
-		return ErrOpcodeNotImplemented(op)
+		key, ok := k.WaitKey()
+		if !ok {
+			// execute this instruction again until a key is released
+			r.PC -= 2
+			return nil
+		}
+		r.V[x] = key
 	// Fx15 - LD DT, Vx
 	// Set delay timer = Vx.
 	case 0x15:
@@ -393,31 +510,68 @@ func OpNrF(op uint16, r *CPU, m *Memory) error {
 	// Set I = location of sprite for digit Vx.
 	case 0x29:
 		// each hex sprite is 5 bytes long
-		r.I = uint16(r.V[x]) * 5
+		r.I = FontAddress + uint16(r.V[x]&0xf)*5
+	// Fx30 - LD HF, Vx
+	// Set I = location of 10-byte sprite for digit Vx.
+	case 0x30:
+		r.I = BigFontAddress + uint16(r.V[x]&0xf)*10
 	// Fx33 - LD B, Vx
 	// Store BCD representation of Vx in memory locations I, I+1, and I+2.
 	case 0x33:
 		i := r.I
 		vx := r.V[x]
-		m[i+2] = vx % 10
-		m[i+1] = ((vx - m[i+2]) % 100) / 10
-		m[i] = (vx - m[i+1] - m[i+2]) / 100
+		m.Write(i, vx/100)
+		m.Write(i+1, vx/10%10)
+		m.Write(i+2, vx%10)
+	// Fx3A - PITCH Vx
+	// Set the audio pattern playback pitch = Vx.
+	case 0x3a:
+		r.Pitch = r.V[x]
 	// Fx55 - LD [I], Vx
 	// Store registers V0 through Vx in memory starting at location I.
 	case 0x55:
 		i := r.I
 		for j := uint16(0); j <= x; j++ {
-			m[i+j] = r.V[j]
+			m.Write(i+j, r.V[j])
 		}
+		r.I += loadStoreIncrement(x, q)
 	// Fx65 - LD Vx, [I]
 	// Read registers V0 through Vx from memory starting at location I.
 	case 0x65:
 		i := r.I
 		for j := uint16(0); j <= x; j++ {
-			r.V[j] = m[i+j]
+			r.V[j] = m.Read(i + j)
 		}
+		r.I += loadStoreIncrement(x, q)
+	// Fx75 - LD R, Vx
+	// Store V0 through Vx in the RPL user flags.
+	case 0x75:
+		copy(r.Flags[:x+1], r.V[:x+1])
+	// Fx85 - LD Vx, R
+	// Read V0 through Vx from the RPL user flags.
+	case 0x85:
+		copy(r.V[:x+1], r.Flags[:x+1])
 	default:
 		return ErrUnknownOpcode(op)
 	}
 	return nil
 }
+
+// Skip the next instruction, F000 nnnn is 4 bytes long
+func skip(r *CPU, m Bus) {
+	r.PC += 2
+	if r.fetch(m) == 0xf000 {
+		r.PC += 2
+	}
+}
+
+// How much Fx55 and Fx65 increase I
+func loadStoreIncrement(x uint16, q *Quirks) uint16 {
+	switch q.LoadStore {
+	case IncrementX:
+		return x
+	case IncrementX1:
+		return x + 1
+	}
+	return 0
+}
@@ -0,0 +1,29 @@
+package chip8
+
+import "time"
+
+// Periods a pacer catches up with before it starts over
+const maxLag = 4
+
+// pacer keeps a loop at a fixed period. It waits for deadlines instead of
+// fixed durations, so a late frame is made up by the next ones and the rate
+// does not drift. After falling more than maxLag periods behind, e.g. when
+// the host was suspended, it starts over instead of running a burst.
+type pacer struct {
+	period time.Duration
+	next   time.Time
+	now    func() time.Time
+	sleep  func(time.Duration)
+}
+
+// wait sleeps until the next period starts.
+func (p *pacer) wait() {
+	now := p.now()
+	if p.next.IsZero() || now.Sub(p.next) > maxLag*p.period {
+		p.next = now
+	}
+	if d := p.next.Sub(now); d > 0 {
+		p.sleep(d)
+	}
+	p.next = p.next.Add(p.period)
+}
@@ -0,0 +1,250 @@
+package chip8
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+const (
+	DefaultSampleRate = 44100
+	DefaultFrequency  = 440.0
+	DefaultVolume     = 8192
+)
+
+// SquareWave generates a square wave tone as signed 16-bit mono PCM samples.
+type SquareWave struct {
+	SampleRate int     // samples per second, DefaultSampleRate if 0
+	Frequency  float64 // tone frequency in Hz, DefaultFrequency if 0
+	Volume     int16   // amplitude, DefaultVolume if 0
+
+	phase float64 // position in the current period [0, 1)
+}
+
+func (w *SquareWave) init() {
+	if w.SampleRate == 0 {
+		w.SampleRate = DefaultSampleRate
+	}
+	if w.Frequency == 0 {
+		w.Frequency = DefaultFrequency
+	}
+	if w.Volume == 0 {
+		w.Volume = DefaultVolume
+	}
+}
+
+// Generate fills buf with the tone, or with silence if on is false. The phase
+// is kept between calls so consecutive buffers join without clicks, and
+// every tone starts at the beginning of a period.
+func (w *SquareWave) Generate(buf []int16, on bool) {
+	w.init()
+	if !on {
+		clear(buf)
+		w.phase = 0
+		return
+	}
+
+	step := w.Frequency / float64(w.SampleRate)
+	for i := range buf {
+		if w.phase < 0.5 {
+			buf[i] = w.Volume
+		} else {
+			buf[i] = -w.Volume
+		}
+		w.phase += step
+		if w.phase >= 1 {
+			w.phase -= 1
+		}
+	}
+}
+
+// PatternWave generates signed 16-bit mono PCM samples from an XO-CHIP audio
+// pattern, every bit of the pattern is either the high or the low level.
+type PatternWave struct {
+	SampleRate int   // samples per second, DefaultSampleRate if 0
+	Volume     int16 // amplitude, DefaultVolume if 0
+	Pattern    [16]byte
+	Pitch      byte
+
+	pos float64 // position in the pattern in bits [0, 128)
+}
+
+// Rate returns the number of pattern bits played per second.
+func (w *PatternWave) Rate() float64 {
+	return 4000 * math.Pow(2, (float64(w.Pitch)-DefaultPitch)/48)
+}
+
+// Generate fills buf with the pattern, or with silence if on is false.
+func (w *PatternWave) Generate(buf []int16, on bool) {
+	if w.SampleRate == 0 {
+		w.SampleRate = DefaultSampleRate
+	}
+	if w.Volume == 0 {
+		w.Volume = DefaultVolume
+	}
+	if !on {
+		clear(buf)
+		w.pos = 0
+		return
+	}
+
+	step := w.Rate() / float64(w.SampleRate)
+	for i := range buf {
+		bit := int(w.pos)
+		if (w.Pattern[bit/8]>>(7-bit%8))&1 == 1 {
+			buf[i] = w.Volume
+		} else {
+			buf[i] = -w.Volume
+		}
+		w.pos += step
+		for w.pos >= 128 {
+			w.pos -= 128
+		}
+	}
+}
+
+// AudioPCM writes the beeper as raw signed 16-bit little-endian mono PCM to W.
+// Write errors stop the output and are reported by Err.
+type AudioPCM struct {
+	W    io.Writer
+	Wave SquareWave
+
+	pattern *PatternWave // replaces Wave once the program sets a pattern
+	on      bool
+	buf     []int16
+	samples int // remainder of SampleRate/60 carried to the next tick
+	written int64
+	err     error
+}
+
+func (a *AudioPCM) Init() error {
+	a.Wave.init()
+	return nil
+}
+
+func (a *AudioPCM) Close() {}
+
+func (a *AudioPCM) Start() {
+	a.on = true
+}
+
+func (a *AudioPCM) Stop() {
+	a.on = false
+}
+
+func (a *AudioPCM) Tick() {
+	if a.err != nil {
+		return
+	}
+
+	// keep the exact sample rate even if it is not divisible by 60
+	a.samples += a.Wave.SampleRate
+	n := a.samples / 60
+	a.samples %= 60
+
+	if cap(a.buf) < n {
+		a.buf = make([]int16, n)
+	}
+	a.buf = a.buf[:n]
+	if a.pattern != nil {
+		a.pattern.Generate(a.buf, a.on)
+	} else {
+		a.Wave.Generate(a.buf, a.on)
+	}
+	if a.err = binary.Write(a.W, binary.LittleEndian, a.buf); a.err == nil {
+		a.written += int64(2 * n)
+	}
+}
+
+func (a *AudioPCM) SetPattern(pattern [16]byte, pitch byte) {
+	if a.pattern == nil {
+		a.pattern = &PatternWave{SampleRate: a.Wave.SampleRate, Volume: a.Wave.Volume}
+	}
+	a.pattern.Pattern = pattern
+	a.pattern.Pitch = pitch
+}
+
+// Err returns the first error that occurred while writing.
+func (a *AudioPCM) Err() error {
+	return a.err
+}
+
+// AudioWAV writes the beeper as a 16-bit mono WAV file to W. The sizes in the
+// header are filled in on Close if W is an io.WriteSeeker, otherwise they are
+// left at the maximum as usual for streamed WAV data.
+type AudioWAV struct {
+	W    io.Writer
+	Wave SquareWave
+
+	pcm AudioPCM
+}
+
+const wavHeaderSize = 44
+
+func (a *AudioWAV) Init() error {
+	a.pcm = AudioPCM{W: a.W, Wave: a.Wave}
+	if err := a.pcm.Init(); err != nil {
+		return err
+	}
+	a.pcm.err = a.writeHeader(0xffffffff)
+	return a.pcm.err
+}
+
+func (a *AudioWAV) writeHeader(dataSize uint32) error {
+	rate := uint32(a.pcm.Wave.SampleRate)
+	riffSize := dataSize
+	if dataSize != 0xffffffff {
+		riffSize = dataSize + wavHeaderSize - 8
+	}
+
+	header := []any{
+		[4]byte{'R', 'I', 'F', 'F'},
+		riffSize,
+		[4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '},
+		uint32(16), // fmt chunk size
+		uint16(1),  // PCM
+		uint16(1),  // mono
+		rate,       // sample rate
+		rate * 2,   // byte rate
+		uint16(2),  // block align
+		uint16(16), // bits per sample
+		[4]byte{'d', 'a', 't', 'a'},
+		dataSize,
+	}
+	for _, v := range header {
+		if err := binary.Write(a.W, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *AudioWAV) Close() {
+	ws, ok := a.W.(io.WriteSeeker)
+	if !ok || a.pcm.err != nil {
+		return
+	}
+	if _, err := ws.Seek(0, io.SeekStart); err != nil {
+		a.pcm.err = err
+		return
+	}
+	if err := a.writeHeader(uint32(a.pcm.written)); err != nil {
+		a.pcm.err = err
+		return
+	}
+	_, a.pcm.err = ws.Seek(0, io.SeekEnd)
+}
+
+func (a *AudioWAV) Start() { a.pcm.Start() }
+func (a *AudioWAV) Stop()  { a.pcm.Stop() }
+func (a *AudioWAV) Tick()  { a.pcm.Tick() }
+
+func (a *AudioWAV) SetPattern(pattern [16]byte, pitch byte) {
+	a.pcm.SetPattern(pattern, pitch)
+}
+
+// Err returns the first error that occurred while writing.
+func (a *AudioWAV) Err() error {
+	return a.pcm.err
+}
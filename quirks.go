@@ -0,0 +1,68 @@
+package chip8
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// IncrementMode is how Fx55 and Fx65 change I.
+type IncrementMode byte
+
+const (
+	IncrementNone IncrementMode = iota // I is left unchanged
+	IncrementX                         // I = I + x
+	IncrementX1                        // I = I + x + 1
+)
+
+// Quirks select between the behaviors of the different CHIP-8 platforms for
+// opcodes that were implemented differently over time.
+type Quirks struct {
+	VFReset     bool          // 8xy1, 8xy2, 8xy3 reset VF to 0
+	Shift       bool          // 8xy6, 8xyE shift Vx in place, instead of Vx = Vy shifted
+	LoadStore   IncrementMode // how Fx55, Fx65 change I
+	Jump        bool          // Bnnn jumps to xnn + Vx, instead of nnn + V0
+	Clip        bool          // sprites are clipped at the display edges, instead of wrapping around
+	DisplayWait bool          // Dxyn waits for the next frame (vertical blank) before drawing
+}
+
+var (
+	// Original interpreter of the COSMAC VIP
+	QuirksCOSMAC = Quirks{VFReset: true, LoadStore: IncrementX1, Clip: true, DisplayWait: true}
+	// CHIP-48 of the HP-48 calculators
+	QuirksCHIP48 = Quirks{Shift: true, LoadStore: IncrementX, Jump: true, Clip: true}
+	// SUPER-CHIP 1.1
+	QuirksSCHIP = Quirks{Shift: true, LoadStore: IncrementNone, Jump: true, Clip: true}
+	// XO-CHIP as implemented by Octo
+	QuirksXOCHIP = Quirks{LoadStore: IncrementX1}
+	// Behavior described by Cowgod's technical reference, used by most modern interpreters
+	QuirksModern = Quirks{Shift: true, LoadStore: IncrementNone}
+)
+
+// Named quirks presets, selectable by QuirksByName
+var QuirksPresets = map[string]Quirks{
+	"cosmac": QuirksCOSMAC,
+	"chip48": QuirksCHIP48,
+	"schip":  QuirksSCHIP,
+	"xochip": QuirksXOCHIP,
+	"modern": QuirksModern,
+}
+
+type ErrUnknownQuirks string
+
+func (e ErrUnknownQuirks) Error() string {
+	names := make([]string, 0, len(QuirksPresets))
+	for name := range QuirksPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("ErrUnknownQuirks: %q, expected one of: %s", string(e), strings.Join(names, ", "))
+}
+
+func QuirksByName(name string) (Quirks, error) {
+	q, ok := QuirksPresets[strings.ToLower(name)]
+	if !ok {
+		return Quirks{}, ErrUnknownQuirks(name)
+	}
+	return q, nil
+}
@@ -0,0 +1,145 @@
+package chip8
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Memory used by the snapshots of Rewind by default
+const DefaultRewindLimit = 16 << 20
+
+// Rewind is a ring buffer of save states, one per frame. Only the newest
+// state is kept whole, every older one is stored as the difference to the
+// state after it, so stepping back undoes one difference after another.
+// The oldest differences are dropped when the buffer exceeds Limit bytes.
+type Rewind struct {
+	Limit int // zero value means DefaultRewindLimit
+
+	current []byte
+	deltas  [][]byte // ring buffer, deltas[start] is the oldest
+	start   int
+	count   int
+	size    int // bytes of the deltas and current
+}
+
+func NewRewind(limit int) *Rewind {
+	return &Rewind{Limit: limit}
+}
+
+// Len returns the number of states that can be stepped back.
+func (r *Rewind) Len() int {
+	return r.count
+}
+
+// Push records a new state.
+func (r *Rewind) Push(state []byte) {
+	if r.current != nil {
+		r.push(delta(state, r.current))
+	}
+	r.size += len(state) - len(r.current)
+	r.current = bytes.Clone(state)
+
+	limit := r.Limit
+	if limit <= 0 {
+		limit = DefaultRewindLimit
+	}
+	for r.count > 0 && r.size > limit {
+		r.size -= len(r.deltas[r.start])
+		r.deltas[r.start] = nil
+		r.start = (r.start + 1) % len(r.deltas)
+		r.count--
+	}
+}
+
+func (r *Rewind) push(d []byte) {
+	if r.count == len(r.deltas) {
+		// grow the ring, the oldest delta moves to the start
+		deltas := make([][]byte, max(2*len(r.deltas), 64))
+		for i := 0; i < r.count; i++ {
+			deltas[i] = r.deltas[(r.start+i)%len(r.deltas)]
+		}
+		r.deltas, r.start = deltas, 0
+	}
+	r.deltas[(r.start+r.count)%len(r.deltas)] = d
+	r.count++
+	r.size += len(d)
+}
+
+// Pop returns the state before the newest one and makes it the newest.
+func (r *Rewind) Pop() ([]byte, bool) {
+	if r.count == 0 {
+		return nil, false
+	}
+	r.count--
+	i := (r.start + r.count) % len(r.deltas)
+	d := r.deltas[i]
+	r.deltas[i] = nil
+	prev := undelta(r.current, d)
+	r.size += len(prev) - len(r.current) - len(d)
+	r.current = prev
+	return bytes.Clone(prev), true
+}
+
+// Reset drops all states.
+func (r *Rewind) Reset() {
+	*r = Rewind{Limit: r.Limit}
+}
+
+// delta encodes prev as the XOR with cur: the length of prev followed by
+// pairs of a run of zero bytes and literal bytes, the lengths as uvarints.
+func delta(cur, prev []byte) []byte {
+	n := max(len(cur), len(prev))
+	at := func(b []byte, i int) byte {
+		if i < len(b) {
+			return b[i]
+		}
+		return 0
+	}
+
+	d := binary.AppendUvarint(nil, uint64(len(prev)))
+	for i := 0; i < n; {
+		zeros := i
+		for zeros < n && at(cur, zeros) == at(prev, zeros) {
+			zeros++
+		}
+		lits := zeros
+		// a literal run ends at 4 equal bytes, shorter runs are cheaper inline
+		for lits < n {
+			equal := 0
+			for equal < 4 && lits+equal < n && at(cur, lits+equal) == at(prev, lits+equal) {
+				equal++
+			}
+			if equal == 4 || lits+equal == n {
+				break
+			}
+			lits += equal + 1
+		}
+		d = binary.AppendUvarint(d, uint64(zeros-i))
+		d = binary.AppendUvarint(d, uint64(lits-zeros))
+		for j := zeros; j < lits; j++ {
+			d = append(d, at(cur, j)^at(prev, j))
+		}
+		i = lits
+	}
+	return d
+}
+
+func undelta(cur, d []byte) []byte {
+	length, n := binary.Uvarint(d)
+	d = d[n:]
+	prev := make([]byte, max(int(length), len(cur)))
+	copy(prev, cur)
+	for i := 0; len(d) > 0; {
+		zeros, n := binary.Uvarint(d)
+		d = d[n:]
+		lits, n := binary.Uvarint(d)
+		d = d[n:]
+		i += int(zeros)
+		for j := 0; j < int(lits); j++ {
+			prev[i+j] ^= d[j]
+		}
+		d = d[lits:]
+		i += int(lits)
+	}
+	return prev[:length]
+}
@@ -0,0 +1,80 @@
+package chip8
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRewind(t *testing.T) {
+	r := NewRewind(1 << 20)
+	var states [][]byte
+	for i := 0; i < 100; i++ {
+		state := make([]byte, 4096+i%3)
+		state[i] = byte(i)
+		state[4000] = byte(i / 10)
+		states = append(states, state)
+		r.Push(state)
+	}
+	if r.Len() != 99 {
+		t.Fatalf("Len = %d, expected 99", r.Len())
+	}
+	for i := 98; i >= 0; i-- {
+		state, ok := r.Pop()
+		if !ok || !bytes.Equal(state, states[i]) {
+			t.Fatalf("Pop of state %d differs", i)
+		}
+	}
+	if _, ok := r.Pop(); ok {
+		t.Errorf("Pop beyond the first state")
+	}
+
+	// the oldest states are dropped beyond the limit
+	r = NewRewind(4096 + 100)
+	for _, state := range states {
+		r.Push(state)
+	}
+	if r.Len() == 0 || r.Len() >= 99 {
+		t.Errorf("Len = %d with limit", r.Len())
+	}
+	if r.size > 4096+100 {
+		t.Errorf("size %d beyond limit", r.size)
+	}
+	n := r.Len()
+	for i := 0; i < n; i++ {
+		if state, _ := r.Pop(); !bytes.Equal(state, states[98-i]) {
+			t.Fatalf("Pop of state %d differs", 98-i)
+		}
+	}
+}
+
+func TestStepBack(t *testing.T) {
+	e, d := createStateEmulator(t)
+	e.Rewind = NewRewind(0)
+	var cpus []CPU
+	for i := 0; i < 10; i++ {
+		if err := e.Step(true); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.RecordFrame(); err != nil {
+			t.Fatal(err)
+		}
+		cpus = append(cpus, e.CPU)
+	}
+
+	for i := 8; i >= 0; i-- {
+		ok, err := e.StepBack()
+		if !ok || err != nil {
+			t.Fatalf("StepBack to frame %d: %v", i, err)
+		}
+		if e.CPU != cpus[i] {
+			t.Errorf("Frame %d not restored:\n%s", i, e.CPU.String())
+		}
+		// the sprite is drawn by the third instruction
+		if drawn := d.Pixel(5, 5) != 0; drawn != (i >= 2) {
+			t.Errorf("Display of frame %d not restored", i)
+		}
+	}
+	if ok, _ := e.StepBack(); ok {
+		t.Errorf("StepBack beyond the first frame")
+	}
+}
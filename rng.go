@@ -0,0 +1,132 @@
+package chip8
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/rand/v2"
+)
+
+// RNG is the source of the random bytes of Cxkk. Its state is saved in save
+// states with MarshalBinary and restored with UnmarshalBinary.
+type RNG interface {
+	// Byte returns the next random byte. m is the memory of the emulator.
+	Byte(m Bus) byte
+	MarshalBinary() ([]byte, error)
+	UnmarshalBinary(data []byte) error
+}
+
+// RNGPCG is a seeded PCG generator, the default.
+type RNGPCG struct {
+	pcg *rand.PCG
+}
+
+func NewRNGPCG(seed uint64) *RNGPCG {
+	return &RNGPCG{rand.NewPCG(seed, seed)}
+}
+
+func (r *RNGPCG) Byte(m Bus) byte {
+	return byte(r.pcg.Uint64() >> 56)
+}
+
+func (r *RNGPCG) MarshalBinary() ([]byte, error) {
+	return r.pcg.MarshalBinary()
+}
+
+func (r *RNGPCG) UnmarshalBinary(data []byte) error {
+	if r.pcg == nil {
+		r.pcg = &rand.PCG{}
+	}
+	return r.pcg.UnmarshalBinary(data)
+}
+
+// RNGSequence returns Values over and over again, e.g. for tests.
+type RNGSequence struct {
+	Values []byte
+	Pos    int // index of the next value
+}
+
+func (r *RNGSequence) Byte(m Bus) byte {
+	if len(r.Values) == 0 {
+		return 0
+	}
+	v := r.Values[r.Pos%len(r.Values)]
+	r.Pos = (r.Pos + 1) % len(r.Values)
+	return v
+}
+
+// MarshalBinary writes Pos as uint32 followed by Values.
+func (r *RNGSequence) MarshalBinary() ([]byte, error) {
+	return append(binary.BigEndian.AppendUint32(nil, uint32(r.Pos)), r.Values...), nil
+}
+
+func (r *RNGSequence) UnmarshalBinary(data []byte) error {
+	if len(data) < 4 {
+		return errors.New("RNGSequence: invalid state")
+	}
+	r.Pos = int(binary.BigEndian.Uint32(data))
+	r.Values = append([]byte(nil), data[4:]...)
+	return nil
+}
+
+// RNGVIP is the RND routine of the CHIP-8 interpreter of the COSMAC VIP. The
+// seed (register R9) is incremented, then its high byte is replaced by the
+// sum with the byte at 0x100 + the low byte, which is the code of the
+// interpreter. Without the interpreter loaded at 0x0000, as in CHIP-8 mode
+// where that memory is zero, set Interpreter to read its code from there.
+type RNGVIP struct {
+	Seed uint16
+	// Interpreter is the image of the interpreter from 0x0000, as for
+	// NewVIP, read instead of the memory if not nil
+	Interpreter []byte
+}
+
+func (r *RNGVIP) Byte(m Bus) byte {
+	r.Seed++
+	addr := 0x100 | r.Seed&0xff
+	var code byte
+	if r.Interpreter == nil {
+		code = m.Read(addr)
+	} else if int(addr) < len(r.Interpreter) {
+		code = r.Interpreter[addr]
+	}
+	hi := byte(r.Seed>>8) + code
+	r.Seed = uint16(hi)<<8 | r.Seed&0xff
+	return hi
+}
+
+// MarshalBinary writes Seed as uint16 followed by Interpreter.
+func (r *RNGVIP) MarshalBinary() ([]byte, error) {
+	return append(binary.BigEndian.AppendUint16(nil, r.Seed), r.Interpreter...), nil
+}
+
+func (r *RNGVIP) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 {
+		return errors.New("RNGVIP: invalid state")
+	}
+	r.Seed = binary.BigEndian.Uint16(data)
+	r.Interpreter = nil
+	if len(data) > 2 {
+		r.Interpreter = append([]byte(nil), data[2:]...)
+	}
+	return nil
+}
+
+// Kinds of RNG in save states, other implementations are saved as "USER"
+// and can only be loaded into the same RNG.
+func rngKind(r RNG) string {
+	switch r.(type) {
+	case *RNGPCG:
+		return "PCG "
+	case *RNGSequence:
+		return "SEQ "
+	case *RNGVIP:
+		return "VIP "
+	}
+	return "USER"
+}
+
+var rngKinds = map[string]func() RNG{
+	"PCG ": func() RNG { return &RNGPCG{} },
+	"SEQ ": func() RNG { return &RNGSequence{} },
+	"VIP ": func() RNG { return &RNGVIP{} },
+}
@@ -0,0 +1,79 @@
+package chip8
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRNG(t *testing.T) {
+	m := &Memory{}
+	seq := &RNGSequence{Values: []byte{1, 2, 3}}
+	var got []byte
+	for i := 0; i < 4; i++ {
+		got = append(got, seq.Byte(m))
+	}
+	if !bytes.Equal(got, []byte{1, 2, 3, 1}) {
+		t.Errorf("Wrong sequence %v", got)
+	}
+
+	// the VIP adds the interpreter code at 0x100 + the low byte of the seed
+	m[0x101] = 0x10
+	m[0x102] = 0x20
+	vip := &RNGVIP{Seed: 0x0500}
+	if b := vip.Byte(m); b != 0x15 || vip.Seed != 0x1501 {
+		t.Errorf("Wrong VIP random byte %02x, seed=%04x", b, vip.Seed)
+	}
+	if b := vip.Byte(m); b != 0x35 {
+		t.Errorf("Wrong VIP random byte %02x", b)
+	}
+
+	// in CHIP-8 mode the memory at 0x100 is zero, the interpreter is read
+	// from its image
+	interpreter := make([]byte, 0x200)
+	for i := range interpreter {
+		interpreter[i] = byte(i*37 + 11)
+	}
+	vip = &RNGVIP{Interpreter: interpreter}
+	seen := map[byte]bool{}
+	for i := 0; i < 16; i++ {
+		seen[vip.Byte(&Memory{})] = true
+	}
+	if len(seen) < 8 {
+		t.Errorf("VIP random bytes do not vary, %d different of 16", len(seen))
+	}
+
+	a, b := NewRNGPCG(7), NewRNGPCG(7)
+	for i := 0; i < 10; i++ {
+		if a.Byte(m) != b.Byte(m) {
+			t.Fatalf("Same seeds differ")
+		}
+	}
+
+	r := CPU{}
+	if err := OpNrC(0xc30f, &r, m, &RNGSequence{Values: []byte{0xab}}); err != nil {
+		t.Fatal(err)
+	}
+	if r.V[3] != 0x0b {
+		t.Errorf("Wrong V3, expected=%02x\n%s", 0x0b, r.String())
+	}
+}
+
+func TestRNGState(t *testing.T) {
+	for _, rng := range []RNG{NewRNGPCG(3), &RNGSequence{Values: []byte{4, 5, 6}}, &RNGVIP{Seed: 0x1234}, &RNGVIP{Seed: 5, Interpreter: bytes.Repeat([]byte{7}, 0x200)}} {
+		e, _ := createStateEmulator(t)
+		e.RNG = rng
+		var state bytes.Buffer
+		if err := e.SaveState(&state); err != nil {
+			t.Fatal(err)
+		}
+		expected := rng.Byte(&e.Memory)
+
+		e2, _ := createStateEmulator(t)
+		if err := e2.LoadState(&state); err != nil {
+			t.Fatal(err)
+		}
+		if rngKind(e2.RNG) != rngKind(rng) || e2.RNG.Byte(&e2.Memory) != expected {
+			t.Errorf("RNG %s not restored", rngKind(rng))
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package chip8
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Save states are chunked:
+//
+//	magic "CH8S", version uint16
+//	chunks: id [4]byte, length uint32, data
+//	CRC-32 (IEEE) of everything before
+//
+// All numbers are big endian. Unknown chunks are skipped, so newer chunks can
+// be added without a new version. States of older versions are upgraded by
+// stateUpgrades before they are loaded.
+const StateVersion = 2
+
+const stateMagic = "CH8S"
+
+var ErrStateChecksum = errors.New("save state checksum mismatch")
+
+type ErrState struct {
+	what string
+}
+
+func (e ErrState) Error() string {
+	return fmt.Sprintf("ErrState: %s", e.what)
+}
+
+// ErrStateVersion is returned for states of a newer version.
+type ErrStateVersion uint16
+
+func (e ErrStateVersion) Error() string {
+	return fmt.Sprintf("ErrStateVersion: version %d is newer than %d", uint16(e), StateVersion)
+}
+
+// stateUpgrades[v] converts the chunks of version v to version v+1.
+var stateUpgrades = map[uint16]func(chunks map[string][]byte) error{
+	// version 2 prefixes the state of the RNG with its kind, before it was
+	// always a PCG
+	1: func(chunks map[string][]byte) error {
+		if rng, ok := chunks["RNG "]; ok {
+			chunks["RNG "] = append([]byte("PCG "), rng...)
+		}
+		return nil
+	},
+}
+
+// Chunk layouts
+type cpuState struct {
+	V       [16]byte
+	I       uint16
+	DT, ST  byte
+	PC      uint16
+	SP      byte
+	Stack   [16]uint16
+	Hires   bool
+	Flags   [16]byte
+	Planes  byte
+	Pattern [16]byte
+	Pitch   byte
+	VBlank  bool
+}
+
+type keypadState struct {
+	State    uint16
+	Released uint16
+	Waiting  bool
+}
+
+type quirksState struct {
+	VFReset     bool
+	Shift       bool
+	LoadStore   byte
+	Jump        bool
+	Clip        bool
+	DisplayWait bool
+}
+
+type vipState struct {
+	R           [16]uint16
+	P, X, D     byte
+	DF          bool
+	T           byte
+	IE, Q, Idle bool
+	Cycle       int32
+	Display     bool
+	DMA         byte
+	IRQ         bool
+	Key         byte
+	Lines       [vipDisplayLines][vipLineBytes]byte
+}
+
+type displayState struct {
+	Width, Height uint16
+	Planes        byte
+}
+
+// SaveState writes the state of the CPU, memory, keypad, random numbers,
+// quirks, the display, the cycles of Timing left in the frame and the VIP.
+func (e *Emulator) SaveState(w io.Writer) error {
+	var b bytes.Buffer
+	b.WriteString(stateMagic)
+	binary.Write(&b, binary.BigEndian, uint16(StateVersion))
+
+	chunk := func(id string, v any) {
+		var data bytes.Buffer
+		switch v := v.(type) {
+		case []byte:
+			data.Write(v)
+		default:
+			binary.Write(&data, binary.BigEndian, v)
+		}
+		b.WriteString(id)
+		binary.Write(&b, binary.BigEndian, uint32(data.Len()))
+		b.Write(data.Bytes())
+	}
+
+	c := &e.CPU
+	chunk("CPU ", &cpuState{c.V, c.I, c.DT, c.ST, c.PC, c.SP, c.Stack, c.Hires, c.Flags, c.Planes, c.Pattern, c.Pitch, e.vblank})
+	chunk("MEM ", e.Memory[:])
+	chunk("KEYS", &keypadState{e.Keypad.state, e.Keypad.released, e.Keypad.waiting})
+	q := &e.Quirks
+	chunk("QRKS", &quirksState{q.VFReset, q.Shift, byte(q.LoadStore), q.Jump, q.Clip, q.DisplayWait})
+	rng, err := e.RNG.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	chunk("RNG ", append([]byte(rngKind(e.RNG)), rng...))
+	f := &e.Display.Framebuffer
+	var display bytes.Buffer
+	binary.Write(&display, binary.BigEndian, &displayState{uint16(f.Width), uint16(f.Height), f.Planes})
+	display.Write(f.Pixels)
+	chunk("DISP", display.Bytes())
+	chunk("CYCL", int32(e.cycles))
+	if v := e.VIP; v != nil {
+		c := &v.CPU
+		chunk("1802", &vipState{c.R, c.P, c.X, c.D, c.DF, c.T, c.IE, c.Q, c.Idle, int32(v.cycle), v.display, byte(v.dma), v.irq, v.key, v.lines})
+	}
+
+	binary.Write(&b, binary.BigEndian, crc32.ChecksumIEEE(b.Bytes()))
+	_, err = w.Write(b.Bytes())
+	return err
+}
+
+// LoadState restores a state written by SaveState. The emulator is unchanged
+// if the state is invalid.
+func (e *Emulator) LoadState(r io.Reader) error {
+	switch e.Input.(type) {
+	case *MovieRecorder, *MoviePlayer:
+		return ErrMovie{"loading a state would desync the movie"}
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if len(data) < len(stateMagic)+2+4 || string(data[:len(stateMagic)]) != stateMagic {
+		return ErrState{"not a save state"}
+	}
+	body, sum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return ErrStateChecksum
+	}
+
+	version := binary.BigEndian.Uint16(body[len(stateMagic):])
+	if version == 0 || version > StateVersion {
+		return ErrStateVersion(version)
+	}
+	chunks := map[string][]byte{}
+	for rest := body[len(stateMagic)+2:]; len(rest) > 0; {
+		if len(rest) < 8 {
+			return ErrState{"truncated chunk"}
+		}
+		id, n := string(rest[:4]), binary.BigEndian.Uint32(rest[4:8])
+		if uint32(len(rest)-8) < n {
+			return ErrState{"truncated chunk " + id}
+		}
+		chunks[id] = rest[8 : 8+n]
+		rest = rest[8+n:]
+	}
+	for v := version; v < StateVersion; v++ {
+		if err := stateUpgrades[v](chunks); err != nil {
+			return err
+		}
+	}
+
+	// decode everything before changing the emulator
+	decode := func(id string, v any) error {
+		data, ok := chunks[id]
+		if !ok {
+			return ErrState{"missing chunk " + id}
+		}
+		if err := binary.Read(bytes.NewReader(data), binary.BigEndian, v); err != nil {
+			return ErrState{"invalid chunk " + id}
+		}
+		return nil
+	}
+	var cpu cpuState
+	var keypad keypadState
+	var quirks quirksState
+	for id, v := range map[string]any{"CPU ": &cpu, "KEYS": &keypad, "QRKS": &quirks} {
+		if err := decode(id, v); err != nil {
+			return err
+		}
+	}
+	if int(cpu.SP) > len(cpu.Stack) || cpu.Planes >= 1<<PlaneCount {
+		return ErrState{"invalid chunk CPU "}
+	}
+	if len(chunks["MEM "]) != MemorySize {
+		return ErrState{"invalid chunk MEM "}
+	}
+	rngState := chunks["RNG "]
+	if len(rngState) < 4 {
+		return ErrState{"invalid chunk RNG "}
+	}
+	kind := string(rngState[:4])
+	var rng RNG
+	if newRNG, ok := rngKinds[kind]; ok {
+		rng = newRNG()
+		if err := rng.UnmarshalBinary(rngState[4:]); err != nil {
+			return ErrState{"invalid chunk RNG "}
+		}
+	} else if kind != rngKind(e.RNG) {
+		return ErrState{"RNG of kind " + kind + " differs from the current one"}
+	}
+	var display *Framebuffer
+	if data, ok := chunks["DISP"]; ok {
+		var d displayState
+		if err := decode("DISP", &d); err != nil {
+			return err
+		}
+		pixels := data[binary.Size(d):]
+		lores := d.Width == uint16(DisplayWidth) && d.Height == uint16(DisplayHeigth)
+		hires := d.Width == HiresWidth && d.Height == HiresHeight
+		if !lores && !hires || d.Planes >= 1<<PlaneCount || len(pixels) != int(d.Width)*int(d.Height) {
+			return ErrState{"invalid chunk DISP"}
+		}
+		for _, p := range pixels {
+			if p >= 1<<PlaneCount {
+				return ErrState{"invalid chunk DISP"}
+			}
+		}
+		if hires != cpu.Hires {
+			return ErrState{"display size differs from the resolution of chunk CPU "}
+		}
+		display = &Framebuffer{int(d.Width), int(d.Height), bytes.Clone(pixels), d.Planes}
+	}
+
+	var cycles int32
+	if _, ok := chunks["CYCL"]; ok {
+		if err := decode("CYCL", &cycles); err != nil {
+			return err
+		}
+	}
+
+	var vip vipState
+	if _, ok := chunks["1802"]; ok != (e.VIP != nil) {
+		return ErrState{"state of the VIP and the CHIP-8 CPU are not interchangeable"}
+	} else if ok {
+		if err := decode("1802", &vip); err != nil {
+			return err
+		}
+		if vip.P > 15 || vip.X > 15 || vip.DMA > vipDisplayLines || vip.Cycle < 0 || vip.Cycle >= VIPFrameCycles {
+			return ErrState{"invalid chunk 1802"}
+		}
+	}
+
+	if rng == nil {
+		// restore the user RNG first, nothing is changed if it fails
+		if err := e.RNG.UnmarshalBinary(rngState[4:]); err != nil {
+			return ErrState{"invalid chunk RNG "}
+		}
+		rng = e.RNG
+	}
+	e.CPU = CPU{cpu.V, cpu.I, cpu.DT, cpu.ST, cpu.PC, cpu.SP, cpu.Stack, cpu.Hires, cpu.Flags, cpu.Planes, cpu.Pattern, cpu.Pitch}
+	e.vblank = cpu.VBlank
+	e.cycles = int(cycles)
+	if v := e.VIP; v != nil {
+		v.CPU = CDP1802{vip.R, vip.P, vip.X, vip.D, vip.DF, vip.T, vip.IE, vip.Q, vip.Idle}
+		v.cycle, v.display, v.dma, v.irq, v.key, v.lines = int(vip.Cycle), vip.Display, int(vip.DMA), vip.IRQ, vip.Key, vip.Lines
+	}
+	copy(e.Memory[:], chunks["MEM "])
+	e.Keypad = Keypad{keypad.State, keypad.Released, keypad.Waiting}
+	e.Quirks = Quirks{quirks.VFReset, quirks.Shift, IncrementMode(quirks.LoadStore), quirks.Jump, quirks.Clip, quirks.DisplayWait}
+	e.RNG = rng
+	if display != nil {
+		e.Display.Set(*display)
+		e.Present()
+	}
+	e.updateBeeper()
+	return nil
+}
@@ -0,0 +1,174 @@
+package chip8
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"testing"
+)
+
+var stateROM = []byte{
+	0x60, 0x05, // 0200 LD V0, #05
+	0xf0, 0x29, // 0202 LD F, V0
+	0xd0, 0x05, // 0204 DRW V0, V0, 5
+	0x22, 0x0a, // 0206 CALL #20A
+	0x12, 0x08, // 0208 JP #208
+	0xc1, 0xff, // 020A RND V1, #FF
+	0xc2, 0xff, // 020C RND V2, #FF
+	0x00, 0xee, // 020E RET
+}
+
+func createStateEmulator(t *testing.T) (*Emulator, *Display) {
+	e, err := CreateEmulator(&GraphicsHeadless{}, &MockInput{}, &MockAudio{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.LoadProgram(stateROM)
+	return e, &e.Display
+}
+
+// resum rewrites the checksum of a changed state.
+func resum(data []byte) []byte {
+	body := data[:len(data)-4]
+	return binary.BigEndian.AppendUint32(bytes.Clone(body), crc32.ChecksumIEEE(body))
+}
+
+func TestSaveState(t *testing.T) {
+	e, d := createStateEmulator(t)
+	e.Seed(42)
+	e.Quirks = QuirksCOSMAC
+	for i := 0; i < 5; i++ {
+		if err := e.Step(true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var state bytes.Buffer
+	if err := e.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+	saved := e.CPU
+	e.Step(false)
+	e.Step(false)
+	v2 := e.CPU.V[2]
+
+	// a new emulator continues like the saved one, with the same random numbers
+	e2, d2 := createStateEmulator(t)
+	if err := e2.LoadState(bytes.NewReader(state.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if e2.CPU != saved || e2.Quirks != QuirksCOSMAC || e2.Memory != e.Memory {
+		t.Errorf("State not restored:\n%s", e2.CPU.String())
+	}
+	if !bytes.Equal(d2.Pixels, d.Pixels) || d2.Pixel(5, 5) == 0 {
+		t.Errorf("Display not restored")
+	}
+	e2.Step(false)
+	e2.Step(false)
+	if e2.CPU.V[2] != v2 {
+		t.Errorf("Random numbers differ after loading, expected=%02x actual=%02x", v2, e2.CPU.V[2])
+	}
+}
+
+func TestLoadStateErrors(t *testing.T) {
+	e, _ := createStateEmulator(t)
+	var state bytes.Buffer
+	e.SaveState(&state)
+	data := state.Bytes()
+
+	corrupt := bytes.Clone(data)
+	corrupt[100] ^= 1
+	if err := e.LoadState(bytes.NewReader(corrupt)); err != ErrStateChecksum {
+		t.Errorf("Expected ErrStateChecksum, actual=%v", err)
+	}
+
+	// rewrite the state with a change and a valid checksum
+	newer := bytes.Clone(data)
+	binary.BigEndian.PutUint16(newer[4:], StateVersion+1)
+	var errVersion ErrStateVersion
+	if err := e.LoadState(bytes.NewReader(resum(newer))); !errors.As(err, &errVersion) {
+		t.Errorf("Expected ErrStateVersion, actual=%v", err)
+	}
+
+	// unknown chunks of newer emulators are skipped
+	extra := append(bytes.Clone(data[:len(data)-4]), "XTRA\x00\x00\x00\x02ab...."...)
+	e.CPU.PC = 0x300
+	if err := e.LoadState(bytes.NewReader(resum(extra))); err != nil || e.CPU.PC != 0x200 {
+		t.Errorf("Unknown chunk not skipped, PC=%04x err=%v", e.CPU.PC, err)
+	}
+
+	// the display has to be of a supported size with valid planes
+	disp := bytes.Index(data, []byte("DISP"))
+	size := int(binary.BigEndian.Uint32(data[disp+4:]))
+	for _, body := range [][]byte{
+		{0, 0, 0, 0, 1},
+		append([]byte{0, 64, 0, 32, 4}, make([]byte, 64*32)...),
+		append([]byte{0, 64, 0, 32, 1}, bytes.Repeat([]byte{0xff}, 64*32)...),
+	} {
+		invalid := append(bytes.Clone(data[:disp+4]), binary.BigEndian.AppendUint32(nil, uint32(len(body)))...)
+		invalid = append(append(invalid, body...), data[disp+8+size:]...)
+		e.CPU.PC = 0x300
+		var errState ErrState
+		if err := e.LoadState(bytes.NewReader(resum(invalid))); !errors.As(err, &errState) || e.CPU.PC != 0x300 {
+			t.Errorf("Expected ErrState for the display % x..., actual=%v", body[:5], err)
+		}
+	}
+
+	// the CPU has to fit the stack, the planes and the display
+	for _, patch := range []struct {
+		name   string
+		offset int
+		value  byte
+	}{
+		{"SP", 22, 17},
+		{"Planes", 72, 4},
+		{"Hires", 55, 1},
+	} {
+		invalid := bytes.Clone(data)
+		invalid[bytes.Index(data, []byte("CPU "))+8+patch.offset] = patch.value
+		e.CPU.PC = 0x300
+		var errState ErrState
+		if err := e.LoadState(bytes.NewReader(resum(invalid))); !errors.As(err, &errState) || e.CPU.PC != 0x300 {
+			t.Errorf("Expected ErrState for %s=%d, actual=%v", patch.name, patch.value, err)
+		}
+	}
+
+	if err := e.LoadState(bytes.NewReader([]byte("garbage"))); err == nil {
+		t.Errorf("Expected an error for garbage")
+	}
+}
+
+func TestStateUpgrade(t *testing.T) {
+	e, _ := createStateEmulator(t)
+	e.Seed(42)
+	var state bytes.Buffer
+	e.SaveState(&state)
+	expected := e.RNG.Byte(&e.Memory)
+
+	// version 1 saved the PCG without the kind of the RNG
+	data := state.Bytes()
+	var v1 []byte
+	v1 = append(v1, data[:4]...)
+	v1 = binary.BigEndian.AppendUint16(v1, 1)
+	for rest := data[6 : len(data)-4]; len(rest) > 0; {
+		id, n := string(rest[:4]), binary.BigEndian.Uint32(rest[4:8])
+		chunk := rest[8 : 8+n]
+		rest = rest[8+n:]
+		if id == "RNG " {
+			chunk = chunk[4:]
+		}
+		v1 = append(v1, id...)
+		v1 = binary.BigEndian.AppendUint32(v1, uint32(len(chunk)))
+		v1 = append(v1, chunk...)
+	}
+	v1 = binary.BigEndian.AppendUint32(v1, crc32.ChecksumIEEE(v1))
+
+	e2, _ := createStateEmulator(t)
+	if err := e2.LoadState(bytes.NewReader(v1)); err != nil {
+		t.Fatal(err)
+	}
+	if e2.RNG.Byte(&e2.Memory) != expected {
+		t.Errorf("Random numbers differ after loading version 1")
+	}
+}
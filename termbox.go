@@ -1,14 +1,51 @@
 package chip8
 
 import (
+	"sync"
+	"time"
+	"unicode"
+
 	"github.com/mattn/go-runewidth"
 	"github.com/nsf/termbox-go"
 )
 
-type GraphicsTermbox struct {
-	buffer [DisplayHeigth][DisplayWidth]bool
+// KeyLayout maps each key of the hexadecimal keypad (0x0-0xF) to a keyboard rune.
+type KeyLayout [KeyCount]rune
+
+// DefaultKeyLayout maps the COSMAC VIP keypad to the left side of a QWERTY keyboard:
+//
+//	1 2 3 C      1 2 3 4
+//	4 5 6 D  ->  Q W E R
+//	7 8 9 E      A S D F
+//	A 0 B F      Z X C V
+var DefaultKeyLayout = KeyLayout{
+	'x', '1', '2', '3',
+	'q', 'w', 'e', 'a',
+	's', 'd', 'z', 'c',
+	'4', 'r', 'f', 'v',
+}
+
+// Terminals only report key presses (and their auto-repeat), so a key counts
+// as held down for this long after its last press.
+const DefaultKeyHold = 200 * time.Millisecond
+
+type GraphicsTermbox struct{}
+
+type InputTermbox struct {
+	Layout KeyLayout     // zero value means DefaultKeyLayout
+	Hold   time.Duration // zero value means DefaultKeyHold
+	// Hotkeys are actions of special keys like termbox.KeyF5
+	Hotkeys map[termbox.Key]func()
+	// RewindKey is held to run time backwards, zero value means Backspace
+	RewindKey termbox.Key
+
+	mu      sync.Mutex
+	pressed [KeyCount]time.Time
+	rewind  time.Time // last press of RewindKey
+	pending []func()  // actions of pressed hotkeys
+	events  chan termbox.Event
+	done    chan struct{}
 }
-type InputTermbox struct{}
 
 func (d *GraphicsTermbox) Init() error {
 	return termbox.Init()
@@ -18,40 +55,38 @@ func (d *GraphicsTermbox) Close() {
 	termbox.Close()
 }
 
-func (d *GraphicsTermbox) Clear() {
-	termbox.Clear(termbox.ColorBlack, termbox.ColorBlack)
+// Colors of the pixels by their XO-CHIP bitplanes
+var termboxPalette = [1 << PlaneCount]termbox.Attribute{
+	termbox.ColorBlack,
+	termbox.ColorWhite,
+	termbox.ColorRed,
+	termbox.ColorYellow,
 }
 
-func bgColor(set bool) termbox.Attribute {
-	if set {
-		return termbox.ColorWhite
-	} else {
-		return termbox.ColorBlack
+// Present renders the frame in HiresWidth x HiresHeight/2 cells. Every cell
+// shows two pixels stacked with a half block, which keeps the pixels square
+// in both resolutions. Only the cells of the dirty region are redrawn.
+func (d *GraphicsTermbox) Present(frame *Framebuffer, dirty Rect) {
+	sx := HiresWidth / frame.Width
+	sy := HiresHeight / frame.Height
+	for cy := dirty.Y * sy / 2; cy < ((dirty.Y+dirty.Height)*sy+1)/2; cy++ {
+		for cx := dirty.X * sx; cx < (dirty.X+dirty.Width)*sx; cx++ {
+			top := frame.Pixel(cx/sx, 2*cy/sy)
+			bottom := frame.Pixel(cx/sx, (2*cy+1)/sy)
+			termbox.SetCell(cx, cy, '▀', termboxPalette[top], termboxPalette[bottom])
+		}
 	}
+	termbox.Flush()
 }
 
-func (d *GraphicsTermbox) Draw(x, y byte, sprite []byte) (collision byte) {
-	// TODO: implement collision and XOR, check for boundaries
-	for i, v := range sprite {
-		for j := 7; j >= 0; j-- {
-			set := ((v >> j) & 1) == 1
-			xi, yi := int(x)+7-j, int(y)+i
-			xi, yi = xi%int(DisplayWidth), yi%int(DisplayHeigth)
-			old := d.buffer[yi][xi]
-			set = set != old
-			if !set && old {
-				// collision only set on erased pixels
-				collision = collision | 1
-			}
-			termbox.SetCell(xi, yi, ' ', bgColor(set), bgColor(set))
-			// FIXME: is this OK?
-			d.buffer[yi][xi] = set
-		}
+// Status shows a message below the display.
+func (d *GraphicsTermbox) Status(msg string) {
+	width, _ := termbox.Size()
+	for x := 0; x < width; x++ {
+		termbox.SetCell(x, HiresHeight/2, ' ', termbox.ColorDefault, termbox.ColorDefault)
 	}
-
+	tbprint(0, HiresHeight/2, termbox.ColorDefault, termbox.ColorDefault, msg)
 	termbox.Flush()
-
-	return collision
 }
 
 func tbprint(x, y int, fg, bg termbox.Attribute, msg string) {
@@ -75,13 +110,119 @@ func tbdraw(x, y int, sprite []byte) {
 }
 
 func (k *InputTermbox) Init() error {
-	return termbox.Init()
+	if err := termbox.Init(); err != nil {
+		return err
+	}
+	if k.Layout == (KeyLayout{}) {
+		k.Layout = DefaultKeyLayout
+	}
+	if k.Hold == 0 {
+		k.Hold = DefaultKeyHold
+	}
+	k.events = make(chan termbox.Event, 16)
+	k.done = make(chan struct{})
+	go k.poll()
+	return nil
 }
 
 func (k *InputTermbox) Close() {
+	if k.done == nil {
+		return
+	}
+	termbox.Interrupt()
+	<-k.done
+	k.done = nil
 	termbox.Close()
 }
 
 func (k *InputTermbox) WaitForEvent() {
-	termbox.PollEvent()
+	if k.events == nil {
+		return
+	}
+	select {
+	case <-k.events:
+	case <-k.done:
+	}
+}
+
+func (k *InputTermbox) Keys() uint16 {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	var state uint16
+	now := time.Now()
+	for key, t := range k.pressed {
+		if !t.IsZero() && now.Sub(t) < k.Hold {
+			state |= 1 << key
+		}
+	}
+	return state
+}
+
+func (k *InputTermbox) Rewinding() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return !k.rewind.IsZero() && time.Since(k.rewind) < k.Hold
+}
+
+func (k *InputTermbox) PendingHotkeys() []func() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	pending := k.pending
+	k.pending = nil
+	return pending
+}
+
+// poll reads termbox events until interrupted by Close.
+func (k *InputTermbox) poll() {
+	defer close(k.done)
+	for {
+		ev := termbox.PollEvent()
+		switch ev.Type {
+		case termbox.EventInterrupt, termbox.EventError:
+			return
+		case termbox.EventKey:
+			if action, ok := k.Hotkeys[ev.Key]; ok && ev.Ch == 0 {
+				k.mu.Lock()
+				k.pending = append(k.pending, action)
+				k.mu.Unlock()
+				continue
+			}
+			if k.isRewindKey(ev) {
+				k.mu.Lock()
+				k.rewind = time.Now()
+				k.mu.Unlock()
+				continue
+			}
+			k.press(ev.Ch)
+		}
+
+		select {
+		case k.events <- ev:
+		default:
+		}
+	}
+}
+
+func (k *InputTermbox) isRewindKey(ev termbox.Event) bool {
+	if ev.Ch != 0 {
+		return false
+	}
+	if k.RewindKey == 0 {
+		// terminals send either DEL or BS for Backspace
+		return ev.Key == termbox.KeyBackspace2 || ev.Key == termbox.KeyBackspace
+	}
+	return ev.Key == k.RewindKey
+}
+
+func (k *InputTermbox) press(ch rune) {
+	ch = unicode.ToLower(ch)
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for key, r := range k.Layout {
+		if r == ch {
+			k.pressed[key] = time.Now()
+		}
+	}
 }
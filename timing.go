@@ -0,0 +1,156 @@
+package chip8
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Timing is the cost of the instructions in machine cycles. With a Timing,
+// RunFrame executes instructions until they used up the cycles of the frame
+// instead of InstructionsPerFrame instructions, and Dxyn waits for the start
+// of the next frame like on an interpreter drawing in the display interrupt.
+type Timing interface {
+	// FrameCycles returns the cycles of a frame left to the instructions
+	FrameCycles() int
+	// Cycles returns the cost of the opcode executed by the CPU, which is in
+	// the state before the opcode, skipped reports whether it skipped the
+	// next instruction
+	Cycles(opcode uint16, cpu *CPU, skipped bool) int
+}
+
+// Machine cycles of the COSMAC VIP per 60 Hz frame: the CDP1802 runs at
+// 1.7609 MHz and takes 8 clock cycles per machine cycle.
+const VIPFrameCycles = 3668
+
+// The CDP1861 display takes 8 DMA cycles for each of the 128 lines, the
+// interrupt routine, which also counts down the timers, takes the rest.
+const vipDisplayCycles = 128*8 + 46
+
+// Cycles of the fetch and dispatch loop of the VIP interpreter, spent before
+// every instruction.
+const vipFetchCycles = 68
+
+// TimingVIP is the timing of the CHIP-8 interpreter of the COSMAC VIP. The
+// cycles are counted from its routines, the cost of some depends on the
+// operands: Dxyn shifts every sprite row by x mod 8, Fx33 divides by
+// repeated subtraction and Fx55, Fx65 copy x + 1 registers.
+type TimingVIP struct{}
+
+func (TimingVIP) FrameCycles() int {
+	return VIPFrameCycles - vipDisplayCycles
+}
+
+func (TimingVIP) Cycles(opcode uint16, cpu *CPU, skipped bool) int {
+	x := OpX(opcode)
+	// cost of the skip opcodes
+	skip := func(cycles int) int {
+		if skipped {
+			return cycles + 4
+		}
+		return cycles
+	}
+	var cycles int
+	switch OpNr(opcode) {
+	case 0:
+		switch opcode {
+		case 0x00e0:
+			// clears the 256 bytes of the display, 8 cycles each
+			cycles = 24 + 256*8
+		case 0x00ee:
+			cycles = 10
+		default:
+			// machine code subroutine, its cycles are unknown
+			cycles = 0
+		}
+	case 1:
+		cycles = 12
+	case 2:
+		cycles = 26
+	case 3, 4:
+		cycles = skip(10)
+	case 5, 9:
+		cycles = skip(14)
+	case 6:
+		cycles = 6
+	case 7:
+		cycles = 10
+	case 8:
+		if OpN(opcode) == 0 {
+			cycles = 12
+		} else {
+			cycles = 44
+		}
+	case 0xa:
+		cycles = 12
+	case 0xb:
+		cycles = 22
+	case 0xc:
+		cycles = 36
+	case 0xd:
+		rows := int(OpN(opcode))
+		cycles = 26 + rows*(46+16*int(cpu.V[x]&7))
+	case 0xe:
+		cycles = skip(14)
+	case 0xf:
+		switch opcode & 0xff {
+		case 0x07, 0x15, 0x18:
+			cycles = 10
+		case 0x0a:
+			cycles = 18
+		case 0x1e, 0x29:
+			cycles = 16
+		case 0x33:
+			v := cpu.V[x]
+			cycles = 80 + 16*int(v/100+v/10%10+v%10)
+		case 0x55, 0x65:
+			cycles = 14 + 14*int(x+1)
+		default:
+			cycles = 10
+		}
+	}
+	return vipFetchCycles + cycles
+}
+
+// Timings by name, nil is the fixed InstructionsPerFrame
+var TimingModes = map[string]Timing{
+	"fixed": nil,
+	"vip":   TimingVIP{},
+}
+
+type ErrUnknownTiming string
+
+func (e ErrUnknownTiming) Error() string {
+	return fmt.Sprintf("ErrUnknownTiming: %q, expected fixed or vip", string(e))
+}
+
+func TimingByName(name string) (Timing, error) {
+	t, ok := TimingModes[strings.ToLower(name)]
+	if !ok {
+		return nil, ErrUnknownTiming(name)
+	}
+	return t, nil
+}
+
+// runCycles executes instructions until the cycles of the frame are used
+// up. The cycles an instruction takes beyond the frame are taken from the
+// next one.
+func (e *Emulator) runCycles() error {
+	e.cycles += e.Timing.FrameCycles()
+	for e.cycles > 0 {
+		opcode := e.CPU.fetch(e.bus())
+		if OpNr(opcode) == 0xd && !e.vblank {
+			// the interpreter idles until the display interrupt
+			e.cycles = 0
+			break
+		}
+		// the costs depend on the operands before the opcode changes them,
+		// e.g. DFyn writes the collision to VF
+		cpu := e.CPU
+		if err := e.step(false); err != nil {
+			return err
+		}
+		e.cycles -= e.Timing.Cycles(opcode, &cpu, e.CPU.PC-cpu.PC > 2 && e.CPU.PC-cpu.PC <= 6)
+	}
+	e.frameTick()
+	return nil
+}
@@ -0,0 +1,113 @@
+package chip8
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTimingVIP(t *testing.T) {
+	e, err := CreateEmulator(&GraphicsHeadless{}, &InputNull{}, &AudioNull{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Timing = TimingVIP{}
+	timing := TimingVIP{}
+
+	// ADD V0, 1; JP #200
+	e.LoadProgram([]byte{0x70, 0x01, 0x12, 0x00})
+	loop := timing.Cycles(0x7001, &e.CPU, false) + timing.Cycles(0x1200, &e.CPU, false)
+	frames := 10
+	for i := 0; i < frames; i++ {
+		if err := e.RunFrame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the cycles beyond a frame are taken from the next one
+	if total, n := frames*timing.FrameCycles(), int(e.CPU.V[0]); n*loop < total-loop || n*loop > total+loop {
+		t.Errorf("%d loops of %d cycles in %d cycles", n, loop, total)
+	}
+
+	// the costs depend on the operands
+	cpu := CPU{}
+	cpu.V[1] = 3
+	if aligned, shifted := timing.Cycles(0xd005, &cpu, false), timing.Cycles(0xd105, &cpu, false); shifted <= aligned {
+		t.Errorf("Shifted sprite costs %d cycles, aligned %d", shifted, aligned)
+	}
+	if timing.Cycles(0x3000, &cpu, true) <= timing.Cycles(0x3000, &cpu, false) {
+		t.Errorf("Skip costs no cycles")
+	}
+	if timing.Cycles(0xf565, &cpu, false) <= timing.Cycles(0xf065, &cpu, false) {
+		t.Errorf("Fx65 cost does not depend on x")
+	}
+}
+
+// MockTiming records the costs of TimingVIP.
+type MockTiming struct {
+	TimingVIP
+	costs []int
+}
+
+func (m *MockTiming) Cycles(opcode uint16, cpu *CPU, skipped bool) int {
+	cycles := m.TimingVIP.Cycles(opcode, cpu, skipped)
+	m.costs = append(m.costs, cycles)
+	return cycles
+}
+
+func TestTimingOperands(t *testing.T) {
+	e, err := CreateEmulator(&GraphicsHeadless{}, &InputNull{}, &AudioNull{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	timing := &MockTiming{}
+	e.Timing = timing
+
+	// DRW VF, VF, 1 at 0,0 onto a pixel, which sets VF; JP #202
+	e.LoadProgram([]byte{0xdf, 0xf1, 0x12, 0x02})
+	e.Display.setPixel(0, 0, 1)
+	for i := 0; i < 2; i++ {
+		if err := e.RunFrame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the shift is priced with the VF drawn with, not the collision
+	expected := TimingVIP{}.Cycles(0xdff1, &CPU{}, false)
+	if len(timing.costs) == 0 {
+		t.Fatalf("DFF1 not executed")
+	}
+	if timing.costs[0] != expected || e.CPU.V[0xf] != 1 {
+		t.Errorf("DFF1 costs %d cycles, expected %d, VF=%d", timing.costs[0], expected, e.CPU.V[0xf])
+	}
+}
+
+func TestTimingDisplayWait(t *testing.T) {
+	e, err := CreateEmulator(&GraphicsHeadless{}, &InputNull{}, &AudioNull{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Timing = TimingVIP{}
+	e.Quirks = QuirksModern
+
+	// DRW V0, V0, 1; DRW V0, V0, 1; JP #204
+	e.LoadProgram([]byte{0xd0, 0x01, 0xd0, 0x01, 0x12, 0x04})
+	// at power-on the first draw waits for the frame to end
+	for frame, pc := range []uint16{0x200, 0x202, 0x204} {
+		if err := e.RunFrame(); err != nil {
+			t.Fatal(err)
+		}
+		if e.CPU.PC != pc {
+			t.Errorf("Frame %d: PC=%04x, expected %04x", frame+1, e.CPU.PC, pc)
+		}
+	}
+
+	// the cycles left are saved
+	e.RunFrame()
+	var state bytes.Buffer
+	e.SaveState(&state)
+	e.RunFrame()
+	hash := e.StateHash()
+	e.LoadState(&state)
+	e.RunFrame()
+	if e.StateHash() != hash {
+		t.Errorf("Frame after loading differs")
+	}
+}
@@ -0,0 +1,159 @@
+// Package trace writes a line per instruction executed by the emulator, to
+// follow a program or diff a run against the traces of other emulators.
+//
+// Every line holds the state before the instruction, fields are separated
+// by single spaces, all numbers but the cycle are upper case hex:
+//
+//	cycle      pc   op   mnemonic             V0-VF                            I    SP DT ST
+//	0000000042 0204 6A05 LD VA, #05           00000000000000000000000000000000 0000 00 00 00
+//
+// The cycle counts the instructions from 0, including the filtered ones.
+// The mnemonic, in Cowgod's notation or DW for unknown opcodes, is padded
+// to 20 characters.
+package trace
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/debuggerpls/go-chip8"
+	"github.com/debuggerpls/go-chip8/disasm"
+)
+
+// Filter selects the traced instructions. The zero value traces all.
+type Filter struct {
+	From, To uint16 // address range of the PC, both zero means all
+	// Patterns of the traced opcodes, e.g. 8xy4 or Dxyn, or a prefix of one
+	// like 8 or Fx. Empty means all
+	Patterns []string
+}
+
+// ParseFilter parses the address range FROM-TO and comma separated
+// patterns, either may be empty.
+func ParseFilter(addrs, patterns string) (Filter, error) {
+	var f Filter
+	if addrs != "" {
+		from, to, ok := strings.Cut(addrs, "-")
+		if !ok {
+			to = from
+		}
+		for i, s := range []string{from, to} {
+			v, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(s), "#"), 16, 16)
+			if err != nil {
+				return f, fmt.Errorf("invalid address range %q, expected FROM-TO in hex", addrs)
+			}
+			if i == 0 {
+				f.From = uint16(v)
+			} else {
+				f.To = uint16(v)
+			}
+		}
+	}
+	for _, p := range strings.Split(patterns, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			f.Patterns = append(f.Patterns, p)
+		}
+	}
+	return f, nil
+}
+
+// Match reports whether the instruction is traced.
+func (f *Filter) Match(in disasm.Instruction) bool {
+	if (f.From != 0 || f.To != 0) && (in.Addr < f.From || in.Addr > f.To) {
+		return false
+	}
+	if len(f.Patterns) == 0 {
+		return true
+	}
+	pattern := strings.ToUpper(in.Pattern())
+	for _, p := range f.Patterns {
+		if strings.HasPrefix(pattern, strings.ToUpper(p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// record is the state before a traced instruction.
+type record struct {
+	cycle uint64
+	in    disasm.Instruction
+	cpu   chip8.CPU
+}
+
+func (r *record) format() string {
+	var v strings.Builder
+	for _, x := range r.cpu.V {
+		fmt.Fprintf(&v, "%02X", x)
+	}
+	c := &r.cpu
+	return fmt.Sprintf("%010d %04X %04X %-20s %s %04X %02X %02X %02X",
+		r.cycle, r.in.Addr, r.in.Opcode, r.in.String(), v.String(), c.I, c.SP, c.DT, c.ST)
+}
+
+// Tracer is a chip8.Tracer that writes the traced instructions to a
+// writer, or keeps the last ones in a ring buffer until Flush.
+type Tracer struct {
+	Filter Filter
+	Cycle  uint64 // of the next instruction
+
+	w     *bufio.Writer
+	err   error
+	ring  []record
+	start int // oldest record of the ring
+	count int
+}
+
+// New returns a Tracer writing every instruction to w, call Flush at the
+// end.
+func New(w io.Writer) *Tracer {
+	return &Tracer{w: bufio.NewWriter(w)}
+}
+
+// NewRing returns a Tracer keeping only the last n instructions, which
+// Flush writes to w, e.g. after an error.
+func NewRing(w io.Writer, n int) *Tracer {
+	return &Tracer{w: bufio.NewWriter(w), ring: make([]record, max(n, 1))}
+}
+
+func (t *Tracer) Trace(e *chip8.Emulator, pc, opcode uint16) {
+	cycle := t.Cycle
+	t.Cycle++
+	in := disasm.Decode(e.Memory[:], pc)
+	if !t.Filter.Match(in) {
+		return
+	}
+	r := record{cycle, in, e.CPU}
+	if t.ring == nil {
+		t.write(&r)
+		return
+	}
+	t.ring[(t.start+t.count)%len(t.ring)] = r
+	if t.count < len(t.ring) {
+		t.count++
+	} else {
+		t.start = (t.start + 1) % len(t.ring)
+	}
+}
+
+func (t *Tracer) write(r *record) {
+	if t.err == nil {
+		_, t.err = fmt.Fprintln(t.w, r.format())
+	}
+}
+
+// Flush writes the instructions kept in the ring buffer, if any, and
+// returns the first write error.
+func (t *Tracer) Flush() error {
+	for ; t.count > 0; t.count-- {
+		t.write(&t.ring[t.start])
+		t.start = (t.start + 1) % len(t.ring)
+	}
+	if t.err == nil {
+		t.err = t.w.Flush()
+	}
+	return t.err
+}
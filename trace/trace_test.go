@@ -0,0 +1,80 @@
+package trace
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/debuggerpls/go-chip8"
+)
+
+var testROM = []byte{
+	0x6a, 0x05, // 0200 LD VA, #05
+	0x7a, 0x01, // 0202 ADD VA, #01
+	0x8b, 0xa4, // 0204 ADD VB, VA
+	0x12, 0x02, // 0206 JP #202
+}
+
+func run(t *testing.T, tracer *Tracer, steps int) string {
+	e, err := chip8.CreateEmulator(&chip8.GraphicsHeadless{}, &chip8.InputNull{}, &chip8.AudioNull{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.LoadProgram(testROM)
+	var b strings.Builder
+	tracer.w.Reset(&b)
+	e.Tracer = tracer
+	for i := 0; i < steps; i++ {
+		if err := e.Step(false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tracer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestTrace(t *testing.T) {
+	lines := strings.Split(run(t, New(nil), 3), "\n")
+	expected := []string{
+		"0000000000 0200 6A05 LD VA, #05           00000000000000000000000000000000 0000 00 00 00",
+		"0000000001 0202 7A01 ADD VA, #01          00000000000000000000050000000000 0000 00 00 00",
+		"0000000002 0204 8BA4 ADD VB, VA           00000000000000000000060000000000 0000 00 00 00",
+		"",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("Wrong trace:\n%s", strings.Join(lines, "\n"))
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("Line %d:\nexpected=%q\nactual  =%q", i, expected[i], lines[i])
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	tracer := New(nil)
+	var err error
+	if tracer.Filter, err = ParseFilter("202-205", "8xy"); err != nil {
+		t.Fatal(err)
+	}
+	out := run(t, tracer, 8)
+	if strings.Count(out, "\n") != 2 || strings.Count(out, " 0204 8BA4 ") != 2 {
+		t.Errorf("Wrong filtered trace:\n%s", out)
+	}
+	if !strings.HasPrefix(out, "0000000002 ") {
+		t.Errorf("Filtered instructions not counted:\n%s", out)
+	}
+
+	if _, err := ParseFilter("20x", ""); err == nil {
+		t.Errorf("Expected an error for an invalid range")
+	}
+}
+
+func TestRing(t *testing.T) {
+	out := run(t, NewRing(nil, 2), 10)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "0000000008 ") || !strings.HasPrefix(lines[1], "0000000009 ") {
+		t.Errorf("Ring does not keep the last instructions:\n%s", out)
+	}
+}
@@ -0,0 +1,191 @@
+package chip8
+
+import "fmt"
+
+// Memory map of the COSMAC VIP: 4 KiB of RAM, repeated below 0x8000, and
+// the 512 bytes of the monitor ROM, repeated above. The CHIP-8 interpreter
+// is loaded at 0x0000, the programs at 0x0200.
+const (
+	VIPRAMSize = 0x1000
+	VIPROMSize = 0x200
+	vipROM     = 0x8000
+)
+
+// Timing of the CDP1861 display in machine cycles: a frame has 262 lines of
+// 14 cycles. The interrupt comes 29 cycles before the first of the 128
+// display lines, each of which takes 8 bytes of memory by DMA. EF1 is set in
+// the 4 lines before the display starts and ends.
+const (
+	vipLineCycles   = 14
+	vipInterrupt    = 78 * vipLineCycles
+	vipFirstDMA     = vipInterrupt + 29
+	vipDisplayLines = 128
+	vipLineBytes    = 8
+)
+
+// The interpreter repeats every CHIP-8 row on 4 display lines.
+const vipLinesPerRow = vipDisplayLines / 32
+
+type ErrVIP struct {
+	what string
+}
+
+func (e ErrVIP) Error() string {
+	return fmt.Sprintf("ErrVIP: %s", e.what)
+}
+
+// VIP emulates the COSMAC VIP, a CDP1802 with the CDP1861 display, to run
+// the original CHIP-8 interpreter, including the 0nnn machine code
+// subroutines of the programs. It uses the RAM of the Emulator's Memory, the
+// keypad and beeper of its Input and Audio and draws on its Display.
+type VIP struct {
+	CPU CDP1802
+	// Interpreter is loaded at 0x0000 by Reset
+	Interpreter []byte
+	// ROM is the monitor, by default it only holds the hex digits at 0x8100
+	// where the interpreter's Fx29 expects them
+	ROM [VIPROMSize]byte
+
+	memory  *Memory
+	cycle   int // machine cycle in the frame
+	display bool
+	dma     int  // next display line
+	irq     bool // the interrupt of the frame was requested
+	key     byte // keypad latch
+	keypad  *Keypad
+	lines   [vipDisplayLines][vipLineBytes]byte
+}
+
+// NewVIP returns a VIP running the interpreter image, which holds the 512
+// bytes from 0x0000 of the RAM of the VIP.
+func NewVIP(interpreter []byte) (*VIP, error) {
+	if len(interpreter) == 0 || len(interpreter) > 0x200 {
+		return nil, ErrVIP{fmt.Sprintf("interpreter of %d bytes, expected 1-512", len(interpreter))}
+	}
+	v := &VIP{Interpreter: interpreter}
+	// the monitor addresses the digits by a table of their low bytes
+	for digit := 0; digit < 16; digit++ {
+		offset := 0x110 + digit*5
+		v.ROM[0x100+digit] = byte(offset)
+		copy(v.ROM[offset:], fontData[digit])
+	}
+	return v, nil
+}
+
+// reset loads the interpreter and starts the CDP1802 at 0x0000, like the
+// monitor does after finding the end of the RAM, which it passes in R1.
+func (v *VIP) reset(e *Emulator) {
+	v.memory = &e.Memory
+	v.keypad = &e.Keypad
+	clear(e.Memory[:VIPRAMSize])
+	copy(e.Memory[:], v.Interpreter)
+	v.CPU = CDP1802{}
+	v.CPU.Reset()
+	v.CPU.R[1] = VIPRAMSize - 1
+	v.cycle, v.dma, v.irq, v.display, v.key = 0, 0, false, false, 0
+	v.lines = [vipDisplayLines][vipLineBytes]byte{}
+}
+
+// StartVIP switches the emulator to the VIP, which resets the memory: load
+// the program after.
+func (e *Emulator) StartVIP(v *VIP) error {
+	e.VIP = v
+	return e.Reset()
+}
+
+func (v *VIP) Read(addr uint16) byte {
+	if addr >= vipROM {
+		return v.ROM[addr%VIPROMSize]
+	}
+	return v.memory[addr%VIPRAMSize]
+}
+
+func (v *VIP) Write(addr uint16, value byte) {
+	if addr < vipROM {
+		v.memory[addr%VIPRAMSize] = value
+	}
+}
+
+// Out 1 turns the display off, Out 2 latches the key to test with EF3.
+func (v *VIP) Out(port byte, value byte) {
+	switch port {
+	case 1:
+		v.display = false
+	case 2:
+		v.key = value & 0xf
+	}
+}
+
+// In 1 turns the display on.
+func (v *VIP) In(port byte) byte {
+	if port == 1 {
+		v.display = true
+	}
+	return 0
+}
+
+func (v *VIP) EF(n byte) bool {
+	switch n {
+	case 1:
+		line := v.cycle / vipLineCycles
+		first := vipFirstDMA / vipLineCycles
+		return v.display && (line >= first-4 && line < first || line >= first+vipDisplayLines-4 && line < first+vipDisplayLines)
+	case 3:
+		return v.keypad.state&(1<<v.key) != 0
+	}
+	return false
+}
+
+// runFrame runs the machine cycles of one frame and shows the display lines
+// on the Display.
+func (v *VIP) runFrame(e *Emulator) {
+	for v.cycle < VIPFrameCycles {
+		switch {
+		case v.display && v.dma < vipDisplayLines && v.cycle >= vipFirstDMA+v.dma*vipLineCycles:
+			for i := range v.lines[v.dma] {
+				v.lines[v.dma][i] = v.Read(v.CPU.R[0])
+				v.CPU.R[0]++
+			}
+			v.dma++
+			v.cycle += vipLineBytes
+			v.CPU.Idle = false
+		case v.display && !v.irq && v.cycle >= vipInterrupt:
+			v.irq = true
+			v.cycle += v.CPU.Interrupt()
+		case v.CPU.Idle:
+			// wait for the next DMA or interrupt
+			v.cycle = v.nextEvent()
+		default:
+			v.cycle += v.CPU.Step(v)
+		}
+	}
+	v.cycle -= VIPFrameCycles
+	if !v.display {
+		v.lines = [vipDisplayLines][vipLineBytes]byte{}
+	}
+	v.dma, v.irq = 0, false
+
+	d := &e.Display
+	if d.Width != int(DisplayWidth) || d.Height != int(DisplayHeigth) {
+		d.Resize(int(DisplayWidth), int(DisplayHeigth))
+	}
+	for y := 0; y < d.Height; y++ {
+		line := &v.lines[y*vipLinesPerRow]
+		for x := 0; x < d.Width; x++ {
+			d.setPixel(x, y, line[x/8]>>(7-x%8)&1)
+		}
+	}
+}
+
+// nextEvent returns the cycle of the next DMA or interrupt, the end of the
+// frame if there is none.
+func (v *VIP) nextEvent() int {
+	switch {
+	case !v.display:
+	case !v.irq:
+		return max(v.cycle, vipInterrupt)
+	case v.dma < vipDisplayLines:
+		return max(v.cycle, vipFirstDMA+v.dma*vipLineCycles)
+	}
+	return VIPFrameCycles
+}
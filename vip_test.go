@@ -0,0 +1,141 @@
+package chip8
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// vipTestInterpreter turns the display on, shows 0x0C00-0x0FFF and sets Q
+// while key 5 is pressed.
+var vipTestInterpreter = []byte{
+	0xf8, 0x00, 0xb1, // 0000 R1 = 0x0042, interrupt
+	0xf8, 0x42, 0xa1,
+	0xf8, 0x0e, 0xb2, // 0006 R2 = 0x0ECF, stack
+	0xf8, 0xcf, 0xa2,
+	0xf8, 0x00, 0xb3, // 000C R3 = 0x0020, main
+	0xf8, 0x20, 0xa3,
+	0xd3, // 0012 SEP R3
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xe2,             // 0020 SEX R2
+	0x69,             // 0021 INP 1, display on
+	0xf8, 0x00, 0xb4, // 0022 R4 = 0x003F, key
+	0xf8, 0x3f, 0xa4,
+	0xe4,       // 0028 SEX R4
+	0x62,       // 0029 OUT 2, latch key
+	0x24,       // 002A DEC R4
+	0xe2,       // 002B SEX R2
+	0x3e, 0x31, // 002C BN3 0031
+	0x7b,       // 002E SEQ
+	0x30, 0x28, // 002F BR 0028
+	0x7a,       // 0031 REQ
+	0x30, 0x28, // 0032 BR 0028
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x05,       // 003F key
+	0x72,       // 0040 LDXA, restore D
+	0x70,       // 0041 RET
+	0x22, 0x78, // 0042 DEC R2; SAV
+	0x22, 0x52, // 0044 DEC R2; STR R2
+	0xf8, 0x0c, 0xb0, // 0046 R0 = 0x0C00, display
+	0xf8, 0x00, 0xa0,
+	0x30, 0x40, // 004C BR 0040
+}
+
+func createVIPEmulator(t *testing.T) (*Emulator, *MockInput, *MockAudio) {
+	input, audio := &MockInput{}, &MockAudio{}
+	e, err := CreateEmulator(&GraphicsHeadless{}, input, audio)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewVIP(vipTestInterpreter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.StartVIP(v); err != nil {
+		t.Fatal(err)
+	}
+	return e, input, audio
+}
+
+func TestVIP(t *testing.T) {
+	e, input, audio := createVIPEmulator(t)
+	e.Memory[0x0c00] = 0x80
+	e.Memory[0x0c21] = 0x01
+	for i := 0; i < 2; i++ {
+		if err := e.RunFrame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d := &e.Display
+	if d.Pixel(0, 0) != 1 || d.Pixel(15, 1) != 1 || bytes.Count(d.Pixels, []byte{1}) != 2 {
+		t.Errorf("Display lines not shown, %d pixels on", bytes.Count(d.Pixels, []byte{1}))
+	}
+	if e.VIP.CPU.Q || len(audio.events) != 0 {
+		t.Errorf("Tone without a key, events=%v", audio.events)
+	}
+
+	input.keys = 1 << 5
+	e.RunFrame()
+	if !e.VIP.CPU.Q || len(audio.events) != 1 || audio.events[0] != "start" {
+		t.Errorf("No tone while key 5 is pressed, events=%v", audio.events)
+	}
+
+	// the state of the VIP is saved
+	var state bytes.Buffer
+	if err := e.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+	saved := bytes.Clone(state.Bytes())
+	e.RunFrame()
+	expected := e.VIP.CPU
+	e.LoadState(&state)
+	e.RunFrame()
+	if e.VIP.CPU != expected {
+		t.Errorf("Frame after loading differs:\n%s", e.VIP.CPU.String())
+	}
+
+	// registers and cycles out of range are rejected
+	chunk := bytes.Index(saved, []byte("1802")) + 8
+	for _, patch := range []struct {
+		name   string
+		offset int
+		value  []byte
+	}{
+		{"P", 32, []byte{200}},
+		{"X", 33, []byte{16}},
+		{"Cycle", 40, []byte{0x80, 0, 0, 0}},
+		{"Cycle", 40, []byte{0x7f, 0, 0, 0}},
+		{"DMA", 45, []byte{129}},
+	} {
+		invalid := bytes.Clone(saved)
+		copy(invalid[chunk+patch.offset:], patch.value)
+		var errState ErrState
+		if err := e.LoadState(bytes.NewReader(resum(invalid))); !errors.As(err, &errState) || e.VIP.CPU != expected {
+			t.Errorf("Expected ErrState for %s % x, actual=%v", patch.name, patch.value, err)
+		}
+	}
+
+	e2, _ := createStateEmulator(t)
+	if err := e2.LoadState(bytes.NewReader(saved)); err == nil {
+		t.Errorf("State of the VIP loaded without VIP")
+	}
+}
+
+func TestVIPROM(t *testing.T) {
+	v, err := NewVIP([]byte{0x00})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the interpreter's Fx29 points I to 0x8100 + digit
+	for digit := 0; digit < 16; digit++ {
+		addr := 0x8100 | uint16(v.Read(0x8100+uint16(digit)))
+		for i, b := range fontData[digit] {
+			if v.ROM[addr%VIPROMSize+uint16(i)] != b {
+				t.Errorf("Digit %X differs", digit)
+			}
+		}
+	}
+	if _, err := NewVIP(make([]byte, 0x201)); err == nil {
+		t.Errorf("Interpreter larger than 512 bytes accepted")
+	}
+}
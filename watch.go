@@ -0,0 +1,131 @@
+package chip8
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Access is a kind of memory access, the kinds can be combined.
+type Access byte
+
+const (
+	AccessRead Access = 1 << iota
+	AccessWrite
+	AccessExecute
+)
+
+func (a Access) String() string {
+	s := ""
+	for i, c := range "rwx" {
+		if a&(1<<i) != 0 {
+			s += string(c)
+		}
+	}
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// Watchpoint watches the addresses From through To for accesses.
+type Watchpoint struct {
+	From   uint16
+	To     uint16
+	Access Access
+}
+
+func (w Watchpoint) String() string {
+	if w.From == w.To {
+		return fmt.Sprintf("%04X %s", w.From, w.Access)
+	}
+	return fmt.Sprintf("%04X-%04X %s", w.From, w.To, w.Access)
+}
+
+// WatchHit is an access to a watched address by the instruction Opcode at PC.
+type WatchHit struct {
+	Watchpoint Watchpoint
+	Access     Access
+	Addr       uint16
+	Value      byte // value read or written
+	PC         uint16
+	Opcode     uint16
+}
+
+func (h WatchHit) String() string {
+	what := map[Access]string{AccessRead: "read", AccessWrite: "write", AccessExecute: "execute"}[h.Access]
+	return fmt.Sprintf("%s %04X = %02X by %04X at %04X", what, h.Addr, h.Value, h.Opcode, h.PC)
+}
+
+// Watchpoints is a Bus that reports accesses to watched addresses to
+// OnHit. Set Emulator.Watchpoints to route the accesses of the CPU
+// through it.
+type Watchpoints struct {
+	Memory *Memory
+	OnHit  func(hit WatchHit)
+
+	list   []Watchpoint
+	pc     uint16 // instruction being executed
+	opcode uint16
+}
+
+func NewWatchpoints(m *Memory, onHit func(hit WatchHit)) *Watchpoints {
+	return &Watchpoints{Memory: m, OnHit: onHit}
+}
+
+func (w *Watchpoints) Add(wp Watchpoint) {
+	if wp.From > wp.To {
+		wp.From, wp.To = wp.To, wp.From
+	}
+	w.list = append(w.list, wp)
+}
+
+// Remove removes all watchpoints that contain addr.
+func (w *Watchpoints) Remove(addr uint16) {
+	w.list = slices.DeleteFunc(w.list, func(wp Watchpoint) bool {
+		return wp.From <= addr && addr <= wp.To
+	})
+}
+
+func (w *Watchpoints) Clear() {
+	w.list = nil
+}
+
+func (w *Watchpoints) List() []Watchpoint {
+	return slices.Clone(w.list)
+}
+
+func (w *Watchpoints) check(addr uint16, access Access, value byte) {
+	for _, wp := range w.list {
+		if wp.Access&access != 0 && wp.From <= addr && addr <= wp.To && w.OnHit != nil {
+			w.OnHit(WatchHit{wp, access, addr, value, w.pc, w.opcode})
+		}
+	}
+}
+
+func (w *Watchpoints) Read(addr uint16) byte {
+	value := w.Memory.Read(addr)
+	w.check(addr, AccessRead, value)
+	return value
+}
+
+func (w *Watchpoints) Write(addr uint16, value byte) {
+	w.Memory.Write(addr, value)
+	w.check(addr, AccessWrite, value)
+}
+
+func (w *Watchpoints) Fetch(addr uint16) uint16 {
+	return w.Memory.Fetch(addr)
+}
+
+// execute starts the instruction at pc, the accesses until the next one
+// are reported with it.
+func (w *Watchpoints) execute(pc, opcode uint16) {
+	w.pc, w.opcode = pc, opcode
+	size := uint16(2)
+	if opcode == 0xf000 {
+		size = 4
+	}
+	for i := uint16(0); i < size; i++ {
+		w.check(pc+i, AccessExecute, w.Memory.Read(pc+i))
+	}
+}
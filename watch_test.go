@@ -0,0 +1,51 @@
+package chip8
+
+import "testing"
+
+func TestWatchpoints(t *testing.T) {
+	e, err := CreateEmulator(&MockDisplay{}, &MockInput{}, &MockAudio{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.LoadProgram([]byte{
+		0xa3, 0x00, // 0200 LD I, #300
+		0x60, 0x7b, // 0202 LD V0, #7B
+		0xf0, 0x33, // 0204 LD B, V0
+		0xf1, 0x65, // 0206 LD V1, [I]
+	})
+
+	var hits []WatchHit
+	e.Watchpoints = NewWatchpoints(&e.Memory, func(hit WatchHit) {
+		hits = append(hits, hit)
+	})
+	e.Watchpoints.Add(Watchpoint{From: 0x301, To: 0x302, Access: AccessRead | AccessWrite})
+	e.Watchpoints.Add(Watchpoint{From: 0x206, To: 0x206, Access: AccessExecute})
+	for i := 0; i < 4; i++ {
+		if err := e.Step(false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []WatchHit{
+		{Watchpoint{0x301, 0x302, AccessRead | AccessWrite}, AccessWrite, 0x301, 2, 0x204, 0xf033},
+		{Watchpoint{0x301, 0x302, AccessRead | AccessWrite}, AccessWrite, 0x302, 3, 0x204, 0xf033},
+		{Watchpoint{0x206, 0x206, AccessExecute}, AccessExecute, 0x206, 0xf1, 0x206, 0xf165},
+		{Watchpoint{0x301, 0x302, AccessRead | AccessWrite}, AccessRead, 0x301, 2, 0x206, 0xf165},
+	}
+	if len(hits) != len(expected) {
+		t.Fatalf("Expected %d hits, actual=%v", len(expected), hits)
+	}
+	for i, hit := range hits {
+		if hit != expected[i] {
+			t.Errorf("Wrong hit %d, expected=%v actual=%v", i, expected[i], hit)
+		}
+	}
+	if s := hits[0].String(); s != "write 0301 = 02 by F033 at 0204" {
+		t.Errorf("Wrong hit string: %q", s)
+	}
+
+	e.Watchpoints.Remove(0x302)
+	if wps := e.Watchpoints.List(); len(wps) != 1 || wps[0].From != 0x206 {
+		t.Errorf("Wrong watchpoints after remove: %v", wps)
+	}
+}